@@ -31,7 +31,10 @@ func main() {
 
 	// 自动迁移
 	fmt.Println("🚀 开始迁移数据库...")
-	if err := db.AutoMigrate(&models.User{}, &models.Image{}, &models.ImageStats{}); err != nil {
+	if err := db.SetupJoinTable(&models.Image{}, "Tags", &models.ImageTag{}); err != nil {
+		log.Fatalf("❌ 数据库迁移失败: %v", err)
+	}
+	if err := db.AutoMigrate(&models.User{}, &models.Image{}, &models.ImageStats{}, &models.ImageVariant{}, &models.TusUpload{}, &models.APIToken{}, &models.Session{}, &models.RecoveryCode{}, &models.Setting{}, &models.InviteCode{}, &models.LoginThrottle{}, &models.AuditLog{}, &models.Album{}, &models.AlbumImage{}, &models.ShareLink{}, &models.ShareLinkImage{}, &models.Tag{}, &models.ImageTag{}); err != nil {
 		log.Fatalf("❌ 数据库迁移失败: %v", err)
 	}
 
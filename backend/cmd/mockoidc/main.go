@@ -0,0 +1,245 @@
+// 本地模拟 OIDC 身份提供方，用于开发和测试单点登录
+// 使用方法: go run ./cmd/mockoidc
+// 然后以 OIDC_ISSUER=http://localhost:9000 OIDC_CLIENT_ID=gotux OIDC_CLIENT_SECRET=secret 启动后端
+//
+// 授权页面是一个表单，可以填写任意用户名、邮箱和分组（逗号分隔），提交后即视为登录成功
+
+package main
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"html/template"
+	"log"
+	"math/big"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const keyID = "mock-key"
+
+type authCode struct {
+	clientID      string
+	redirectURI   string
+	nonce         string
+	codeChallenge string
+	username      string
+	email         string
+	groups        []string
+	expiresAt     time.Time
+}
+
+var (
+	issuer       = getEnv("MOCK_OIDC_ISSUER", "http://localhost:9000")
+	clientID     = getEnv("MOCK_OIDC_CLIENT_ID", "gotux")
+	clientSecret = getEnv("MOCK_OIDC_CLIENT_SECRET", "secret")
+
+	signingKey *rsa.PrivateKey
+	codes      sync.Map
+)
+
+var authorizePage = template.Must(template.New("authorize").Parse(`<!DOCTYPE html>
+<html><head><meta charset="utf-8"><title>Mock OIDC</title></head>
+<body style="font-family: sans-serif; max-width: 360px; margin: 60px auto">
+<h2>Mock OIDC 登录</h2>
+<form method="post" action="/authorize">
+{{range $k, $v := .Params}}<input type="hidden" name="{{$k}}" value="{{index $v 0}}">{{end}}
+<p><label>用户名<br><input name="username" value="alice"></label></p>
+<p><label>邮箱<br><input name="email" value="alice@example.com"></label></p>
+<p><label>分组（逗号分隔）<br><input name="groups" value="staff"></label></p>
+<button type="submit">登录</button>
+</form>
+</body></html>`))
+
+func main() {
+	var err error
+	signingKey, err = rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		log.Fatalf("生成签名密钥失败: %v", err)
+	}
+
+	http.HandleFunc("/.well-known/openid-configuration", discovery)
+	http.HandleFunc("/jwks", jwks)
+	http.HandleFunc("/authorize", authorize)
+	http.HandleFunc("/token", token)
+
+	addr := getEnv("MOCK_OIDC_ADDR", ":9000")
+	log.Printf("Mock OIDC provider %s listening on %s (client_id=%s)", issuer, addr, clientID)
+	log.Fatal(http.ListenAndServe(addr, nil))
+}
+
+func discovery(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"issuer":                                issuer,
+		"authorization_endpoint":                issuer + "/authorize",
+		"token_endpoint":                        issuer + "/token",
+		"jwks_uri":                              issuer + "/jwks",
+		"response_types_supported":              []string{"code"},
+		"subject_types_supported":               []string{"public"},
+		"id_token_signing_alg_values_supported": []string{"RS256"},
+		"code_challenge_methods_supported":      []string{"S256"},
+		"token_endpoint_auth_methods_supported": []string{"client_secret_basic", "client_secret_post"},
+	})
+}
+
+func jwks(w http.ResponseWriter, r *http.Request) {
+	pub := signingKey.PublicKey
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"keys": []map[string]string{{
+			"kty": "RSA",
+			"kid": keyID,
+			"use": "sig",
+			"alg": "RS256",
+			"n":   base64.RawURLEncoding.EncodeToString(pub.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes()),
+		}},
+	})
+}
+
+// authorize GET 显示登录表单，POST 签发授权码并跳转回客户端
+func authorize(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "invalid request", http.StatusBadRequest)
+		return
+	}
+
+	if r.Form.Get("client_id") != clientID || r.Form.Get("response_type") != "code" {
+		http.Error(w, "invalid client_id or response_type", http.StatusBadRequest)
+		return
+	}
+	if r.Form.Get("code_challenge_method") != "S256" || r.Form.Get("code_challenge") == "" {
+		http.Error(w, "PKCE S256 is required", http.StatusBadRequest)
+		return
+	}
+
+	if r.Method == http.MethodGet {
+		params := url.Values{}
+		for _, key := range []string{"client_id", "response_type", "redirect_uri", "scope", "state", "nonce", "code_challenge", "code_challenge_method"} {
+			params.Set(key, r.Form.Get(key))
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		authorizePage.Execute(w, map[string]interface{}{"Params": params})
+		return
+	}
+
+	code := randomString()
+	var groups []string
+	for _, group := range strings.Split(r.Form.Get("groups"), ",") {
+		if group = strings.TrimSpace(group); group != "" {
+			groups = append(groups, group)
+		}
+	}
+	codes.Store(code, &authCode{
+		clientID:      r.Form.Get("client_id"),
+		redirectURI:   r.Form.Get("redirect_uri"),
+		nonce:         r.Form.Get("nonce"),
+		codeChallenge: r.Form.Get("code_challenge"),
+		username:      r.Form.Get("username"),
+		email:         r.Form.Get("email"),
+		groups:        groups,
+		expiresAt:     time.Now().Add(time.Minute),
+	})
+
+	redirect, err := url.Parse(r.Form.Get("redirect_uri"))
+	if err != nil {
+		http.Error(w, "invalid redirect_uri", http.StatusBadRequest)
+		return
+	}
+	query := redirect.Query()
+	query.Set("code", code)
+	query.Set("state", r.Form.Get("state"))
+	redirect.RawQuery = query.Encode()
+	http.Redirect(w, r, redirect.String(), http.StatusFound)
+}
+
+// token 校验客户端、授权码和 PKCE，签发 ID Token
+func token(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost || r.ParseForm() != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_request"})
+		return
+	}
+
+	id, secret, ok := r.BasicAuth()
+	if ok {
+		id, _ = url.QueryUnescape(id)
+		secret, _ = url.QueryUnescape(secret)
+	} else {
+		id, secret = r.Form.Get("client_id"), r.Form.Get("client_secret")
+	}
+	if id != clientID || secret != clientSecret {
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "invalid_client"})
+		return
+	}
+
+	value, ok := codes.LoadAndDelete(r.Form.Get("code"))
+	if !ok || r.Form.Get("grant_type") != "authorization_code" {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_grant"})
+		return
+	}
+	code := value.(*authCode)
+	verifier := sha256.Sum256([]byte(r.Form.Get("code_verifier")))
+	if time.Now().After(code.expiresAt) || code.clientID != id ||
+		code.redirectURI != r.Form.Get("redirect_uri") ||
+		base64.RawURLEncoding.EncodeToString(verifier[:]) != code.codeChallenge {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_grant"})
+		return
+	}
+
+	now := time.Now()
+	claims := jwt.MapClaims{
+		"iss":                issuer,
+		"sub":                "mock|" + code.username,
+		"aud":                clientID,
+		"iat":                now.Unix(),
+		"exp":                now.Add(5 * time.Minute).Unix(),
+		"nonce":              code.nonce,
+		"preferred_username": code.username,
+		"email":              code.email,
+		"email_verified":     true,
+		"groups":             code.groups,
+	}
+	idToken := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	idToken.Header["kid"] = keyID
+	signed, err := idToken.SignedString(signingKey)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "server_error"})
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"access_token": randomString(),
+		"token_type":   "Bearer",
+		"expires_in":   300,
+		"id_token":     signed,
+	})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func randomString() string {
+	buf := make([]byte, 16)
+	rand.Read(buf)
+	return hex.EncodeToString(buf)
+}
+
+func getEnv(key, defaultValue string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return defaultValue
+}
@@ -0,0 +1,131 @@
+// 本地 SMTP 收件箱，用于开发和测试找回密码、邮箱验证等邮件
+// 使用方法: go run ./cmd/mocksmtp
+// 然后以 SMTP_HOST=localhost SMTP_PORT=2525 SMTP_ENCRYPTION=none SMTP_FROM=noreply@gotux.local 启动后端
+//
+// 收到的邮件会解码后打印到标准输出；设置 MOCK_SMTP_DIR 时同时保存为 .eml 文件
+
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+func main() {
+	addr := getEnv("MOCK_SMTP_ADDR", ":2525")
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		log.Fatalf("监听失败: %v", err)
+	}
+	log.Printf("Mock SMTP server listening on %s", addr)
+
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			log.Printf("接受连接失败: %v", err)
+			continue
+		}
+		go handle(conn)
+	}
+}
+
+func handle(conn net.Conn) {
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(time.Minute))
+	r := bufio.NewReader(conn)
+	reply := func(line string) { fmt.Fprintf(conn, "%s\r\n", line) }
+
+	reply("220 mocksmtp ESMTP ready")
+	var from string
+	var rcpts []string
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		line = strings.TrimRight(line, "\r\n")
+		cmd := strings.ToUpper(line)
+
+		switch {
+		case strings.HasPrefix(cmd, "EHLO"):
+			reply("250-mocksmtp")
+			reply("250 8BITMIME")
+		case strings.HasPrefix(cmd, "HELO"):
+			reply("250 mocksmtp")
+		case strings.HasPrefix(cmd, "MAIL FROM:"):
+			from, rcpts = strings.TrimSpace(line[10:]), nil
+			reply("250 OK")
+		case strings.HasPrefix(cmd, "RCPT TO:"):
+			rcpts = append(rcpts, strings.TrimSpace(line[8:]))
+			reply("250 OK")
+		case cmd == "DATA":
+			reply("354 End data with <CR><LF>.<CR><LF>")
+			var data strings.Builder
+			for {
+				line, err := r.ReadString('\n')
+				if err != nil {
+					return
+				}
+				if line == ".\r\n" || line == ".\n" {
+					break
+				}
+				data.WriteString(strings.TrimPrefix(line, "."))
+			}
+			deliver(from, rcpts, data.String())
+			reply("250 OK: queued")
+		case cmd == "RSET":
+			from, rcpts = "", nil
+			reply("250 OK")
+		case cmd == "NOOP":
+			reply("250 OK")
+		case cmd == "QUIT":
+			reply("221 Bye")
+			return
+		default:
+			reply("502 Command not implemented")
+		}
+	}
+}
+
+// deliver 打印邮件，正文按 Content-Transfer-Encoding 解码，便于直接复制其中的链接
+func deliver(from string, rcpts []string, data string) {
+	fmt.Printf("==== %s  MAIL FROM %s  RCPT TO %s\n", time.Now().Format(time.RFC3339), from, strings.Join(rcpts, ", "))
+
+	msg, err := mail.ReadMessage(strings.NewReader(data))
+	if err != nil {
+		fmt.Println(data)
+	} else {
+		subject, _ := new(mime.WordDecoder).DecodeHeader(msg.Header.Get("Subject"))
+		fmt.Printf("From: %s\nTo: %s\nSubject: %s\n\n", msg.Header.Get("From"), msg.Header.Get("To"), subject)
+		var body io.Reader = msg.Body
+		if strings.EqualFold(msg.Header.Get("Content-Transfer-Encoding"), "quoted-printable") {
+			body = quotedprintable.NewReader(body)
+		}
+		io.Copy(os.Stdout, body)
+		fmt.Println()
+	}
+
+	if dir := os.Getenv("MOCK_SMTP_DIR"); dir != "" {
+		name := filepath.Join(dir, fmt.Sprintf("%d.eml", time.Now().UnixNano()))
+		if err := os.WriteFile(name, []byte(data), 0644); err != nil {
+			log.Printf("保存邮件失败: %v", err)
+		}
+	}
+}
+
+func getEnv(key, defaultValue string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return defaultValue
+}
@@ -1,8 +1,12 @@
 package config
 
 import (
+	"encoding/json"
 	"log"
 	"os"
+	"regexp"
+	"strconv"
+	"strings"
 )
 
 type Config struct {
@@ -10,11 +14,19 @@ type Config struct {
 	Database DatabaseConfig
 	JWT      JWTConfig
 	Upload   UploadConfig
+	OIDC     OIDCConfig
+	LDAP     LDAPConfig
+	SMTP     SMTPConfig
+	Login    LoginConfig
 }
 
 type ServerConfig struct {
-	Port string
-	Mode string
+	Port      string
+	Mode      string
+	PublicURL string // 站点对外地址，用于邮件中的链接，为空时按请求地址生成
+	// TrustedProxies 可信的反向代理地址（IP 或 CIDR），只采信它们转发的 X-Forwarded-For。
+	// 为空时不信任任何代理，客户端 IP 取连接的来源地址。部署在反向代理后面时需要配置，否则所有请求都来自代理的 IP
+	TrustedProxies []string
 }
 
 type DatabaseConfig struct {
@@ -23,14 +35,131 @@ type DatabaseConfig struct {
 }
 
 type JWTConfig struct {
-	Secret     string
-	ExpireTime int // 过期时间（小时）
+	Secret           string
+	ExpireTime       int // 登录会话（刷新令牌）有效期（小时）
+	AccessExpireTime int // 访问令牌有效期（分钟）
 }
 
 type UploadConfig struct {
 	MaxSize      int64 // 最大文件大小（字节）
+	MaxPixels    int64 // 最大像素数（宽 × 高），解码前检查，0 表示不限制
 	AllowedTypes []string
-	StoragePath  string
+	Driver       string // 存储后端: local, s3
+	StoragePath  string // 本地存储根目录
+	PublicPath   string // 本地存储的静态访问前缀，为空则不提供直链
+	S3           S3Config
+
+	WatermarkFont string // 水印字体文件路径（TTF/OTF），为空使用内置字体
+
+	Variants     []VariantConfig // 缩略图等衍生尺寸
+	LazyVariants bool            // 为 true 时不在上传时生成，首次访问时再生成
+
+	TransformPresets   []TransformPreset // /i/:uuid 按需处理允许的参数组合
+	TransformCachePath string            // 按需处理结果的磁盘缓存目录
+
+	TusPath   string // tus 断点续传的临时文件目录
+	TusExpire int    // 未完成的 tus 上传保留时间（小时）
+
+	RemoteTimeout      int  // 从 URL 上传时的下载超时（秒）
+	RemoteAllowPrivate bool // 允许从内网地址下载，仅用于开发和测试
+
+	CompatJSONTemplate string // 兼容上传接口 format=json 时的响应模板，为空使用默认格式
+}
+
+// OIDCConfig OpenID Connect 单点登录配置，设置了 Issuer 和 ClientID 时启用
+type OIDCConfig struct {
+	Issuer        string
+	ClientID      string
+	ClientSecret  string
+	RedirectURL   string   // 回调地址，需在身份提供方登记，形如 https://img.example.com/api/auth/oidc/callback
+	Scopes        []string // 默认 openid profile email
+	UsernameClaim string   // 用作用户名的声明，默认 preferred_username
+	EmailClaim    string   // 默认 email
+	RoleClaim     string   // 用于映射角色的声明（字符串或字符串数组），默认 groups
+	RoleMapping   map[string]string
+	RequireRole   bool   // 为 true 时声明中没有可映射的值的用户不能登录
+	AutoCreate    bool   // 首次登录时自动创建用户
+	ButtonText    string // 登录页按钮文字
+}
+
+// Enabled 是否配置了单点登录
+func (c OIDCConfig) Enabled() bool {
+	return c.Issuer != "" && c.ClientID != ""
+}
+
+// LDAPConfig LDAP 目录登录配置，设置了 URL 和 BaseDN 时启用
+type LDAPConfig struct {
+	URL           string // ldap://host:389 或 ldaps://host:636
+	StartTLS      bool   // 在 ldap:// 连接上使用 StartTLS
+	SkipVerify    bool   // 不校验服务器证书，仅用于测试
+	BindDN        string // 用于查找用户的服务账号，为空时直接以 UserDN 模板绑定用户
+	BindPassword  string
+	UserDN        string            // 用户 DN 模板，{username} 会被替换，如 uid={username},ou=people,dc=example,dc=com
+	BaseDN        string            // 查找用户的根节点
+	UserFilter    string            // 查找用户的过滤器，{username} 会被替换，默认 (uid={username})
+	UsernameAttr  string            // 用户名属性，默认 uid
+	EmailAttr     string            // 邮箱属性，默认 mail
+	GroupAttr     string            // 用户条目上的分组属性，默认 memberOf
+	RoleMapping   map[string]string // 分组（cn 或完整 DN）到角色的映射
+	RequireRole   bool              // 为 true 时不属于任何映射分组的用户不能登录
+	AutoCreate    bool              // 首次登录时自动创建用户
+	LocalFallback []string          // 始终使用本地密码登录的账户，默认 admin
+}
+
+// Enabled 是否配置了 LDAP 登录
+func (c LDAPConfig) Enabled() bool {
+	return c.URL != "" && c.BaseDN != ""
+}
+
+// LoginConfig 登录失败次数限制
+type LoginConfig struct {
+	MaxFailures     int // 同一用户名连续失败多少次后锁定，0 表示不限制
+	IPMaxFailures   int // 同一 IP 失败多少次后锁定，0 表示不限制
+	LockoutDuration int // 锁定时长（分钟），也是失败次数的统计窗口
+}
+
+// SMTPConfig 发送邮件的 SMTP 服务，设置了 Host 和 From 时启用
+type SMTPConfig struct {
+	Host       string
+	Port       int
+	Username   string // 为空时不认证
+	Password   string
+	From       string // 发件人，如 Gotux <noreply@example.com>
+	Encryption string // starttls（默认，服务器支持时启用）、tls（如 465 端口）或 none
+	SkipVerify bool   // 不校验服务器证书，仅用于测试
+}
+
+// Enabled 是否配置了邮件服务
+func (c SMTPConfig) Enabled() bool {
+	return c.Host != "" && c.From != ""
+}
+
+// VariantConfig 图片衍生尺寸，Size 为最长边像素
+type VariantConfig struct {
+	Name string
+	Size int
+}
+
+// TransformPreset 按需处理预设，只有与预设一致的参数才会被处理，避免任意参数占满缓存
+type TransformPreset struct {
+	Name    string
+	Width   int
+	Height  int
+	Fit     string // cover, contain
+	Quality int
+	Format  string // 为空时允许请求任意支持的输出格式
+}
+
+type S3Config struct {
+	Endpoint     string // 如 https://s3.amazonaws.com 或 http://localhost:9000
+	Region       string
+	Bucket       string
+	Prefix       string // 对象键前缀
+	AccessKey    string
+	SecretKey    string
+	UsePathStyle bool   // MinIO 等通常需要开启
+	PublicURL    string // 对象的公开访问地址前缀，为空则不提供直链
+	PartSize     int64  // 分片大小（字节），超过该大小的文件使用分片上传
 }
 
 var AppConfig *Config
@@ -38,28 +167,130 @@ var AppConfig *Config
 func InitConfig() {
 	AppConfig = &Config{
 		Server: ServerConfig{
-			Port: getEnv("SERVER_PORT", "8080"),
-			Mode: getEnv("SERVER_MODE", "release"),
+			Port:           getEnv("SERVER_PORT", "8080"),
+			Mode:           getEnv("SERVER_MODE", "release"),
+			PublicURL:      strings.TrimSuffix(getEnv("PUBLIC_URL", ""), "/"),
+			TrustedProxies: strings.Fields(strings.ReplaceAll(getEnv("TRUSTED_PROXIES", ""), ",", " ")),
 		},
 		Database: DatabaseConfig{
 			Type: "sqlite",
 			Path: "./gotux.db",
 		},
 		JWT: JWTConfig{
-			Secret:     getEnv("JWT_SECRET", "your-secret-key-change-in-production"),
-			ExpireTime: 24 * 7, // 7天
+			Secret:           getEnv("JWT_SECRET", "your-secret-key-change-in-production"),
+			ExpireTime:       int(getEnvInt64("JWT_REFRESH_EXPIRE", 24*7)), // 7天
+			AccessExpireTime: int(getEnvInt64("JWT_ACCESS_EXPIRE", 15)),
 		},
 		Upload: UploadConfig{
 			MaxSize:      10 * 1024 * 1024, // 10MB
+			MaxPixels:    getEnvInt64("UPLOAD_MAX_PIXELS", 50000000),
 			AllowedTypes: []string{"image/jpeg", "image/png", "image/gif", "image/webp"},
-			StoragePath:  "./uploads",
+			Driver:       getEnv("STORAGE_DRIVER", "local"),
+			StoragePath:  getEnv("STORAGE_PATH", "./uploads"),
+			PublicPath:   "/uploads",
+			S3: S3Config{
+				Endpoint:     getEnv("S3_ENDPOINT", ""),
+				Region:       getEnv("S3_REGION", "us-east-1"),
+				Bucket:       getEnv("S3_BUCKET", ""),
+				Prefix:       getEnv("S3_PREFIX", ""),
+				AccessKey:    getEnv("S3_ACCESS_KEY", ""),
+				SecretKey:    getEnv("S3_SECRET_KEY", ""),
+				UsePathStyle: getEnvBool("S3_PATH_STYLE", false),
+				PublicURL:    getEnv("S3_PUBLIC_URL", ""),
+				PartSize:     getEnvInt64("S3_PART_SIZE", 8*1024*1024),
+			},
+			WatermarkFont: getEnv("WATERMARK_FONT", ""),
+			Variants:      parseVariants(getEnv("IMAGE_VARIANTS", "thumb:256,medium:1024")),
+			LazyVariants:  getEnvBool("IMAGE_VARIANTS_LAZY", false),
+			TransformPresets: parsePresets(getEnv("IMAGE_PRESETS",
+				"small:w=320;medium:w=800;large:w=1600;square:w=256,h=256,fit=cover")),
+			TransformCachePath: getEnv("IMAGE_CACHE_PATH", "./cache/transforms"),
+			TusPath:            getEnv("TUS_UPLOAD_PATH", "./cache/tus"),
+			TusExpire:          int(getEnvInt64("TUS_UPLOAD_EXPIRE", 24)),
+			RemoteTimeout:      int(getEnvInt64("REMOTE_UPLOAD_TIMEOUT", 15)),
+			RemoteAllowPrivate: getEnvBool("REMOTE_UPLOAD_ALLOW_PRIVATE", false),
+			CompatJSONTemplate: parseCompatTemplate(getEnv("COMPAT_JSON_TEMPLATE", "")),
+		},
+		OIDC: OIDCConfig{
+			Issuer:        getEnv("OIDC_ISSUER", ""),
+			ClientID:      getEnv("OIDC_CLIENT_ID", ""),
+			ClientSecret:  getEnv("OIDC_CLIENT_SECRET", ""),
+			RedirectURL:   getEnv("OIDC_REDIRECT_URL", ""),
+			Scopes:        strings.Fields(getEnv("OIDC_SCOPES", "openid profile email")),
+			UsernameClaim: getEnv("OIDC_USERNAME_CLAIM", "preferred_username"),
+			EmailClaim:    getEnv("OIDC_EMAIL_CLAIM", "email"),
+			RoleClaim:     getEnv("OIDC_ROLE_CLAIM", "groups"),
+			RoleMapping:   parseRoleMapping(getEnv("OIDC_ROLE_MAPPING", ""), ","),
+			RequireRole:   getEnvBool("OIDC_REQUIRE_ROLE", false),
+			AutoCreate:    getEnvBool("OIDC_AUTO_CREATE", true),
+			ButtonText:    getEnv("OIDC_BUTTON_TEXT", "使用企业账号登录"),
+		},
+		LDAP: LDAPConfig{
+			URL:           getEnv("LDAP_URL", ""),
+			StartTLS:      getEnvBool("LDAP_START_TLS", false),
+			SkipVerify:    getEnvBool("LDAP_SKIP_VERIFY", false),
+			BindDN:        getEnv("LDAP_BIND_DN", ""),
+			BindPassword:  getEnv("LDAP_BIND_PASSWORD", ""),
+			UserDN:        getEnv("LDAP_USER_DN", ""),
+			BaseDN:        getEnv("LDAP_BASE_DN", ""),
+			UserFilter:    getEnv("LDAP_USER_FILTER", "(uid={username})"),
+			UsernameAttr:  getEnv("LDAP_USERNAME_ATTR", "uid"),
+			EmailAttr:     getEnv("LDAP_EMAIL_ATTR", "mail"),
+			GroupAttr:     getEnv("LDAP_GROUP_ATTR", "memberOf"),
+			RoleMapping:   parseLDAPRoleMapping(getEnv("LDAP_ROLE_MAPPING", "")),
+			RequireRole:   getEnvBool("LDAP_REQUIRE_ROLE", false),
+			AutoCreate:    getEnvBool("LDAP_AUTO_CREATE", true),
+			LocalFallback: strings.Fields(strings.ReplaceAll(getEnv("LDAP_LOCAL_USERS", "admin"), ",", " ")),
 		},
+		Login: LoginConfig{
+			MaxFailures:     int(getEnvInt64("LOGIN_MAX_FAILURES", 5)),
+			IPMaxFailures:   int(getEnvInt64("LOGIN_IP_MAX_FAILURES", 20)),
+			LockoutDuration: int(getEnvInt64("LOGIN_LOCKOUT_MINUTES", 15)),
+		},
+		SMTP: SMTPConfig{
+			Host:       getEnv("SMTP_HOST", ""),
+			Port:       int(getEnvInt64("SMTP_PORT", 587)),
+			Username:   getEnv("SMTP_USERNAME", ""),
+			Password:   getEnv("SMTP_PASSWORD", ""),
+			From:       getEnv("SMTP_FROM", ""),
+			Encryption: getEnv("SMTP_ENCRYPTION", "starttls"),
+			SkipVerify: getEnvBool("SMTP_SKIP_VERIFY", false),
+		},
+	}
+}
+
+// parseRoleMapping 解析 "gotux-admins:admin,staff:user" 格式的声明值到角色的映射，sep 为条目分隔符
+func parseRoleMapping(value, sep string) map[string]string {
+	mapping := make(map[string]string)
+	for _, item := range strings.Split(value, sep) {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		// 声明值本身可能包含冒号（如 URN），以最后一个冒号分隔
+		i := strings.LastIndex(item, ":")
+		if i <= 0 {
+			log.Printf("忽略无效的角色映射: %s", item)
+			continue
+		}
+		claimValue, role := strings.TrimSpace(item[:i]), strings.TrimSpace(item[i+1:])
+		if role != "admin" && role != "user" {
+			log.Printf("忽略无效的角色映射 %s: 角色只能是 admin 或 user", item)
+			continue
+		}
+		mapping[claimValue] = role
 	}
+	return mapping
+}
 
-	// 确保上传目录存在
-	if err := os.MkdirAll(AppConfig.Upload.StoragePath, 0755); err != nil {
-		log.Fatal("Failed to create upload directory:", err)
+// parseLDAPRoleMapping 解析 "cn=admins,ou=groups,dc=example,dc=com:admin;staff:user" 格式的映射。
+// 分组 DN 本身含有逗号，因此以分号分隔；键不区分大小写
+func parseLDAPRoleMapping(value string) map[string]string {
+	mapping := make(map[string]string)
+	for group, role := range parseRoleMapping(value, ";") {
+		mapping[strings.ToLower(group)] = role
 	}
+	return mapping
 }
 
 func getEnv(key, defaultValue string) string {
@@ -68,3 +299,112 @@ func getEnv(key, defaultValue string) string {
 	}
 	return defaultValue
 }
+
+// parseVariants 解析 "thumb:256,medium:1024" 格式的衍生尺寸配置
+func parseVariants(value string) []VariantConfig {
+	var variants []VariantConfig
+	for _, item := range strings.Split(value, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+
+		name, sizeStr, ok := strings.Cut(item, ":")
+		size, err := strconv.Atoi(sizeStr)
+		if !ok || name == "" || err != nil || size <= 0 {
+			log.Fatalf("Invalid IMAGE_VARIANTS item %q, expected name:size", item)
+		}
+		variants = append(variants, VariantConfig{Name: name, Size: size})
+	}
+	return variants
+}
+
+// GetVariant 按名称查找衍生尺寸配置
+func (u UploadConfig) GetVariant(name string) (VariantConfig, bool) {
+	for _, v := range u.Variants {
+		if v.Name == name {
+			return v, true
+		}
+	}
+	return VariantConfig{}, false
+}
+
+// parsePresets 解析 "small:w=320;square:w=256,h=256,fit=cover" 格式的按需处理预设，
+// 可用参数为 w、h、fit、q、fmt
+func parsePresets(value string) []TransformPreset {
+	var presets []TransformPreset
+	for _, item := range strings.Split(value, ";") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+
+		name, params, ok := strings.Cut(item, ":")
+		if !ok || name == "" {
+			log.Fatalf("Invalid IMAGE_PRESETS item %q, expected name:key=value,...", item)
+		}
+
+		preset := TransformPreset{Name: name}
+		for _, param := range strings.Split(params, ",") {
+			key, val, _ := strings.Cut(strings.TrimSpace(param), "=")
+			var err error
+			switch key {
+			case "w":
+				preset.Width, err = strconv.Atoi(val)
+			case "h":
+				preset.Height, err = strconv.Atoi(val)
+			case "q":
+				preset.Quality, err = strconv.Atoi(val)
+			case "fit":
+				preset.Fit = val
+			case "fmt":
+				preset.Format = val
+			default:
+				err = strconv.ErrSyntax
+			}
+			if err != nil {
+				log.Fatalf("Invalid IMAGE_PRESETS parameter %q in %q", param, name)
+			}
+		}
+		presets = append(presets, preset)
+	}
+	return presets
+}
+
+// GetPreset 按名称查找按需处理预设
+func (u UploadConfig) GetPreset(name string) (TransformPreset, bool) {
+	for _, p := range u.TransformPresets {
+		if p.Name == name {
+			return p, true
+		}
+	}
+	return TransformPreset{}, false
+}
+
+// compatPlaceholder 兼容上传响应模板中的占位符，如 {url}
+var compatPlaceholder = regexp.MustCompile(`\{[a-z_]+\}`)
+
+// parseCompatTemplate 检查兼容上传接口的 JSON 响应模板，占位符替换后必须是合法 JSON
+func parseCompatTemplate(value string) string {
+	if value == "" {
+		return ""
+	}
+	if !json.Valid([]byte(compatPlaceholder.ReplaceAllString(value, "0"))) {
+		log.Fatalf("Invalid COMPAT_JSON_TEMPLATE %q, expected JSON with placeholders like {url}", value)
+	}
+	return value
+}
+
+func getEnvBool(key string, defaultValue bool) bool {
+	if value, err := strconv.ParseBool(os.Getenv(key)); err == nil {
+		return value
+	}
+	return defaultValue
+}
+
+func getEnvInt64(key string, defaultValue int64) int64 {
+	if value, err := strconv.ParseInt(os.Getenv(key), 10, 64); err == nil {
+		return value
+	}
+	return defaultValue
+}
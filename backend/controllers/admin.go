@@ -4,6 +4,7 @@ import (
 	"gotux/models"
 	"net/http"
 	"strconv"
+	"strings"
 
 	"github.com/gin-gonic/gin"
 )
@@ -55,7 +56,7 @@ func UpdateUserStatus(c *gin.Context) {
 	}
 
 	var req struct {
-		Status string `json:"status" binding:"required,oneof=active disabled"`
+		Status string `json:"status" binding:"required,oneof=active disabled"` // 设为 active 也可手动激活等待验证邮箱的用户
 	}
 
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -75,6 +76,14 @@ func UpdateUserStatus(c *gin.Context) {
 		return
 	}
 
+	// 禁用用户时吊销其所有登录会话
+	if user.Status == "disabled" {
+		if err := models.RevokeUserSessions(user.ID, ""); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "吊销会话失败"})
+			return
+		}
+	}
+
 	c.JSON(http.StatusOK, gin.H{
 		"message": "更新成功",
 		"user":    user,
@@ -129,22 +138,232 @@ func UpdateUserQuota(c *gin.Context) {
 	})
 }
 
+// UpdateUserUploadLimits 设置用户的上传上限(管理员)，用户个人设置不能超过这些上限
+func UpdateUserUploadLimits(c *gin.Context) {
+	userID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的用户ID"})
+		return
+	}
+
+	var req struct {
+		MaxImageSize      *int64  `json:"max_image_size"`      // 0 表示只受全局限制
+		AllowedImageTypes *string `json:"allowed_image_types"` // 空字符串表示只受全局限制
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请求参数错误"})
+		return
+	}
+
+	user, err := models.GetUserByID(uint(userID))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "用户不存在"})
+		return
+	}
+
+	if req.MaxImageSize != nil {
+		if *req.MaxImageSize < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "图片大小限制不能为负数"})
+			return
+		}
+		user.LimitMaxImageSize = *req.MaxImageSize
+	}
+	if req.AllowedImageTypes != nil {
+		formats, err := parseImageTypes(*req.AllowedImageTypes)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		user.LimitImageTypes = strings.Join(formats, ",")
+	}
+
+	if err := user.Update(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "更新失败"})
+		return
+	}
+
+	policy := newUploadPolicy(user)
+	c.JSON(http.StatusOK, gin.H{
+		"message":              "上传限制更新成功",
+		"user_id":              user.ID,
+		"limit_max_image_size": user.LimitMaxImageSize,
+		"limit_image_types":    user.LimitImageTypes,
+		"upload_max_size":      policy.MaxSize(),
+		"upload_formats":       policy.AllowedFormats(),
+	})
+}
+
+// UpdateUserReview 设置用户上传的图片是否需要审核(管理员)，用户不能自行关闭
+func UpdateUserReview(c *gin.Context) {
+	userID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的用户ID"})
+		return
+	}
+
+	var req struct {
+		EnableImageReview *bool `json:"enable_image_review" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请求参数错误"})
+		return
+	}
+
+	user, err := models.GetUserByID(uint(userID))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "用户不存在"})
+		return
+	}
+
+	user.EnableImageReview = *req.EnableImageReview
+	if err := user.Update(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "更新失败"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":             "图片审核设置已更新",
+		"user_id":             user.ID,
+		"enable_image_review": user.EnableImageReview,
+	})
+}
+
+// ResetUserTwoFactor 关闭用户的两步验证(管理员)，用于用户丢失验证器和恢复码的情况
+func ResetUserTwoFactor(c *gin.Context) {
+	userID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的用户ID"})
+		return
+	}
+
+	user, err := models.GetUserByID(uint(userID))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "用户不存在"})
+		return
+	}
+
+	if err := disableTOTP(user); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "重置两步验证失败"})
+		return
+	}
+	// 重置后需要重新登录
+	if err := models.RevokeUserSessions(user.ID, ""); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "吊销会话失败"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "两步验证已重置"})
+}
+
+// GetSystemSettings 获取系统设置(管理员)
+func GetSystemSettings(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"settings": gin.H{
+			"require_admin_2fa":          models.GetBoolSetting(models.SettingRequireAdmin2FA, false),
+			"require_email_verification": models.GetBoolSetting(models.SettingRequireEmailVerification, false),
+			"registration_mode":          registrationMode(),
+			"registration_domains":       registrationDomains(),
+		},
+		"email_available": emailAvailable(),
+	})
+}
+
+// UpdateSystemSettings 更新系统设置(管理员)
+func UpdateSystemSettings(c *gin.Context) {
+	var req struct {
+		RequireAdmin2FA          *bool     `json:"require_admin_2fa"`                                                     // 管理员必须开启两步验证，未开启的管理员下次登录时需先完成绑定
+		RequireEmailVerification *bool     `json:"require_email_verification"`                                            // 新注册用户验证邮箱后才能登录
+		RegistrationMode         string    `json:"registration_mode" binding:"omitempty,oneof=open invite domain closed"` // 注册模式
+		RegistrationDomains      *[]string `json:"registration_domains"`                                                  // domain 模式允许的邮箱域名
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请求参数错误"})
+		return
+	}
+
+	if req.RequireEmailVerification != nil && *req.RequireEmailVerification && !emailAvailable() {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请先配置 SMTP 和 PUBLIC_URL"})
+		return
+	}
+
+	if req.RegistrationMode == models.RegistrationDomain && req.RegistrationDomains == nil && len(registrationDomains()) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请先设置允许注册的邮箱域名"})
+		return
+	}
+
+	// 邮箱域名注册依赖邮箱验证证明邮箱属于注册者
+	mode := req.RegistrationMode
+	if mode == "" {
+		mode = registrationMode()
+	}
+	verification := emailVerificationRequired()
+	if req.RequireEmailVerification != nil {
+		verification = *req.RequireEmailVerification
+	}
+	if mode == models.RegistrationDomain && !verification {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "邮箱域名注册需要先开启邮箱验证"})
+		return
+	}
+
+	if req.RequireAdmin2FA != nil {
+		if err := models.SetSetting(models.SettingRequireAdmin2FA, strconv.FormatBool(*req.RequireAdmin2FA)); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "更新失败"})
+			return
+		}
+	}
+	if req.RequireEmailVerification != nil {
+		if err := models.SetSetting(models.SettingRequireEmailVerification, strconv.FormatBool(*req.RequireEmailVerification)); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "更新失败"})
+			return
+		}
+	}
+	if req.RegistrationDomains != nil {
+		var domains []string
+		for _, domain := range *req.RegistrationDomains {
+			domain = strings.ToLower(strings.TrimPrefix(strings.TrimSpace(domain), "@"))
+			if domain == "" || strings.ContainsAny(domain, "@, ") {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "无效的邮箱域名: " + domain})
+				return
+			}
+			domains = append(domains, domain)
+		}
+		if err := models.SetSetting(models.SettingRegistrationDomains, strings.Join(domains, ",")); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "更新失败"})
+			return
+		}
+	}
+	if req.RegistrationMode != "" {
+		if err := models.SetSetting(models.SettingRegistrationMode, req.RegistrationMode); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "更新失败"})
+			return
+		}
+	}
+
+	GetSystemSettings(c)
+}
+
 // GetSystemStats 获取系统统计信息
 func GetSystemStats(c *gin.Context) {
 	var userCount int64
 	var imageCount int64
 	var totalStorage int64
 	var totalViews int64
+	var pendingReviews int64
 
 	models.DB.Model(&models.User{}).Count(&userCount)
 	models.DB.Model(&models.Image{}).Count(&imageCount)
-	models.DB.Model(&models.Image{}).Select("COALESCE(SUM(file_size), 0)").Scan(&totalStorage)
+	models.DB.Model(&models.Image{}).Select("COALESCE(SUM(file_size + COALESCE(original_size, 0)), 0)").Scan(&totalStorage)
 	models.DB.Model(&models.ImageStats{}).Select("COALESCE(SUM(view_count), 0)").Scan(&totalViews)
+	models.DB.Model(&models.Image{}).Where("review_status = ?", models.ReviewPending).Count(&pendingReviews)
 
 	c.JSON(http.StatusOK, gin.H{
-		"user_count":    userCount,
-		"image_count":   imageCount,
-		"total_storage": totalStorage,
-		"total_views":   totalViews,
+		"user_count":      userCount,
+		"image_count":     imageCount,
+		"total_storage":   totalStorage,
+		"total_views":     totalViews,
+		"pending_reviews": pendingReviews,
 	})
 }
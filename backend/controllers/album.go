@@ -0,0 +1,315 @@
+package controllers
+
+import (
+	"gotux/middleware"
+	"gotux/models"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// albumImagesRequest 批量加入、移出或排序相册图片的请求
+type albumImagesRequest struct {
+	ImageIDs []uint `json:"image_ids" binding:"required,min=1,max=500"`
+}
+
+// getOwnedAlbum 获取当前用户自己的相册，失败时已写入错误响应
+func getOwnedAlbum(c *gin.Context, id string) (*models.Album, bool) {
+	userID, exists := middleware.GetUserID(c)
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "未授权"})
+		return nil, false
+	}
+
+	albumID, err := strconv.ParseUint(id, 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的相册ID"})
+		return nil, false
+	}
+
+	album, err := models.GetAlbumByID(uint(albumID))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "相册不存在"})
+		return nil, false
+	}
+
+	if album.UserID != userID {
+		c.JSON(http.StatusForbidden, gin.H{"error": "没有权限访问该相册"})
+		return nil, false
+	}
+
+	return album, true
+}
+
+// GetAlbums 获取当前用户的相册列表
+func GetAlbums(c *gin.Context) {
+	userID, exists := middleware.GetUserID(c)
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "未授权"})
+		return
+	}
+
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	pageSize, _ := strconv.Atoi(c.DefaultQuery("page_size", "20"))
+
+	albums, total, err := models.GetAlbumsByUserID(userID, page, pageSize)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取相册列表失败"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"albums":    albums,
+		"total":     total,
+		"page":      page,
+		"page_size": pageSize,
+	})
+}
+
+// CreateAlbum 创建相册
+func CreateAlbum(c *gin.Context) {
+	userID, exists := middleware.GetUserID(c)
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "未授权"})
+		return
+	}
+
+	var req struct {
+		Name        string `json:"name" binding:"required,max=100"`
+		Description string `json:"description" binding:"max=1000"`
+		IsPublic    bool   `json:"is_public"`
+		ImageIDs    []uint `json:"image_ids" binding:"max=500"` // 创建时一并加入的图片
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请求参数错误"})
+		return
+	}
+
+	name := strings.TrimSpace(req.Name)
+	if name == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "相册名称不能为空"})
+		return
+	}
+
+	album := &models.Album{
+		UserID:      userID,
+		Name:        name,
+		Description: req.Description,
+		IsPublic:    req.IsPublic,
+	}
+	if err := models.CreateAlbum(album); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "创建相册失败"})
+		return
+	}
+
+	if len(req.ImageIDs) > 0 {
+		if _, err := album.AddImages(req.ImageIDs); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "添加图片失败"})
+			return
+		}
+	}
+
+	album, _ = models.GetAlbumByID(album.ID)
+	c.JSON(http.StatusCreated, gin.H{
+		"message": "创建成功",
+		"album":   album,
+	})
+}
+
+// GetAlbum 获取相册详情
+func GetAlbum(c *gin.Context) {
+	album, ok := getOwnedAlbum(c, c.Param("id"))
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"album": album})
+}
+
+// UpdateAlbum 更新相册名称、描述、可见性和封面
+func UpdateAlbum(c *gin.Context) {
+	album, ok := getOwnedAlbum(c, c.Param("id"))
+	if !ok {
+		return
+	}
+
+	var req struct {
+		Name         *string `json:"name" binding:"omitempty,max=100"`
+		Description  *string `json:"description" binding:"omitempty,max=1000"`
+		IsPublic     *bool   `json:"is_public"`
+		CoverImageID *uint   `json:"cover_image_id"` // 0 表示清除封面
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请求参数错误"})
+		return
+	}
+
+	if req.Name != nil {
+		name := strings.TrimSpace(*req.Name)
+		if name == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "相册名称不能为空"})
+			return
+		}
+		album.Name = name
+	}
+	if req.Description != nil {
+		album.Description = *req.Description
+	}
+	if req.IsPublic != nil {
+		album.IsPublic = *req.IsPublic
+	}
+	if req.CoverImageID != nil {
+		if *req.CoverImageID == 0 {
+			album.CoverImageID = nil
+		} else if !album.HasImage(*req.CoverImageID) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "封面必须是相册中的图片"})
+			return
+		} else {
+			album.CoverImageID = req.CoverImageID
+		}
+	}
+
+	if err := album.Update(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "更新失败"})
+		return
+	}
+
+	album, _ = models.GetAlbumByID(album.ID)
+	c.JSON(http.StatusOK, gin.H{
+		"message": "更新成功",
+		"album":   album,
+	})
+}
+
+// DeleteAlbum 删除相册，相册中的图片不会被删除
+func DeleteAlbum(c *gin.Context) {
+	album, ok := getOwnedAlbum(c, c.Param("id"))
+	if !ok {
+		return
+	}
+
+	if err := album.Delete(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "删除失败"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "删除成功"})
+}
+
+// AddAlbumImages 将图片加入相册，只能加入自己的图片
+func AddAlbumImages(c *gin.Context) {
+	album, ok := getOwnedAlbum(c, c.Param("id"))
+	if !ok {
+		return
+	}
+
+	var req albumImagesRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请求参数错误"})
+		return
+	}
+
+	added, err := album.AddImages(req.ImageIDs)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "添加图片失败"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "添加成功",
+		"count":   added,
+	})
+}
+
+// RemoveAlbumImages 将图片移出相册，图片本身不会被删除
+func RemoveAlbumImages(c *gin.Context) {
+	album, ok := getOwnedAlbum(c, c.Param("id"))
+	if !ok {
+		return
+	}
+
+	var req albumImagesRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请求参数错误"})
+		return
+	}
+
+	removed, err := album.RemoveImages(req.ImageIDs)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "移除图片失败"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "移除成功",
+		"count":   removed,
+	})
+}
+
+// ReorderAlbumImages 调整相册中图片的顺序
+func ReorderAlbumImages(c *gin.Context) {
+	album, ok := getOwnedAlbum(c, c.Param("id"))
+	if !ok {
+		return
+	}
+
+	var req albumImagesRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请求参数错误"})
+		return
+	}
+
+	if err := album.ReorderImages(req.ImageIDs); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "排序失败"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "排序成功"})
+}
+
+// GetPublicAlbum 公开浏览相册，只返回公开且已通过审核的图片
+func GetPublicAlbum(c *gin.Context) {
+	albumID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的相册ID"})
+		return
+	}
+
+	album, err := models.GetAlbumByID(uint(albumID))
+	if err != nil || !album.IsPublic {
+		c.JSON(http.StatusNotFound, gin.H{"error": "相册不存在"})
+		return
+	}
+
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	pageSize, _ := strconv.Atoi(c.DefaultQuery("page_size", "20"))
+
+	images, total, err := models.GetImages(models.ImageFilter{
+		UserID:     album.UserID,
+		AlbumID:    album.ID,
+		PublicOnly: true,
+	}, page, pageSize)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取图片列表失败"})
+		return
+	}
+
+	// 封面不可公开访问时不返回
+	if album.Cover != nil && (!album.Cover.IsPublic || !album.Cover.IsApproved()) {
+		album.Cover = nil
+		album.CoverImageID = nil
+	}
+	album.ImageCount = total
+
+	c.JSON(http.StatusOK, gin.H{
+		"album":     album,
+		"images":    images,
+		"total":     total,
+		"page":      page,
+		"page_size": pageSize,
+	})
+}
@@ -1,20 +1,30 @@
 package controllers
 
 import (
+	"bytes"
+	"errors"
 	"gotux/config"
+	"gotux/imageproc"
+	"gotux/loginguard"
 	"gotux/middleware"
 	"gotux/models"
+	"gotux/storage"
+	"io"
+	"log"
 	"net/http"
+	"path"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
 )
 
 type RegisterRequest struct {
-	Username string `json:"username" binding:"required,min=3,max=20"`
-	Email    string `json:"email" binding:"required,email"`
-	Password string `json:"password" binding:"required,min=6"`
+	Username   string `json:"username" binding:"required,min=3,max=20"`
+	Email      string `json:"email" binding:"required,email"`
+	Password   string `json:"password" binding:"required,min=6"`
+	InviteCode string `json:"invite_code"` // 注册模式为 invite 时必填，其他模式下可用于预设角色和配额
 }
 
 type LoginRequest struct {
@@ -23,8 +33,10 @@ type LoginRequest struct {
 }
 
 type LoginResponse struct {
-	Token string       `json:"token"`
-	User  *models.User `json:"user"`
+	Token        string       `json:"token"`         // 访问令牌（短期有效）
+	RefreshToken string       `json:"refresh_token"` // 刷新令牌，用于 /api/auth/refresh
+	ExpiresIn    int          `json:"expires_in"`    // 访问令牌有效期（秒）
+	User         *models.User `json:"user"`
 }
 
 // Register 用户注册
@@ -47,13 +59,47 @@ func Register(c *gin.Context) {
 		return
 	}
 
-	// 创建用户
-	user, err := models.CreateUser(req.Username, req.Email, req.Password)
+	// 检查注册模式和邀请码
+	invite, ok := checkRegistration(c, &req)
+	if !ok {
+		return
+	}
+
+	// 需要验证邮箱时新用户处于等待验证状态，点击验证邮件中的链接后激活
+	status := "active"
+	verify := emailVerificationRequired()
+	if verify {
+		status = "pending"
+	}
+
+	// 创建用户，使用邀请码时同时应用邀请码的设置
+	var user *models.User
+	var err error
+	if invite != nil {
+		user, err = models.CreateInvitedUser(req.Username, req.Email, req.Password, status, invite)
+	} else {
+		user, err = models.CreateUser(req.Username, req.Email, req.Password, status)
+	}
 	if err != nil {
+		if invite != nil {
+			if err := invite.Release(); err != nil {
+				log.Printf("归还邀请码 %s 的使用次数失败: %v", invite.Code, err)
+			}
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "创建用户失败"})
 		return
 	}
 
+	if verify {
+		sendUserEmail(user, purposeVerifyEmail)
+		c.JSON(http.StatusCreated, gin.H{
+			"message":               "注册成功，请查收验证邮件完成激活",
+			"user":                  user,
+			"verification_required": true,
+		})
+		return
+	}
+
 	c.JSON(http.StatusCreated, gin.H{
 		"message": "注册成功",
 		"user":    user,
@@ -68,24 +114,43 @@ func Login(c *gin.Context) {
 		return
 	}
 
+	// 失败次数过多时直接拒绝
+	if rejectThrottledLogin(c, req.Username) {
+		return
+	}
+	defer loginguard.Release(req.Username, c.ClientIP())
+
 	// 验证用户
 	user, err := models.ValidateUser(req.Username, req.Password)
 	if err != nil {
+		if errors.Is(err, models.ErrInvalidCredentials) {
+			loginguard.Fail(req.Username, c.ClientIP())
+		}
 		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
 		return
 	}
 
-	// 生成 JWT Token
-	token, err := generateToken(user)
+	// 需要两步验证时先返回挑战令牌，验证通过后再签发访问令牌。
+	// 失败记录在签发会话后才清除，否则知道密码的人可以反复登录来重置验证码的尝试次数
+	challenge, err := loginChallenge(user)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "生成令牌失败"})
 		return
 	}
+	if challenge != nil {
+		c.JSON(http.StatusOK, challenge)
+		return
+	}
 
-	c.JSON(http.StatusOK, LoginResponse{
-		Token: token,
-		User:  user,
-	})
+	// 创建登录会话并生成令牌
+	resp, err := issueSession(c, user)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "生成令牌失败"})
+		return
+	}
+	loginguard.Succeed(req.Username)
+
+	c.JSON(http.StatusOK, resp)
 }
 
 // GetProfile 获取当前用户信息
@@ -123,8 +188,14 @@ func UpdateProfile(c *gin.Context) {
 		return
 	}
 
-	if req.Email != "" {
+	if req.Email != "" && req.Email != user.Email {
+		if other, err := models.GetUserByEmail(req.Email); err == nil && other.ID != user.ID {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "邮箱已被注册"})
+			return
+		}
+		// 新邮箱需要重新验证，可以通过 /api/auth/resend-verification 申请验证邮件
 		user.Email = req.Email
+		user.EmailVerifiedAt = nil
 	}
 	if req.Avatar != "" {
 		user.Avatar = req.Avatar
@@ -155,11 +226,17 @@ func UpdateSettings(c *gin.Context) {
 		EnableWatermark   *bool  `json:"enable_watermark"`
 		WatermarkText     string `json:"watermark_text"`
 		WatermarkPosition string `json:"watermark_position"`
+		WatermarkOpacity  *int   `json:"watermark_opacity"`
+
+		WatermarkImagePosition string `json:"watermark_image_position"`
+		WatermarkImageScale    *int   `json:"watermark_image_scale"`
+		WatermarkImageMargin   *int   `json:"watermark_image_margin"`
+		WatermarkImageOpacity  *int   `json:"watermark_image_opacity"`
+
 		CompressImage     *bool  `json:"compress_image"`
 		CompressQuality   *int   `json:"compress_quality"`
 		MaxImageSize      *int64 `json:"max_image_size"`
 		AllowedImageTypes string `json:"allowed_image_types"`
-		EnableImageReview *bool  `json:"enable_image_review"`
 	}
 
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -181,8 +258,47 @@ func UpdateSettings(c *gin.Context) {
 		user.WatermarkText = req.WatermarkText
 	}
 	if req.WatermarkPosition != "" {
+		if !isValidWatermarkPosition(req.WatermarkPosition) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "无效的水印位置"})
+			return
+		}
 		user.WatermarkPosition = req.WatermarkPosition
 	}
+	if req.WatermarkOpacity != nil {
+		if *req.WatermarkOpacity < 0 || *req.WatermarkOpacity > 100 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "水印不透明度必须在 0-100 之间"})
+			return
+		}
+		user.WatermarkOpacity = *req.WatermarkOpacity
+	}
+	if req.WatermarkImagePosition != "" {
+		if !isValidWatermarkPosition(req.WatermarkImagePosition) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "无效的水印图片位置"})
+			return
+		}
+		user.WatermarkImagePosition = req.WatermarkImagePosition
+	}
+	if req.WatermarkImageScale != nil {
+		if *req.WatermarkImageScale < 1 || *req.WatermarkImageScale > 100 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "水印图片缩放比例必须在 1-100 之间"})
+			return
+		}
+		user.WatermarkImageScale = *req.WatermarkImageScale
+	}
+	if req.WatermarkImageMargin != nil {
+		if *req.WatermarkImageMargin < 0 || *req.WatermarkImageMargin > 500 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "水印图片边距必须在 0-500 之间"})
+			return
+		}
+		user.WatermarkImageMargin = *req.WatermarkImageMargin
+	}
+	if req.WatermarkImageOpacity != nil {
+		if *req.WatermarkImageOpacity < 0 || *req.WatermarkImageOpacity > 100 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "水印图片不透明度必须在 0-100 之间"})
+			return
+		}
+		user.WatermarkImageOpacity = *req.WatermarkImageOpacity
+	}
 	if req.CompressImage != nil {
 		user.CompressImage = *req.CompressImage
 	}
@@ -198,15 +314,27 @@ func UpdateSettings(c *gin.Context) {
 			c.JSON(http.StatusBadRequest, gin.H{"error": "图片大小限制必须在 0-50MB 之间"})
 			return
 		}
+		// 不能超过管理员为该用户设置的上限
+		if limit := user.LimitMaxImageSize; limit > 0 && *req.MaxImageSize > limit {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "图片大小限制不能超过管理员设置的 " + formatBytes(limit)})
+			return
+		}
 		user.MaxImageSize = *req.MaxImageSize
 	}
 	if req.AllowedImageTypes != "" {
+		formats, err := parseImageTypes(req.AllowedImageTypes)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		for _, format := range formats {
+			if user.LimitImageTypes != "" && !containsFormat(user.LimitImageTypes, format) {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "管理员未允许上传 " + format + " 格式"})
+				return
+			}
+		}
 		user.AllowedImageTypes = req.AllowedImageTypes
 	}
-	if req.EnableImageReview != nil {
-		user.EnableImageReview = *req.EnableImageReview
-	}
-
 	if err := user.Update(); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "更新设置失败"})
 		return
@@ -225,6 +353,7 @@ func GetSettings(c *gin.Context) {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "未授权"})
 		return
 	}
+	policy := newUploadPolicy(user)
 
 	c.JSON(http.StatusOK, gin.H{
 		"settings": gin.H{
@@ -233,6 +362,14 @@ func GetSettings(c *gin.Context) {
 			"enable_watermark":    user.EnableWatermark,
 			"watermark_text":      user.WatermarkText,
 			"watermark_position":  user.WatermarkPosition,
+			"watermark_opacity":   user.WatermarkOpacity,
+
+			"watermark_image":          user.WatermarkImage,
+			"watermark_image_position": user.WatermarkImagePosition,
+			"watermark_image_scale":    user.WatermarkImageScale,
+			"watermark_image_margin":   user.WatermarkImageMargin,
+			"watermark_image_opacity":  user.WatermarkImageOpacity,
+
 			"compress_image":      user.CompressImage,
 			"compress_quality":    user.CompressQuality,
 			"max_image_size":      user.MaxImageSize,
@@ -240,10 +377,115 @@ func GetSettings(c *gin.Context) {
 			"enable_image_review": user.EnableImageReview,
 			"storage_quota":       user.StorageQuota,
 			"used_storage":        user.UsedStorage,
+
+			// 管理员设置的上限及最终生效的上传限制
+			"limit_max_image_size": user.LimitMaxImageSize,
+			"limit_image_types":    user.LimitImageTypes,
+			"upload_max_size":      policy.MaxSize(),
+			"upload_formats":       policy.AllowedFormats(),
 		},
 	})
 }
 
+// maxWatermarkImageSize 水印图片最大 2MB
+const maxWatermarkImageSize = 2 * 1024 * 1024
+
+// UploadWatermarkImage 上传水印图片（PNG Logo）
+func UploadWatermarkImage(c *gin.Context) {
+	user, exists := middleware.GetUser(c)
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "未授权"})
+		return
+	}
+
+	file, err := c.FormFile("file")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "没有上传文件"})
+		return
+	}
+	if file.Size > maxWatermarkImageSize {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "水印图片不能超过 2MB"})
+		return
+	}
+
+	src, err := file.Open()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "文件打开失败"})
+		return
+	}
+	data, err := io.ReadAll(io.LimitReader(src, maxWatermarkImageSize+1))
+	src.Close()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "文件读取失败"})
+		return
+	}
+
+	// 只接受 PNG，以保留透明通道
+	if detected, err := imageproc.Detect(data); err != nil || detected.Format != "png" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "水印图片必须是 PNG 格式"})
+		return
+	}
+
+	key := path.Join("watermarks", uuid.New().String()+".png")
+	if err := storage.Default.Put(c.Request.Context(), key, bytes.NewReader(data), int64(len(data)), "image/png"); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "水印图片保存失败"})
+		return
+	}
+
+	oldKey := user.WatermarkImage
+	user.WatermarkImage = key
+	if err := user.Update(); err != nil {
+		storage.Default.Delete(c.Request.Context(), key)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "更新设置失败"})
+		return
+	}
+	if oldKey != "" {
+		storage.Default.Delete(c.Request.Context(), oldKey)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "水印图片上传成功"})
+}
+
+// GetWatermarkImage 获取当前的水印图片
+func GetWatermarkImage(c *gin.Context) {
+	user, exists := middleware.GetUser(c)
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "未授权"})
+		return
+	}
+
+	if user.WatermarkImage == "" {
+		c.JSON(http.StatusNotFound, gin.H{"error": "未设置水印图片"})
+		return
+	}
+
+	serveStoredObject(c, user.WatermarkImage, "image/png", "watermark.png")
+}
+
+// DeleteWatermarkImage 删除水印图片
+func DeleteWatermarkImage(c *gin.Context) {
+	user, exists := middleware.GetUser(c)
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "未授权"})
+		return
+	}
+
+	if user.WatermarkImage == "" {
+		c.JSON(http.StatusOK, gin.H{"message": "删除成功"})
+		return
+	}
+
+	oldKey := user.WatermarkImage
+	user.WatermarkImage = ""
+	if err := user.Update(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "更新设置失败"})
+		return
+	}
+	storage.Default.Delete(c.Request.Context(), oldKey)
+
+	c.JSON(http.StatusOK, gin.H{"message": "删除成功"})
+}
+
 // ChangePassword 修改密码
 func ChangePassword(c *gin.Context) {
 	user, exists := middleware.GetUser(c)
@@ -262,6 +504,11 @@ func ChangePassword(c *gin.Context) {
 		return
 	}
 
+	if user.IsExternal() {
+		c.JSON(http.StatusBadRequest, gin.H{"error": errExternalPassword.Error()})
+		return
+	}
+
 	// 验证旧密码
 	if err := user.CheckPassword(req.OldPassword); err != nil {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "原密码错误"})
@@ -279,17 +526,45 @@ func ChangePassword(c *gin.Context) {
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"message": "密码修改成功"})
+	// 吊销所有登录会话，并为当前客户端重新登录
+	if err := models.RevokeUserSessions(user.ID, ""); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "吊销会话失败"})
+		return
+	}
+	resp, err := issueSession(c, user)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "生成令牌失败"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":       "密码修改成功，其他设备已退出登录",
+		"token":         resp.Token,
+		"refresh_token": resp.RefreshToken,
+		"expires_in":    resp.ExpiresIn,
+	})
+}
+
+// isValidWatermarkPosition 检查水印位置是否为九宫格之一
+func isValidWatermarkPosition(position string) bool {
+	switch position {
+	case "top-left", "top-center", "top-right",
+		"middle-left", "center", "middle-right",
+		"bottom-left", "bottom-center", "bottom-right":
+		return true
+	}
+	return false
 }
 
-// generateToken 生成 JWT Token
-func generateToken(user *models.User) (string, error) {
-	expirationTime := time.Now().Add(time.Duration(config.AppConfig.JWT.ExpireTime) * time.Hour)
+// generateToken 为登录会话生成短期有效的 JWT 访问令牌
+func generateToken(user *models.User, sessionID string) (string, error) {
+	expirationTime := time.Now().Add(accessTokenLifetime())
 
 	claims := &middleware.Claims{
-		UserID:   user.ID,
-		Username: user.Username,
-		Role:     user.Role,
+		UserID:    user.ID,
+		Username:  user.Username,
+		Role:      user.Role,
+		SessionID: sessionID,
 		RegisteredClaims: jwt.RegisteredClaims{
 			ExpiresAt: jwt.NewNumericDate(expirationTime),
 			IssuedAt:  jwt.NewNumericDate(time.Now()),
@@ -0,0 +1,198 @@
+package controllers
+
+import (
+	"encoding/json"
+	"fmt"
+	"gotux/config"
+	"gotux/middleware"
+	"gotux/models"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// compatFileFields 兼容上传接口依次尝试的文件字段名，都没有时使用表单中的第一个文件
+var compatFileFields = []string{"file", "image", "smfile", "source", "files"}
+
+// CompatUpload 供 PicGo、Typora、ShareX 等工具使用的上传接口：
+// 只接收一个文件（字段名不限），默认返回纯文本 URL，format=json 时返回 JSON
+func CompatUpload(c *gin.Context) {
+	asJSON := c.Query("format") == "json"
+
+	user, exists := middleware.GetUser(c)
+	if !exists {
+		compatError(c, asJSON, http.StatusUnauthorized, "未授权")
+		return
+	}
+
+	form, err := c.MultipartForm()
+	if err != nil {
+		compatError(c, asJSON, http.StatusBadRequest, "表单解析失败")
+		return
+	}
+
+	file := compatFormFile(form)
+	if file == nil {
+		compatError(c, asJSON, http.StatusBadRequest, "没有上传文件")
+		return
+	}
+
+	if err := newUploadPolicy(user).CheckSize(file.Size); err != nil {
+		compatError(c, asJSON, http.StatusRequestEntityTooLarge, err.Error())
+		return
+	}
+
+	src, err := file.Open()
+	if err != nil {
+		compatError(c, asJSON, http.StatusBadRequest, "文件打开失败")
+		return
+	}
+	data, err := io.ReadAll(src)
+	src.Close()
+	if err != nil {
+		compatError(c, asJSON, http.StatusBadRequest, "文件读取失败")
+		return
+	}
+
+	skipWatermark := false
+	if values := form.Value["watermark"]; len(values) > 0 {
+		if enabled, err := strconv.ParseBool(values[0]); err == nil && !enabled {
+			skipWatermark = true
+		}
+	}
+
+	image, err := saveUploadedImage(c.Request.Context(), user, uploadFile{
+		Name:          file.Filename,
+		Data:          data,
+		SkipWatermark: skipWatermark,
+	})
+	if err != nil {
+		compatError(c, asJSON, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	links := buildImageLinks(userBaseURL(c, user), image)
+	if !asJSON {
+		c.String(http.StatusOK, links["url"])
+		return
+	}
+
+	values := map[string]interface{}{
+		"url":        links["url"],
+		"direct_url": links["direct_url"],
+		"thumb_url":  compatThumbURL(links["url"]),
+		"markdown":   links["markdown"],
+		"html":       links["html"],
+		"bbcode":     links["bbcode"],
+		"id":         image.ID,
+		"uuid":       image.UUID,
+		"name":       image.OriginalName,
+		"size":       image.FileSize,
+		"width":      image.Width,
+		"height":     image.Height,
+	}
+
+	if tpl := config.AppConfig.Upload.CompatJSONTemplate; tpl != "" {
+		c.Data(http.StatusOK, "application/json; charset=utf-8", []byte(renderCompatTemplate(tpl, values)))
+		return
+	}
+
+	values["success"] = true
+	c.JSON(http.StatusOK, values)
+}
+
+// GetShareXConfig 下载 ShareX 自定义上传配置（.sxcu），每次下载会创建一个新的 upload 权限 API Token
+func GetShareXConfig(c *gin.Context) {
+	user, exists := middleware.GetUser(c)
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "未授权"})
+		return
+	}
+
+	name := "ShareX " + time.Now().Format("2006-01-02 15:04")
+	_, secret, err := models.CreateAPIToken(user.ID, name, []string{models.ScopeUpload}, nil)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "创建 Token 失败"})
+		return
+	}
+
+	baseURL := userBaseURL(c, user)
+	host := strings.TrimPrefix(strings.TrimPrefix(baseURL, "https://"), "http://")
+	sxcu := gin.H{
+		"Version":         "15.0.0",
+		"Name":            "Gotux (" + host + ")",
+		"DestinationType": "ImageUploader",
+		"RequestMethod":   "POST",
+		"RequestURL":      baseURL + "/api/compat/upload",
+		"Headers":         gin.H{"X-API-Key": secret},
+		"Body":            "MultipartFormData",
+		"FileFormName":    "file",
+		"URL":             "{response}",
+		"ErrorMessage":    "{response}",
+	}
+
+	data, err := json.MarshalIndent(sxcu, "", "  ")
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "生成配置失败"})
+		return
+	}
+
+	// 文件名中不能出现端口号的冒号（Windows 不允许）
+	fileName := "gotux-" + strings.NewReplacer(":", "_", "/", "_").Replace(host) + ".sxcu"
+	c.Header("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": fileName}))
+	c.Data(http.StatusOK, "application/json; charset=utf-8", data)
+}
+
+// compatFormFile 按常见字段名查找上传的文件
+func compatFormFile(form *multipart.Form) *multipart.FileHeader {
+	for _, field := range compatFileFields {
+		if files := form.File[field]; len(files) > 0 {
+			return files[0]
+		}
+	}
+	for _, files := range form.File {
+		if len(files) > 0 {
+			return files[0]
+		}
+	}
+	return nil
+}
+
+// compatThumbURL 配置了 thumb 衍生尺寸时返回缩略图地址，否则返回原图地址
+func compatThumbURL(imageURL string) string {
+	if _, ok := config.AppConfig.Upload.GetVariant("thumb"); ok {
+		return imageURL + "?variant=thumb"
+	}
+	return imageURL
+}
+
+var compatPlaceholder = regexp.MustCompile(`\{[a-z_]+\}`)
+
+// renderCompatTemplate 替换模板中的 {url} 等占位符，值按 JSON 字符串转义（不含引号），
+// 因此字符串占位符应写在引号内，数字占位符（如 {id}）可以直接使用
+func renderCompatTemplate(tpl string, values map[string]interface{}) string {
+	return compatPlaceholder.ReplaceAllStringFunc(tpl, func(placeholder string) string {
+		value, ok := values[strings.Trim(placeholder, "{}")]
+		if !ok {
+			return ""
+		}
+		encoded, _ := json.Marshal(fmt.Sprint(value))
+		return string(encoded[1 : len(encoded)-1])
+	})
+}
+
+// compatError 按请求的格式返回错误
+func compatError(c *gin.Context, asJSON bool, status int, message string) {
+	if asJSON {
+		c.JSON(status, gin.H{"success": false, "error": message})
+		return
+	}
+	c.String(status, message)
+}
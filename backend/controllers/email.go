@@ -0,0 +1,269 @@
+package controllers
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"gotux/config"
+	"gotux/mailer"
+	"gotux/models"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+const (
+	purposeResetPassword = "reset_password"
+	purposeVerifyEmail   = "verify_email"
+
+	resetTokenLifetime  = 30 * time.Minute
+	verifyTokenLifetime = 24 * time.Hour
+	// emailResendInterval 同一用户同类邮件的最短发送间隔，防止被用来轰炸邮箱
+	emailResendInterval = time.Minute
+)
+
+// errExternalPassword LDAP、OIDC 账户没有本地密码，不能修改或重置
+var errExternalPassword = errors.New("该账户通过单点登录或 LDAP 登录，请在身份提供方修改密码")
+
+// emailTokenClaims 邮件链接中的令牌。Fingerprint 绑定用户当前的密码、邮箱和状态，
+// 重置密码或验证邮箱后这些值会变化，令牌随之失效，因此每个链接只能使用一次
+type emailTokenClaims struct {
+	UserID      uint   `json:"user_id"`
+	Purpose     string `json:"purpose"`
+	Fingerprint string `json:"fp"`
+	jwt.RegisteredClaims
+}
+
+// emailSentAt 记录每个用户每类邮件的最近发送时间
+var emailSentAt sync.Map
+
+// ForgotPassword 发送重置密码邮件。无论邮箱是否注册都返回相同结果，避免泄露用户是否存在
+func ForgotPassword(c *gin.Context) {
+	var req struct {
+		Email string `json:"email" binding:"required,email"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请求参数错误"})
+		return
+	}
+	if !emailAvailable() {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "未配置邮件服务，请联系管理员重置密码"})
+		return
+	}
+
+	// LDAP、OIDC 账户的密码由外部身份管理，禁用的账户也不允许重置
+	if user, err := models.GetUserByEmail(req.Email); err == nil &&
+		!user.IsExternal() && (user.IsActive() || user.IsPending()) {
+		sendUserEmail(user, purposeResetPassword)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "如果该邮箱已注册，你将收到一封重置密码的邮件"})
+}
+
+// ResetPassword 使用邮件中的令牌设置新密码，并吊销该用户的所有登录会话
+func ResetPassword(c *gin.Context) {
+	var req struct {
+		Token    string `json:"token" binding:"required"`
+		Password string `json:"password" binding:"required,min=6"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请求参数错误"})
+		return
+	}
+
+	user, ok := loadEmailToken(c, req.Token, purposeResetPassword)
+	if !ok {
+		return
+	}
+	if user.IsExternal() {
+		c.JSON(http.StatusBadRequest, gin.H{"error": errExternalPassword.Error()})
+		return
+	}
+
+	ok, err := user.ResetPassword(user.Password, req.Password)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "重置密码失败"})
+		return
+	}
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "链接无效或已过期，请重新申请"})
+		return
+	}
+
+	if err := models.RevokeUserSessions(user.ID, ""); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "吊销会话失败"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "密码已重置，请使用新密码登录"})
+}
+
+// VerifyEmail 使用邮件中的令牌验证邮箱，等待验证的用户同时被激活
+func VerifyEmail(c *gin.Context) {
+	var req struct {
+		Token string `json:"token" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请求参数错误"})
+		return
+	}
+
+	user, ok := loadEmailToken(c, req.Token, purposeVerifyEmail)
+	if !ok {
+		return
+	}
+
+	wasPending := user.IsPending()
+	ok, err := user.VerifyEmail()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "验证失败"})
+		return
+	}
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "链接无效或已过期，请重新申请"})
+		return
+	}
+
+	message := "邮箱验证成功，请登录"
+	if !wasPending {
+		message = "邮箱验证成功"
+	}
+	c.JSON(http.StatusOK, gin.H{"message": message})
+}
+
+// ResendVerification 重新发送验证邮件，同样不泄露邮箱是否注册。
+// 等待验证的用户和更换邮箱后尚未验证的用户都可以申请
+func ResendVerification(c *gin.Context) {
+	var req struct {
+		Email string `json:"email" binding:"required,email"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请求参数错误"})
+		return
+	}
+	if !emailAvailable() {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "未配置邮件服务"})
+		return
+	}
+
+	if user, err := models.GetUserByEmail(req.Email); err == nil && needsEmailVerification(user) {
+		sendUserEmail(user, purposeVerifyEmail)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "如果该邮箱正在等待验证，你将收到一封新的验证邮件"})
+}
+
+// needsEmailVerification 用户是否还需要验证邮箱。LDAP、OIDC 账户的邮箱由身份提供方管理
+func needsEmailVerification(user *models.User) bool {
+	if user.IsPending() {
+		return true
+	}
+	return user.IsActive() && !user.IsEmailVerified() && !user.IsExternal()
+}
+
+// emailAvailable 发送邮件需要 SMTP 和站点地址。链接不按请求的 Host 生成，
+// 否则攻击者可以伪造 Host 让重置邮件指向自己的站点
+func emailAvailable() bool {
+	return mailer.Enabled() && config.AppConfig.Server.PublicURL != ""
+}
+
+// emailVerificationRequired 新注册用户是否需要先验证邮箱
+func emailVerificationRequired() bool {
+	return emailAvailable() && models.GetBoolSetting(models.SettingRequireEmailVerification, false)
+}
+
+// sendUserEmail 在后台发送重置密码或验证邮箱的邮件，请求不等待 SMTP，响应时间也不会暴露用户是否存在
+func sendUserEmail(user *models.User, purpose string) {
+	key := fmt.Sprintf("%s:%d", purpose, user.ID)
+	now := time.Now()
+	if last, ok := emailSentAt.Load(key); ok && now.Sub(last.(time.Time)) < emailResendInterval {
+		return
+	}
+	emailSentAt.Store(key, now)
+
+	lifetime, path, subject, body := resetTokenLifetime, "/reset-password",
+		"重置 Gotux 密码",
+		"你好 %s，\n\n我们收到了重置你的 Gotux 密码的请求。请在 %s内打开以下链接设置新密码：\n\n%s\n\n如果这不是你本人的操作，请忽略这封邮件，你的密码不会改变。\n"
+	if purpose == purposeVerifyEmail {
+		lifetime, path, subject, body = verifyTokenLifetime, "/verify-email",
+			"验证你的 Gotux 邮箱",
+			"你好 %s，\n\n感谢注册 Gotux。请在 %s内打开以下链接验证邮箱并激活账户：\n\n%s\n\n如果你没有注册过 Gotux，请忽略这封邮件。\n"
+		if !user.IsPending() {
+			body = "你好 %s，\n\n你的 Gotux 账户更换了邮箱。请在 %s内打开以下链接验证新邮箱：\n\n%s\n\n如果这不是你本人的操作，请忽略这封邮件。\n"
+		}
+	}
+
+	token, err := generateEmailToken(user, purpose, lifetime)
+	if err != nil {
+		log.Printf("生成邮件令牌失败: %v", err)
+		return
+	}
+	link := config.AppConfig.Server.PublicURL + path + "?" + url.Values{"token": {token}}.Encode()
+	validity := fmt.Sprintf(" %d 分钟", int(lifetime.Minutes()))
+	if lifetime >= time.Hour {
+		validity = fmt.Sprintf(" %d 小时", int(lifetime.Hours()))
+	}
+	text := fmt.Sprintf(body, user.Username, validity, link)
+
+	go func(to string) {
+		if err := mailer.Send(to, subject, text); err != nil {
+			log.Printf("发送邮件到 %s 失败: %v", to, err)
+		}
+	}(user.Email)
+}
+
+func generateEmailToken(user *models.User, purpose string, lifetime time.Duration) (string, error) {
+	now := time.Now()
+	claims := &emailTokenClaims{
+		UserID:      user.ID,
+		Purpose:     purpose,
+		Fingerprint: userFingerprint(user),
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        uuid.New().String(),
+			ExpiresAt: jwt.NewNumericDate(now.Add(lifetime)),
+			IssuedAt:  jwt.NewNumericDate(now),
+		},
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	return token.SignedString([]byte(config.AppConfig.JWT.Secret))
+}
+
+// loadEmailToken 校验令牌签名、用途、有效期和指纹，失败时直接写入响应
+func loadEmailToken(c *gin.Context, tokenString, purpose string) (*models.User, bool) {
+	claims := &emailTokenClaims{}
+	token, err := jwt.ParseWithClaims(strings.TrimSpace(tokenString), claims, func(token *jwt.Token) (interface{}, error) {
+		return []byte(config.AppConfig.JWT.Secret), nil
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}), jwt.WithExpirationRequired())
+	if err != nil || !token.Valid || claims.Purpose != purpose {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "链接无效或已过期，请重新申请"})
+		return nil, false
+	}
+
+	user, err := models.GetUserByID(claims.UserID)
+	if err != nil || !hmac.Equal([]byte(claims.Fingerprint), []byte(userFingerprint(user))) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "链接无效或已过期，请重新申请"})
+		return nil, false
+	}
+	if !user.IsActive() && !user.IsPending() {
+		c.JSON(http.StatusForbidden, gin.H{"error": "账户已被禁用"})
+		return nil, false
+	}
+	return user, true
+}
+
+// userFingerprint 用户密码哈希、邮箱和状态的 HMAC，不会泄露其中任何一项
+func userFingerprint(user *models.User) string {
+	mac := hmac.New(sha256.New, []byte(config.AppConfig.JWT.Secret))
+	mac.Write([]byte(user.Password + "\x00" + user.Email + "\x00" + user.Status))
+	return hex.EncodeToString(mac.Sum(nil)[:16])
+}
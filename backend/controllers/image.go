@@ -1,22 +1,21 @@
 package controllers
 
 import (
-	"crypto/md5"
-	"encoding/hex"
+	"errors"
 	"fmt"
 	"gotux/config"
 	"gotux/middleware"
 	"gotux/models"
+	"gotux/storage"
 	"io"
+	"mime"
 	"net/http"
-	"os"
 	"path/filepath"
 	"strconv"
-	"time"
+	"strings"
 
-	"github.com/disintegration/imaging"
 	"github.com/gin-gonic/gin"
-	"github.com/google/uuid"
+	"gorm.io/gorm"
 )
 
 // UploadImage 上传图片
@@ -73,91 +72,50 @@ func UploadImage(c *gin.Context) {
 		return
 	}
 
+	// 本次上传是否跳过水印（watermark=false）
+	skipWatermark := false
+	if values := form.Value["watermark"]; len(values) > 0 {
+		if enabled, err := strconv.ParseBool(values[0]); err == nil && !enabled {
+			skipWatermark = true
+		}
+	}
+
 	var uploadedImages []models.Image
 	var errors []string
+	policy := newUploadPolicy(user)
 
 	for _, file := range files {
-		// 检查文件大小
-		if file.Size > config.AppConfig.Upload.MaxSize {
-			errors = append(errors, fmt.Sprintf("%s: 文件大小超过限制", file.Filename))
-			continue
-		}
-
-		// 检查文件类型
-		if !isAllowedFileType(file.Header.Get("Content-Type")) {
-			errors = append(errors, fmt.Sprintf("%s: 不支持的文件类型", file.Filename))
+		// 检查文件大小（全局、管理员和个人设置的限制）
+		if err := policy.CheckSize(file.Size); err != nil {
+			errors = append(errors, fmt.Sprintf("%s: %v", file.Filename, err))
 			continue
 		}
 
-		// 打开文件
+		// 读取文件
 		src, err := file.Open()
 		if err != nil {
 			errors = append(errors, fmt.Sprintf("%s: 文件打开失败", file.Filename))
 			continue
 		}
-
-		// 计算文件哈希
-		hash := md5.New()
-		if _, err := io.Copy(hash, src); err != nil {
-			src.Close()
-			errors = append(errors, fmt.Sprintf("%s: 哈希计算失败", file.Filename))
-			continue
-		}
-		hashStr := hex.EncodeToString(hash.Sum(nil))
+		data, err := io.ReadAll(src)
 		src.Close()
-
-		// 检查是否已存在相同文件
-		existingImage, err := models.GetImageByHash(hashStr, userID)
-		if err == nil {
-			uploadedImages = append(uploadedImages, *existingImage)
-			continue
-		}
-
-		// 生成唯一文件名
-		ext := filepath.Ext(file.Filename)
-		newFileName := fmt.Sprintf("%s%s", uuid.New().String(), ext)
-
-		// 按日期组织文件夹
-		dateFolder := time.Now().Format("2006/01/02")
-		fullPath := filepath.Join(config.AppConfig.Upload.StoragePath, dateFolder)
-
-		// 创建目录
-		if err := os.MkdirAll(fullPath, 0755); err != nil {
-			errors = append(errors, fmt.Sprintf("%s: 创建目录失败", file.Filename))
-			continue
-		}
-
-		// 保存文件
-		filePath := filepath.Join(fullPath, newFileName)
-		if err := c.SaveUploadedFile(file, filePath); err != nil {
-			errors = append(errors, fmt.Sprintf("%s: 文件保存失败", file.Filename))
+		if err != nil {
+			errors = append(errors, fmt.Sprintf("%s: 文件读取失败", file.Filename))
 			continue
 		}
 
-		// 获取图片尺寸
-		width, height := getImageDimensions(filePath)
-
-		// 创建数据库记录
-		image := models.Image{
-			UserID:       userID,
-			FileName:     newFileName,
-			OriginalName: file.Filename,
-			FilePath:     filepath.Join(dateFolder, newFileName),
-			FileSize:     file.Size,
-			MimeType:     file.Header.Get("Content-Type"),
-			Width:        width,
-			Height:       height,
-			Hash:         hashStr,
-			IsPublic:     true,
-		}
-
-		if err := models.CreateImage(&image); err != nil {
-			os.Remove(filePath) // 删除已保存的文件
-			errors = append(errors, fmt.Sprintf("%s: 数据库保存失败", file.Filename))
+		// 处理并保存图片
+		image, err := saveUploadedImage(c.Request.Context(), user, uploadFile{
+			Name:          file.Filename,
+			Data:          data,
+			SkipWatermark: skipWatermark,
+		})
+		if err != nil {
+			errors = append(errors, fmt.Sprintf("%s: %v", file.Filename, err))
 			continue
 		}
 
-		uploadedImages = append(uploadedImages, image)
+		uploadedImages = append(uploadedImages, *image)
 	}
 
 	c.JSON(http.StatusOK, gin.H{
@@ -177,18 +135,29 @@ func GetImages(c *gin.Context) {
 
 	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
 	pageSize, _ := strconv.Atoi(c.DefaultQuery("page_size", "20"))
-	keyword := c.Query("keyword")
+	filter := models.ImageFilter{
+		UserID:  userID,
+		Keyword: c.Query("keyword"),
+	}
 
-	var images []models.Image
-	var total int64
-	var err error
+	// 按标签精确筛选
+	tags, anyTag, ok := tagFilter(c)
+	if !ok {
+		return
+	}
+	filter.Tags = tags
+	filter.AnyTag = anyTag
 
-	if keyword != "" {
-		images, total, err = models.SearchImages(userID, keyword, page, pageSize)
-	} else {
-		images, total, err = models.GetImagesByUserID(userID, page, pageSize)
+	// 按相册筛选，只能查看自己的相册
+	if albumID := c.Query("album_id"); albumID != "" {
+		album, ok := getOwnedAlbum(c, albumID)
+		if !ok {
+			return
+		}
+		filter.AlbumID = album.ID
 	}
 
+	images, total, err := models.GetImages(filter, page, pageSize)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取图片列表失败"})
 		return
@@ -264,9 +233,9 @@ func UpdateImage(c *gin.Context) {
 	}
 
 	var req struct {
-		Description string `json:"description"`
-		Tags        string `json:"tags"`
-		IsPublic    *bool  `json:"is_public"`
+		Description string  `json:"description"`
+		Tags        tagList `json:"tags"` // 字符串数组，或逗号分隔的字符串
+		IsPublic    *bool   `json:"is_public"`
 	}
 
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -274,13 +243,18 @@ func UpdateImage(c *gin.Context) {
 		return
 	}
 
+	tags, err := models.NormalizeTags(req.Tags)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
 	image.Description = req.Description
-	image.Tags = req.Tags
 	if req.IsPublic != nil {
 		image.IsPublic = *req.IsPublic
 	}
 
-	if err := image.Update(); err != nil {
+	if err := image.UpdateWithTags(tags); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "更新失败"})
 		return
 	}
@@ -321,8 +295,7 @@ func DeleteImage(c *gin.Context) {
 	}
 
 	// 删除文件
-	fullPath := filepath.Join(config.AppConfig.Upload.StoragePath, image.FilePath)
-	os.Remove(fullPath)
+	deleteImageFiles(c.Request.Context(), image)
 
 	// 删除数据库记录
 	if err := image.Delete(); err != nil {
@@ -366,8 +339,7 @@ func BatchDeleteImages(c *gin.Context) {
 		}
 
 		// 删除文件
-		fullPath := filepath.Join(config.AppConfig.Upload.StoragePath, image.FilePath)
-		os.Remove(fullPath)
+		deleteImageFiles(c.Request.Context(), image)
 
 		// 删除数据库记录
 		if err := image.Delete(); err == nil {
@@ -408,25 +380,40 @@ func GetImageLinks(c *gin.Context) {
 		return
 	}
 
-	// 构建完整URL - 使用自定义域名或默认域名
-	var baseURL string
+	c.JSON(http.StatusOK, gin.H{
+		"image": image,
+		"links": buildImageLinks(userBaseURL(c, user), image),
+	})
+}
+
+// userBaseURL 构建完整URL的前缀 - 使用自定义域名或默认域名
+func userBaseURL(c *gin.Context, user *models.User) string {
 	if user.CustomDomain != "" {
-		baseURL = user.CustomDomain
-	} else {
-		scheme := "http"
-		if c.Request.TLS != nil {
-			scheme = "https"
-		}
-		baseURL = fmt.Sprintf("%s://%s", scheme, c.Request.Host)
+		return strings.TrimSuffix(user.CustomDomain, "/")
 	}
-	
+	scheme := "http"
+	if c.Request.TLS != nil {
+		scheme = "https"
+	}
+	return fmt.Sprintf("%s://%s", scheme, c.Request.Host)
+}
+
+// buildImageLinks 生成各种格式的链接
+func buildImageLinks(baseURL string, image *models.Image) map[string]string {
 	// 使用UUID生成安全链接
 	imageURL := fmt.Sprintf("%s/i/%s", baseURL, image.UUID)
-	// 兼容旧的直接路径访问
-	directURL := fmt.Sprintf("%s/uploads/%s", baseURL, image.FilePath)
+	// 存储后端提供的直链（本地存储即旧的 /uploads 路径），未通过审核的图片没有直链
+	var directURL string
+	if image.IsApproved() {
+		directURL = storage.Default.URL(image.FilePath)
+	}
+	if directURL == "" {
+		directURL = imageURL
+	} else if strings.HasPrefix(directURL, "/") {
+		directURL = baseURL + directURL
+	}
 
-	// 生成各种格式的链接
-	links := map[string]string{
+	return map[string]string{
 		"url":                imageURL,
 		"direct_url":         directURL,
 		"html":               fmt.Sprintf(`<img src="%s" alt="%s" />`, imageURL, image.OriginalName),
@@ -434,11 +421,41 @@ func GetImageLinks(c *gin.Context) {
 		"bbcode":             fmt.Sprintf(`[img]%s[/img]`, imageURL),
 		"markdown_with_link": fmt.Sprintf(`[![%s](%s)](%s)`, image.OriginalName, imageURL, imageURL),
 	}
+}
 
-	c.JSON(http.StatusOK, gin.H{
-		"image": image,
-		"links": links,
-	})
+// DownloadOriginalImage 下载未加水印的原图（仅所有者）
+func DownloadOriginalImage(c *gin.Context) {
+	userID, exists := middleware.GetUserID(c)
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "未授权"})
+		return
+	}
+
+	imageID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的图片ID"})
+		return
+	}
+
+	image, err := models.GetImageByID(uint(imageID))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "图片不存在"})
+		return
+	}
+
+	if image.UserID != userID {
+		c.JSON(http.StatusForbidden, gin.H{"error": "没有权限访问该图片"})
+		return
+	}
+
+	// 没有单独保存原图时，存储的文件即原图
+	if image.OriginalPath == "" {
+		serveStoredImage(c, image)
+		return
+	}
+
+	c.Header("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": image.OriginalName}))
+	serveStoredObject(c, image.OriginalPath, "", image.OriginalName)
 }
 
 // GetImageByUUID 通过UUID获取图片信息
@@ -446,7 +463,7 @@ func GetImageByUUID(c *gin.Context) {
 	uuid := c.Param("uuid")
 	
 	image, err := models.GetImageByUUID(uuid)
-	if err != nil {
+	if err != nil || !canAccessUnreviewed(c, image) {
 		c.JSON(http.StatusNotFound, gin.H{"error": "图片不存在"})
 		return
 	}
@@ -473,13 +490,13 @@ func ServeImageByUUID(c *gin.Context) {
 	uuid := c.Param("uuid")
 	
 	image, err := models.GetImageByUUID(uuid)
-	if err != nil {
+	if err != nil || !canAccessUnreviewed(c, image) {
 		c.JSON(http.StatusNotFound, gin.H{"error": "图片不存在"})
 		return
 	}
 
-	// 检查图片是否公开或者是否为图片所有者
-	if !image.IsPublic {
+	// 检查图片是否公开、是否为图片所有者，或者是否附带了包含该图片的分享凭据
+	if !image.IsPublic && !canAccessShared(c, image) {
 		userID, exists := middleware.GetUserID(c)
 		if !exists || userID != image.UserID {
 			c.JSON(http.StatusForbidden, gin.H{"error": "无权访问此图片"})
@@ -487,6 +504,49 @@ func ServeImageByUUID(c *gin.Context) {
 		}
 	}
 
+	// 请求衍生尺寸（如 ?variant=thumb），不计入浏览量
+	if name := c.Query("variant"); name != "" {
+		variant, err := getOrCreateVariant(c.Request.Context(), image, name)
+		if err != nil {
+			if errors.Is(err, errUnknownVariant) {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "不支持的图片尺寸"})
+			} else {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "生成缩略图失败"})
+			}
+			return
+		}
+
+		c.Header("Cache-Control", "public, max-age=86400")
+		if variant == nil {
+			serveStoredImage(c, image)
+		} else {
+			serveStoredObject(c, variant.FilePath, variant.MimeType, image.OriginalName)
+		}
+		return
+	}
+
+	// 按需缩放或转换格式（如 ?w=800&fmt=webp 或 ?preset=small），不计入浏览量
+	transform, err := parseTransform(c, image)
+	if err != nil {
+		if errors.Is(err, errTransformNotAllowed) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "不允许的图片处理参数"})
+		} else {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "图片处理参数无效"})
+		}
+		return
+	}
+	if transform != nil {
+		cachePath, err := getOrCreateTransform(c.Request.Context(), image, *transform)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "图片处理失败"})
+			return
+		}
+
+		c.Header("Cache-Control", "public, max-age=86400")
+		c.File(cachePath)
+		return
+	}
+
 	// 增加浏览量
 	if image.Stats != nil {
 		image.Stats.ViewCount++
@@ -500,12 +560,20 @@ func ServeImageByUUID(c *gin.Context) {
 	}
 
 	// 提供文件
-	filePath := fmt.Sprintf("uploads/%s", image.FilePath)
-	c.File(filePath)
+	serveStoredImage(c, image)
 }
 
 // 辅助函数
 
+// canAccessUnreviewed 未通过审核的图片只有所有者和管理员能访问，对其他人表现为不存在
+func canAccessUnreviewed(c *gin.Context, image *models.Image) bool {
+	if image.IsApproved() {
+		return true
+	}
+	user, exists := middleware.GetUser(c)
+	return exists && (user.ID == image.UserID || user.IsAdmin())
+}
+
 func isAllowedFileType(mimeType string) bool {
 	for _, allowed := range config.AppConfig.Upload.AllowedTypes {
 		if allowed == mimeType {
@@ -515,13 +583,38 @@ func isAllowedFileType(mimeType string) bool {
 	return false
 }
 
-func getImageDimensions(filePath string) (int, int) {
-	img, err := imaging.Open(filePath)
+// serveStoredImage 从存储后端读取图片并写入响应
+func serveStoredImage(c *gin.Context, image *models.Image) {
+	serveStoredObject(c, image.FilePath, image.MimeType, image.OriginalName)
+}
+
+// serveStoredObject 从存储后端读取对象并写入响应，支持 Range 的后端走 http.ServeContent
+func serveStoredObject(c *gin.Context, key, mimeType, name string) {
+	rc, info, err := storage.Default.Get(c.Request.Context(), key)
 	if err != nil {
-		return 0, 0
+		if errors.Is(err, storage.ErrNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "图片文件不存在"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "读取图片失败"})
+		}
+		return
+	}
+	defer rc.Close()
+
+	contentType := mimeType
+	if contentType == "" {
+		contentType = info.ContentType
+	}
+	if contentType != "" {
+		c.Header("Content-Type", contentType)
 	}
-	bounds := img.Bounds()
-	return bounds.Dx(), bounds.Dy()
+
+	if rs, ok := rc.(io.ReadSeeker); ok {
+		http.ServeContent(c.Writer, c.Request, filepath.Base(name), info.ModTime, rs)
+		return
+	}
+
+	c.DataFromReader(http.StatusOK, info.Size, contentType, rc, nil)
 }
 
 // GetStats 获取统计信息
@@ -575,23 +668,46 @@ func GetStats(c *gin.Context) {
 	})
 }
 
-// GetRandomImage 获取随机图片信息(JSON)
-func GetRandomImage(c *gin.Context) {
-	query := models.DB.Where("is_public = ?", true)
+// randomImageQuery 按请求参数构建随机图片的候选范围，只包含公开且已通过审核的图片。
+// 参数无效时已写入错误响应并返回 false
+func randomImageQuery(c *gin.Context) (*gorm.DB, bool) {
+	query := models.DB.Where("is_public = ? AND review_status = ?", true, models.ReviewApproved)
 
 	// 支持按用户ID筛选
 	if userID := c.Query("user_id"); userID != "" {
 		query = query.Where("user_id = ?", userID)
 	}
 
-	// 支持按标签筛选
-	if tags := c.Query("tags"); tags != "" {
-		query = query.Where("tags LIKE ?", "%"+tags+"%")
+	// 支持按标签精确筛选，多个标签默认需要全部匹配，tag_mode=any 时匹配任意一个
+	tags, anyTag, ok := tagFilter(c)
+	if !ok {
+		return nil, false
+	}
+	if len(tags) > 0 {
+		query = query.Where("id IN (?)", models.ImageIDsWithTags(tags, !anyTag))
+	}
+
+	// 支持按相册筛选，只能使用公开的相册
+	if albumID := c.Query("album_id"); albumID != "" {
+		query = query.Where("id IN (?)", models.DB.Table("album_images").
+			Joins("JOIN albums ON albums.id = album_images.album_id").
+			Where("album_images.album_id = ? AND albums.is_public = ?", albumID, true).
+			Select("album_images.image_id"))
+	}
+
+	return query, true
+}
+
+// GetRandomImage 获取随机图片信息(JSON)
+func GetRandomImage(c *gin.Context) {
+	query, ok := randomImageQuery(c)
+	if !ok {
+		return
 	}
 
 	// 随机获取一张图片
 	var image models.Image
-	if err := query.Order("RANDOM()").First(&image).Error; err != nil {
+	if err := query.Preload("Tags").Order("RANDOM()").First(&image).Error; err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "没有找到符合条件的图片"})
 		return
 	}
@@ -604,16 +720,9 @@ func GetRandomImage(c *gin.Context) {
 
 // ServeRandomImage 直接返回随机图片文件(用于图床API)
 func ServeRandomImage(c *gin.Context) {
-	query := models.DB.Where("is_public = ?", true)
-
-	// 支持按用户ID筛选
-	if userID := c.Query("user_id"); userID != "" {
-		query = query.Where("user_id = ?", userID)
-	}
-
-	// 支持按标签筛选
-	if tags := c.Query("tags"); tags != "" {
-		query = query.Where("tags LIKE ?", "%"+tags+"%")
+	query, ok := randomImageQuery(c)
+	if !ok {
+		return
 	}
 
 	// 随机获取一张图片
@@ -626,37 +735,20 @@ func ServeRandomImage(c *gin.Context) {
 	// 增加浏览次数
 	models.IncrementViewCount(image.ID)
 
-	// 构建文件完整路径
-	fullPath := filepath.Join(".", image.FilePath)
-
-	// 检查文件是否存在
-	if _, err := os.Stat(fullPath); os.IsNotExist(err) {
-		c.JSON(http.StatusNotFound, gin.H{"error": "图片文件不存在"})
-		return
-	}
-
 	// 设置响应头
-	c.Header("Content-Type", image.MimeType)
 	c.Header("Cache-Control", "public, max-age=3600")
 	c.Header("X-Image-UUID", image.UUID)
 	c.Header("X-Image-ID", strconv.Itoa(int(image.ID)))
 
 	// 返回图片文件
-	c.File(fullPath)
+	serveStoredImage(c, &image)
 }
 
 // RedirectRandomImage 重定向到随机图片(用于外部引用)
 func RedirectRandomImage(c *gin.Context) {
-	query := models.DB.Where("is_public = ?", true)
-
-	// 支持按用户ID筛选
-	if userID := c.Query("user_id"); userID != "" {
-		query = query.Where("user_id = ?", userID)
-	}
-
-	// 支持按标签筛选
-	if tags := c.Query("tags"); tags != "" {
-		query = query.Where("tags LIKE ?", "%"+tags+"%")
+	query, ok := randomImageQuery(c)
+	if !ok {
+		return
 	}
 
 	// 随机获取一张图片
@@ -677,18 +769,7 @@ func RedirectRandomImage(c *gin.Context) {
 	}
 
 	// 构建图片URL
-	var baseURL string
-	if user.CustomDomain != "" {
-		baseURL = user.CustomDomain
-	} else {
-		scheme := "http"
-		if c.Request.TLS != nil {
-			scheme = "https"
-		}
-		baseURL = fmt.Sprintf("%s://%s", scheme, c.Request.Host)
-	}
-
-	imageURL := fmt.Sprintf("%s/i/%s", baseURL, image.UUID)
+	imageURL := fmt.Sprintf("%s/i/%s", userBaseURL(c, &user), image.UUID)
 
 	// 重定向到图片
 	c.Redirect(http.StatusFound, imageURL)
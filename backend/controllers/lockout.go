@@ -0,0 +1,109 @@
+package controllers
+
+import (
+	"fmt"
+	"gotux/loginguard"
+	"gotux/middleware"
+	"gotux/models"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// rejectThrottledLogin 用户名或 IP 处于锁定或退避中时返回 429，不再校验密码。
+// 返回 false 时已预留本次尝试，调用方需在校验结束后调用 loginguard.Release
+func rejectThrottledLogin(c *gin.Context, username string) bool {
+	result := loginguard.Check(username, c.ClientIP())
+	if result.RetryAfter <= 0 {
+		return false
+	}
+
+	seconds := int(math.Ceil(result.RetryAfter.Seconds()))
+	c.Header("Retry-After", strconv.Itoa(seconds))
+	message := fmt.Sprintf("登录尝试过于频繁，请 %d 秒后再试", seconds)
+	if result.Locked {
+		message = fmt.Sprintf("登录失败次数过多，已临时锁定，请 %d 分钟后再试", int(math.Ceil(result.RetryAfter.Minutes())))
+	}
+	c.JSON(http.StatusTooManyRequests, gin.H{"error": message, "retry_after": seconds})
+	return true
+}
+
+// GetLoginLockouts 获取当前被锁定的用户名和 IP(管理员)
+func GetLoginLockouts(c *gin.Context) {
+	throttles, err := models.GetLockedLoginThrottles()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取锁定列表失败"})
+		return
+	}
+	// 分享链接的密码锁定与登录无关，不在此列出
+	lockouts := make([]models.LoginThrottle, 0, len(throttles))
+	for _, throttle := range throttles {
+		if loginguard.Login.Owns(throttle.Key) {
+			lockouts = append(lockouts, throttle)
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{"lockouts": lockouts})
+}
+
+// UnlockLogin 解除用户名或 IP 的登录锁定(管理员)
+func UnlockLogin(c *gin.Context) {
+	admin, exists := middleware.GetUser(c)
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "未授权"})
+		return
+	}
+
+	var keys []string
+	if username := strings.TrimSpace(c.Query("username")); username != "" {
+		keys = append(keys, loginguard.UserKey(username))
+	}
+	if ip := strings.TrimSpace(c.Query("ip")); ip != "" {
+		keys = append(keys, loginguard.IPKey(ip))
+	}
+	if len(keys) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请指定 username 或 ip"})
+		return
+	}
+
+	unlocked := 0
+	for _, key := range keys {
+		found, err := loginguard.Unlock(key)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "解除锁定失败"})
+			return
+		}
+		if found {
+			unlocked++
+			models.CreateAuditLog(models.AuditLoginUnlocked, admin.ID, key, c.ClientIP(), "管理员 "+admin.Username+" 解除锁定")
+		}
+	}
+	if unlocked == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "没有找到对应的登录失败记录"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "已解除锁定"})
+}
+
+// GetAuditLogs 获取审计日志(管理员)，可按 action 过滤
+func GetAuditLogs(c *gin.Context) {
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	pageSize, _ := strconv.Atoi(c.DefaultQuery("page_size", "20"))
+
+	logs, total, err := models.GetAuditLogs(c.Query("action"), page, pageSize)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取审计日志失败"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"logs":      logs,
+		"total":     total,
+		"page":      page,
+		"page_size": pageSize,
+	})
+}
@@ -0,0 +1,327 @@
+package controllers
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"gotux/config"
+	"gotux/models"
+	"gotux/oidc"
+	"log"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// oidcAuthProvider 单点登录用户在 User.AuthProvider 中的取值
+const oidcAuthProvider = "oidc"
+
+const (
+	oidcLoginLifetime = 10 * time.Minute
+	oidcStateCookie   = "gotux_oidc_state"
+	oidcCookiePath    = "/api/auth/oidc"
+	// oidcResultPath 登录完成后跳转的前端页面，结果放在 URL 片段中，不会发送到服务器或写入日志
+	oidcResultPath = "/login"
+)
+
+var (
+	oidcProvider     *oidc.Provider
+	oidcProviderOnce sync.Once
+
+	// oidcLogins 进行中的登录请求，以 state 为键，回调时取出并删除
+	oidcLogins sync.Map
+
+	oidcUsernameInvalid = regexp.MustCompile(`[^a-zA-Z0-9_.-]+`)
+)
+
+type oidcLogin struct {
+	request   *oidc.AuthRequest
+	redirect  string // 登录后前端跳转的页面
+	expiresAt time.Time
+}
+
+// GetOIDCConfig 返回登录页需要的单点登录信息
+func GetOIDCConfig(c *gin.Context) {
+	cfg := config.AppConfig.OIDC
+	c.JSON(http.StatusOK, gin.H{
+		"enabled":     cfg.Enabled(),
+		"button_text": cfg.ButtonText,
+	})
+}
+
+// OIDCLogin 跳转到身份提供方登录（授权码 + PKCE）
+func OIDCLogin(c *gin.Context) {
+	provider := getOIDCProvider()
+	if provider == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "未启用单点登录"})
+		return
+	}
+
+	req, err := oidc.NewAuthRequest(oidcRedirectURL(c))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "创建登录请求失败"})
+		return
+	}
+
+	authURL, err := provider.AuthCodeURL(c.Request.Context(), req)
+	if err != nil {
+		log.Printf("OIDC 发现失败: %v", err)
+		c.JSON(http.StatusBadGateway, gin.H{"error": "无法连接单点登录服务"})
+		return
+	}
+
+	// 顺便清理过期的登录请求
+	now := time.Now()
+	oidcLogins.Range(func(key, value interface{}) bool {
+		if now.After(value.(*oidcLogin).expiresAt) {
+			oidcLogins.Delete(key)
+		}
+		return true
+	})
+
+	oidcLogins.Store(req.State, &oidcLogin{
+		request:   req,
+		redirect:  safeRedirectPath(c.Query("redirect")),
+		expiresAt: now.Add(oidcLoginLifetime),
+	})
+
+	// state 同时写入 Cookie，回调时校验是同一个浏览器发起的登录，防止登录 CSRF
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(oidcStateCookie, req.State, int(oidcLoginLifetime.Seconds()), oidcCookiePath, "", isSecureRequest(c), true)
+	c.Redirect(http.StatusFound, authURL)
+}
+
+// OIDCCallback 身份提供方登录后的回调：换取并校验 ID Token，创建或更新用户，再跳转回前端
+func OIDCCallback(c *gin.Context) {
+	provider := getOIDCProvider()
+	if provider == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "未启用单点登录"})
+		return
+	}
+
+	state := c.Query("state")
+	cookie, _ := c.Cookie(oidcStateCookie)
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(oidcStateCookie, "", -1, oidcCookiePath, "", isSecureRequest(c), true)
+
+	value, ok := oidcLogins.LoadAndDelete(state)
+	if state == "" || !ok || cookie != state {
+		oidcRedirectError(c, "登录请求无效或已过期，请重试")
+		return
+	}
+	login := value.(*oidcLogin)
+	if time.Now().After(login.expiresAt) {
+		oidcRedirectError(c, "登录请求无效或已过期，请重试")
+		return
+	}
+
+	if errCode := c.Query("error"); errCode != "" {
+		oidcRedirectError(c, "单点登录失败: "+errCode)
+		return
+	}
+
+	claims, err := provider.Exchange(c.Request.Context(), c.Query("code"), login.request)
+	if err != nil {
+		log.Printf("OIDC 登录失败: %v", err)
+		oidcRedirectError(c, "单点登录验证失败")
+		return
+	}
+
+	user, err := provisionOIDCUser(claims)
+	if err != nil {
+		oidcRedirectError(c, err.Error())
+		return
+	}
+	if !user.IsActive() {
+		oidcRedirectError(c, "账户已被禁用")
+		return
+	}
+
+	result := url.Values{}
+	if login.redirect != "" {
+		result.Set("redirect", login.redirect)
+	}
+
+	// 本地开启了两步验证的用户同样需要完成第二步
+	challenge, err := loginChallenge(user)
+	if err != nil {
+		oidcRedirectError(c, "生成令牌失败")
+		return
+	}
+	if challenge != nil {
+		for key, value := range challenge {
+			result.Set(key, fmt.Sprint(value))
+		}
+		c.Redirect(http.StatusFound, oidcResultPath+"#"+result.Encode())
+		return
+	}
+
+	resp, err := issueSession(c, user)
+	if err != nil {
+		oidcRedirectError(c, "生成令牌失败")
+		return
+	}
+	result.Set("token", resp.Token)
+	result.Set("refresh_token", resp.RefreshToken)
+	result.Set("expires_in", fmt.Sprint(resp.ExpiresIn))
+	c.Redirect(http.StatusFound, oidcResultPath+"#"+result.Encode())
+}
+
+// provisionOIDCUser 根据 ID Token 查找用户，首次登录时创建（JIT），每次登录同步邮箱和角色
+func provisionOIDCUser(claims jwt.MapClaims) (*models.User, error) {
+	cfg := config.AppConfig.OIDC
+	subject, _ := claims["sub"].(string)
+	email, _ := claims[cfg.EmailClaim].(string)
+	emailVerified, _ := claims["email_verified"].(bool)
+
+	role, mapped := mapOIDCRole(claims[cfg.RoleClaim])
+	if cfg.RequireRole && !mapped {
+		return nil, errors.New("你的账户没有访问权限，请联系管理员")
+	}
+
+	user, err := models.GetUserByExternalID(oidcAuthProvider, subject)
+	if err != nil && email != "" && emailVerified {
+		// 已验证邮箱与本地账户一致时关联到该账户。本地邮箱也必须验证过，
+		// 否则攻击者可以抢先用他人邮箱注册，在对方首次单点登录后继续持有该账户
+		if local, err := models.GetUserByEmail(email); err == nil && local.AuthProvider == "" && local.IsEmailVerified() {
+			if err := local.LinkExternal(oidcAuthProvider, subject); err != nil {
+				log.Printf("OIDC 关联用户失败: %v", err)
+				return nil, errors.New("关联用户失败")
+			}
+			user = local
+		}
+	}
+
+	if user == nil {
+		if !cfg.AutoCreate {
+			return nil, errors.New("账户不存在，请联系管理员开通")
+		}
+		username := oidcUsername(claims, email)
+		user, err = models.CreateExternalUser(oidcAuthProvider, subject, username, oidcEmail(email, subject), role)
+		if err != nil {
+			log.Printf("OIDC 创建用户失败: %v", err)
+			return nil, errors.New("创建用户失败")
+		}
+		return user, nil
+	}
+
+	// 同步邮箱和角色，配置了角色映射时以身份提供方为准
+	if email != "" && email != user.Email {
+		if other, err := models.GetUserByEmail(email); err != nil || other.ID == user.ID {
+			user.Email = email
+		}
+	}
+	if len(cfg.RoleMapping) > 0 {
+		user.Role = role
+	}
+	if err := user.Update(); err != nil {
+		return nil, errors.New("更新用户失败")
+	}
+	return user, nil
+}
+
+// mapOIDCRole 按配置的映射从声明值得到角色，声明可以是字符串或字符串数组，
+// 任一值映射到 admin 即为管理员；没有可映射的值时返回 user 和 false
+func mapOIDCRole(claim interface{}) (string, bool) {
+	var values []string
+	switch v := claim.(type) {
+	case string:
+		values = strings.Fields(strings.ReplaceAll(v, ",", " "))
+	case []interface{}:
+		for _, item := range v {
+			if s, ok := item.(string); ok {
+				values = append(values, s)
+			}
+		}
+	}
+
+	role, mapped := "user", false
+	for _, value := range values {
+		if r, ok := config.AppConfig.OIDC.RoleMapping[value]; ok {
+			mapped = true
+			if r == "admin" {
+				role = "admin"
+			}
+		}
+	}
+	return role, mapped
+}
+
+// oidcUsername 从声明生成不重复的用户名（3-20 个字符）
+func oidcUsername(claims jwt.MapClaims, email string) string {
+	name, _ := claims[config.AppConfig.OIDC.UsernameClaim].(string)
+	if name == "" {
+		name, _, _ = strings.Cut(email, "@")
+	}
+	name = strings.Trim(oidcUsernameInvalid.ReplaceAllString(name, ""), ".-")
+	if len(name) > 16 {
+		name = name[:16]
+	}
+	if len(name) < 3 {
+		name = "user"
+	}
+
+	candidate := name
+	for i := 2; ; i++ {
+		if _, err := models.GetUserByUsername(candidate); err != nil {
+			return candidate
+		}
+		candidate = fmt.Sprintf("%s-%d", name, i)
+	}
+}
+
+// oidcEmail 邮箱为空或已被其他账户使用时，生成一个不会冲突的占位邮箱
+func oidcEmail(email, subject string) string {
+	if email != "" {
+		if _, err := models.GetUserByEmail(email); err != nil {
+			return email
+		}
+	}
+	sum := sha256.Sum256([]byte(subject))
+	return hex.EncodeToString(sum[:8]) + "@oidc.invalid"
+}
+
+func getOIDCProvider() *oidc.Provider {
+	oidcProviderOnce.Do(func() {
+		cfg := config.AppConfig.OIDC
+		if cfg.Enabled() {
+			oidcProvider = oidc.NewProvider(cfg.Issuer, cfg.ClientID, cfg.ClientSecret, cfg.Scopes)
+		}
+	})
+	return oidcProvider
+}
+
+// oidcRedirectURL 未配置回调地址时按当前请求的地址生成
+func oidcRedirectURL(c *gin.Context) string {
+	if redirectURL := config.AppConfig.OIDC.RedirectURL; redirectURL != "" {
+		return redirectURL
+	}
+	scheme := "http"
+	if isSecureRequest(c) {
+		scheme = "https"
+	}
+	return scheme + "://" + c.Request.Host + oidcCookiePath + "/callback"
+}
+
+func oidcRedirectError(c *gin.Context, message string) {
+	c.Redirect(http.StatusFound, oidcResultPath+"#"+url.Values{"oidc_error": {message}}.Encode())
+}
+
+func isSecureRequest(c *gin.Context) bool {
+	return c.Request.TLS != nil || c.GetHeader("X-Forwarded-Proto") == "https"
+}
+
+// safeRedirectPath 只允许站内路径，防止开放重定向
+func safeRedirectPath(path string) string {
+	if !strings.HasPrefix(path, "/") || strings.HasPrefix(path, "//") || strings.HasPrefix(path, "/\\") {
+		return ""
+	}
+	return path
+}
@@ -0,0 +1,133 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"gotux/config"
+	"gotux/models"
+	"strings"
+)
+
+// uploadPolicy 用户的上传限制，按 全局配置 → 管理员为用户设置的上限 → 用户个人设置 逐层收紧
+type uploadPolicy struct {
+	user *models.User
+}
+
+func newUploadPolicy(user *models.User) uploadPolicy {
+	return uploadPolicy{user: user}
+}
+
+// MaxSize 实际生效的单文件大小上限
+func (p uploadPolicy) MaxSize() int64 {
+	size := config.AppConfig.Upload.MaxSize
+	if limit := p.user.LimitMaxImageSize; limit > 0 && limit < size {
+		size = limit
+	}
+	if pref := p.user.MaxImageSize; pref > 0 && pref < size {
+		size = pref
+	}
+	return size
+}
+
+// CheckSize 检查文件大小，超出时说明是哪一层的限制
+func (p uploadPolicy) CheckSize(size int64) error {
+	global := config.AppConfig.Upload.MaxSize
+	if size > global {
+		return fmt.Errorf("文件大小超过系统限制 %s", formatBytes(global))
+	}
+	if limit := p.user.LimitMaxImageSize; limit > 0 && size > limit {
+		return fmt.Errorf("文件大小超过管理员设置的限制 %s", formatBytes(limit))
+	}
+	if pref := p.user.MaxImageSize; pref > 0 && size > pref {
+		return fmt.Errorf("文件大小超过个人设置的限制 %s", formatBytes(pref))
+	}
+	return nil
+}
+
+// AllowedFormats 实际生效的可上传格式
+func (p uploadPolicy) AllowedFormats() []string {
+	var formats []string
+	for _, format := range imageFormats {
+		if p.CheckFormat(format) == nil {
+			formats = append(formats, format)
+		}
+	}
+	return formats
+}
+
+// CheckFormat 检查识别出的图片格式（jpeg、png、gif、webp），不允许时说明是哪一层的限制
+func (p uploadPolicy) CheckFormat(format string) error {
+	if !isAllowedFileType(formatMimeTypes[format]) {
+		return errors.New("不支持的文件类型")
+	}
+	if limit := p.user.LimitImageTypes; limit != "" && !containsFormat(limit, format) {
+		return fmt.Errorf("管理员未允许上传 %s 格式", format)
+	}
+	if pref := p.user.AllowedImageTypes; pref != "" && !containsFormat(pref, format) {
+		return fmt.Errorf("个人设置未允许上传 %s 格式", format)
+	}
+	return nil
+}
+
+// imageFormats 支持上传的图片格式
+var imageFormats = []string{"jpeg", "png", "gif", "webp"}
+
+var formatMimeTypes = map[string]string{
+	"jpeg": "image/jpeg",
+	"png":  "image/png",
+	"gif":  "image/gif",
+	"webp": "image/webp",
+}
+
+// parseImageTypes 解析 "jpg,png,webp" 格式的类型列表，返回规范化的格式名；
+// 包含未知类型时返回错误
+func parseImageTypes(value string) ([]string, error) {
+	var formats []string
+	for _, item := range strings.Split(value, ",") {
+		item = strings.ToLower(strings.TrimSpace(item))
+		if item == "" {
+			continue
+		}
+		format := normalizeImageType(item)
+		if format == "" {
+			return nil, fmt.Errorf("未知的图片类型 %s", item)
+		}
+		formats = append(formats, format)
+	}
+	return formats, nil
+}
+
+// normalizeImageType 将扩展名或 MIME 类型转换为格式名，无法识别时返回空字符串
+func normalizeImageType(value string) string {
+	value = strings.TrimPrefix(strings.TrimPrefix(value, "image/"), ".")
+	switch value {
+	case "jpg", "jpeg", "jpe", "jfif":
+		return "jpeg"
+	case "png", "gif", "webp":
+		return value
+	}
+	return ""
+}
+
+// containsFormat 类型列表中是否包含该格式（列表中的未知类型会被忽略）
+func containsFormat(list, format string) bool {
+	for _, item := range strings.Split(list, ",") {
+		if normalizeImageType(strings.ToLower(strings.TrimSpace(item))) == format {
+			return true
+		}
+	}
+	return false
+}
+
+// formatBytes 将字节数格式化为便于阅读的形式
+func formatBytes(size int64) string {
+	switch {
+	case size >= 1024*1024 && size%(1024*1024) == 0:
+		return fmt.Sprintf("%dMB", size/(1024*1024))
+	case size >= 1024*1024:
+		return fmt.Sprintf("%.1fMB", float64(size)/(1024*1024))
+	case size >= 1024:
+		return fmt.Sprintf("%dKB", size/1024)
+	}
+	return fmt.Sprintf("%dB", size)
+}
@@ -0,0 +1,187 @@
+package controllers
+
+import (
+	"errors"
+	"gotux/middleware"
+	"gotux/models"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetRegistrationConfig 返回注册页需要的注册模式
+func GetRegistrationConfig(c *gin.Context) {
+	mode := registrationMode()
+	resp := gin.H{
+		"mode":                       mode,
+		"invite_required":            mode == models.RegistrationInvite,
+		"require_email_verification": emailVerificationRequired(),
+	}
+	if mode == models.RegistrationDomain {
+		resp["domains"] = registrationDomains()
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+// checkRegistration 按注册模式检查是否允许注册，填写了邀请码时占用一次使用次数。
+// 不允许时写入错误响应并返回 false
+func checkRegistration(c *gin.Context, req *RegisterRequest) (*models.InviteCode, bool) {
+	mode := registrationMode()
+	if mode == models.RegistrationClosed {
+		c.JSON(http.StatusForbidden, gin.H{"error": "注册已关闭"})
+		return nil, false
+	}
+
+	if strings.TrimSpace(req.InviteCode) == "" {
+		switch mode {
+		case models.RegistrationInvite:
+			c.JSON(http.StatusForbidden, gin.H{"error": "需要邀请码才能注册"})
+			return nil, false
+		case models.RegistrationDomain:
+			// 不验证邮箱时任何人都可以填写白名单域名下不属于自己的邮箱
+			if !emailVerificationRequired() {
+				c.JSON(http.StatusForbidden, gin.H{"error": "邮箱验证不可用，暂时无法通过邮箱域名注册"})
+				return nil, false
+			}
+			if !emailDomainAllowed(req.Email) {
+				c.JSON(http.StatusForbidden, gin.H{"error": "该邮箱域名不允许注册"})
+				return nil, false
+			}
+		}
+		return nil, true
+	}
+
+	invite, err := models.UseInviteCode(req.InviteCode)
+	if err != nil {
+		if errors.Is(err, models.ErrInviteCodeInvalid) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "验证邀请码失败"})
+		}
+		return nil, false
+	}
+	return invite, true
+}
+
+func registrationMode() string {
+	switch mode := models.GetSetting(models.SettingRegistrationMode, models.RegistrationOpen); mode {
+	case models.RegistrationInvite, models.RegistrationDomain, models.RegistrationClosed:
+		return mode
+	}
+	return models.RegistrationOpen
+}
+
+func registrationDomains() []string {
+	var domains []string
+	for _, domain := range strings.Split(models.GetSetting(models.SettingRegistrationDomains, ""), ",") {
+		if domain = strings.ToLower(strings.TrimSpace(domain)); domain != "" {
+			domains = append(domains, domain)
+		}
+	}
+	return domains
+}
+
+// emailDomainAllowed 邮箱域名是否在白名单中（完全匹配，不含子域名）
+func emailDomainAllowed(email string) bool {
+	i := strings.LastIndex(email, "@")
+	if i < 0 {
+		return false
+	}
+	domain := strings.ToLower(email[i+1:])
+	for _, allowed := range registrationDomains() {
+		if domain == allowed {
+			return true
+		}
+	}
+	return false
+}
+
+// GetInviteCodes 获取邀请码列表(管理员)
+func GetInviteCodes(c *gin.Context) {
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	pageSize, _ := strconv.Atoi(c.DefaultQuery("page_size", "20"))
+
+	invites, total, err := models.GetInviteCodes(page, pageSize)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取邀请码列表失败"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"invites":   invites,
+		"total":     total,
+		"page":      page,
+		"page_size": pageSize,
+	})
+}
+
+// CreateInviteCode 生成邀请码(管理员)
+func CreateInviteCode(c *gin.Context) {
+	user, exists := middleware.GetUser(c)
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "未授权"})
+		return
+	}
+
+	var req struct {
+		Code           string `json:"code" binding:"omitempty,min=4,max=32,alphanum"` // 为空时随机生成
+		Note           string `json:"note" binding:"max=255"`
+		MaxUses        *int   `json:"max_uses" binding:"omitempty,min=0,max=100000"` // 默认 1，0 表示不限次数
+		ExpiresInHours int    `json:"expires_in_hours" binding:"min=0,max=87600"`    // 0 表示永不过期
+		Role           string `json:"role" binding:"omitempty,oneof=user admin"`
+		StorageQuota   *int64 `json:"storage_quota" binding:"omitempty,min=0"` // 为空使用默认配额，0 表示无限制
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请求参数错误"})
+		return
+	}
+
+	invite := &models.InviteCode{
+		Code:         req.Code,
+		Note:         strings.TrimSpace(req.Note),
+		CreatedBy:    user.ID,
+		MaxUses:      1,
+		Role:         "user",
+		StorageQuota: req.StorageQuota,
+	}
+	if req.MaxUses != nil {
+		invite.MaxUses = *req.MaxUses
+	}
+	if req.Role != "" {
+		invite.Role = req.Role
+	}
+	if req.ExpiresInHours > 0 {
+		t := time.Now().Add(time.Duration(req.ExpiresInHours) * time.Hour)
+		invite.ExpiresAt = &t
+	}
+
+	if err := models.CreateInviteCode(invite); err != nil {
+		c.JSON(http.StatusConflict, gin.H{"error": "创建邀请码失败，邀请码可能已存在"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"message": "创建成功",
+		"invite":  invite,
+	})
+}
+
+// DeleteInviteCode 删除邀请码(管理员)
+func DeleteInviteCode(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的邀请码ID"})
+		return
+	}
+
+	if err := models.DeleteInviteCode(uint(id)); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "邀请码不存在"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "删除成功"})
+}
@@ -0,0 +1,217 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"gotux/config"
+	"gotux/imageproc"
+	"gotux/middleware"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"path"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// maxRemoteRedirects 从 URL 上传时最多跟随的重定向次数
+const maxRemoteRedirects = 5
+
+var (
+	errRemoteForbidden = errors.New("不允许访问内网或保留地址")
+	errRemoteScheme    = errors.New("只支持 http 和 https 地址")
+	errRemoteRedirects = errors.New("重定向次数过多")
+)
+
+// UploadImageFromURL 从远程 URL 下载图片并保存
+func UploadImageFromURL(c *gin.Context) {
+	user, exists := middleware.GetUser(c)
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "未授权"})
+		return
+	}
+
+	var req struct {
+		URL       string `json:"url" binding:"required"`
+		Watermark *bool  `json:"watermark"` // false 表示本次上传不添加水印
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请求参数错误"})
+		return
+	}
+
+	target, err := url.Parse(req.URL)
+	if err != nil || target.Host == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的URL"})
+		return
+	}
+	if target.Scheme != "http" && target.Scheme != "https" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": errRemoteScheme.Error()})
+		return
+	}
+
+	policy := newUploadPolicy(user)
+	data, name, err := fetchRemoteImage(c.Request.Context(), target, policy)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	image, err := saveUploadedImage(c.Request.Context(), user, uploadFile{
+		Name:          name,
+		Data:          data,
+		SkipWatermark: req.Watermark != nil && !*req.Watermark,
+	})
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "上传成功",
+		"image":   image,
+	})
+}
+
+// fetchRemoteImage 下载远程图片，返回数据和用作原始文件名的名称
+func fetchRemoteImage(ctx context.Context, target *url.URL, policy uploadPolicy) ([]byte, string, error) {
+	timeout := time.Duration(config.AppConfig.Upload.RemoteTimeout) * time.Second
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target.String(), nil)
+	if err != nil {
+		return nil, "", errors.New("无效的URL")
+	}
+	req.Header.Set("Accept", "image/jpeg,image/png,image/gif,image/webp,image/*;q=0.8")
+	req.Header.Set("User-Agent", "Gotux/1.0")
+
+	resp, err := remoteClient.Do(req)
+	if err != nil {
+		// 错误被包装在 url.Error / net.OpError 中，取出可以展示给用户的部分
+		for _, known := range []error{errRemoteForbidden, errRemoteScheme, errRemoteRedirects} {
+			if errors.Is(err, known) {
+				return nil, "", known
+			}
+		}
+		if errors.Is(err, context.DeadlineExceeded) {
+			return nil, "", errors.New("下载超时")
+		}
+		return nil, "", errors.New("下载失败")
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, "", fmt.Errorf("远程服务器返回 %d", resp.StatusCode)
+	}
+
+	// 先按 Content-Length 拒绝过大的文件，再限制实际读取的字节数
+	if resp.ContentLength > 0 {
+		if err := policy.CheckSize(resp.ContentLength); err != nil {
+			return nil, "", err
+		}
+	}
+	maxSize := policy.MaxSize()
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxSize+1))
+	if err != nil {
+		if errors.Is(err, context.DeadlineExceeded) {
+			return nil, "", errors.New("下载超时")
+		}
+		return nil, "", errors.New("下载失败")
+	}
+	if err := policy.CheckSize(int64(len(data))); err != nil {
+		return nil, "", err
+	}
+
+	return data, remoteFileName(resp, data), nil
+}
+
+// remoteFileName 优先使用 Content-Disposition 中的文件名，否则使用最终 URL 的文件名；
+// 扩展名按文件内容修正，因为很多图床会以 .jpg 地址返回 WebP 等其他格式
+func remoteFileName(resp *http.Response, data []byte) string {
+	name := path.Base(resp.Request.URL.Path)
+	if _, params, err := mime.ParseMediaType(resp.Header.Get("Content-Disposition")); err == nil && params["filename"] != "" {
+		name = path.Base(params["filename"])
+	}
+	if name == "/" || name == "." {
+		name = resp.Request.URL.Hostname()
+	}
+	return strings.TrimSuffix(name, path.Ext(name)) + imageproc.SniffExt(data)
+}
+
+// remoteClient 用于从 URL 上传的 HTTP 客户端：不使用代理，在建立连接时检查实际连接的 IP，
+// 因此重定向和 DNS 重新绑定也无法访问内网地址
+var remoteClient = &http.Client{
+	Transport: &http.Transport{
+		Proxy: nil,
+		DialContext: (&net.Dialer{
+			Timeout: 10 * time.Second,
+			Control: checkRemoteAddress,
+		}).DialContext,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ResponseHeaderTimeout: 10 * time.Second,
+		MaxIdleConns:          10,
+		IdleConnTimeout:       30 * time.Second,
+	},
+	CheckRedirect: func(req *http.Request, via []*http.Request) error {
+		if len(via) > maxRemoteRedirects {
+			return errRemoteRedirects
+		}
+		if req.URL.Scheme != "http" && req.URL.Scheme != "https" {
+			return errRemoteScheme
+		}
+		return nil
+	},
+}
+
+// checkRemoteAddress 在连接前检查目标 IP，拒绝回环、内网、链路本地等地址
+func checkRemoteAddress(network, address string, _ syscall.RawConn) error {
+	if config.AppConfig.Upload.RemoteAllowPrivate {
+		return nil
+	}
+
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return errRemoteForbidden
+	}
+	addr, err := netip.ParseAddr(host)
+	if err != nil || !isPublicAddress(addr) {
+		return errRemoteForbidden
+	}
+	return nil
+}
+
+// reservedPrefixes 除标准库判断之外需要拒绝的保留地址段
+var reservedPrefixes = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),      // 本网络
+	netip.MustParsePrefix("100.64.0.0/10"),  // 运营商级 NAT
+	netip.MustParsePrefix("192.0.0.0/24"),   // IETF 协议分配
+	netip.MustParsePrefix("198.18.0.0/15"),  // 基准测试
+	netip.MustParsePrefix("240.0.0.0/4"),    // 保留及广播地址
+	netip.MustParsePrefix("64:ff9b::/96"),   // NAT64，可映射到内网 IPv4
+	netip.MustParsePrefix("64:ff9b:1::/48"), // 本地 NAT64
+	netip.MustParsePrefix("2002::/16"),      // 6to4，可映射到内网 IPv4
+}
+
+func isPublicAddress(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	if !addr.IsValid() || addr.IsLoopback() || addr.IsPrivate() || addr.IsUnspecified() ||
+		addr.IsLinkLocalUnicast() || addr.IsLinkLocalMulticast() || addr.IsInterfaceLocalMulticast() ||
+		addr.IsMulticast() {
+		return false
+	}
+	for _, prefix := range reservedPrefixes {
+		if prefix.Contains(addr) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,211 @@
+package controllers
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"gotux/config"
+	"gotux/models"
+	"image"
+	"image/color"
+	"image/png"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"net/url"
+	"strings"
+	"syscall"
+	"testing"
+)
+
+// setupRemoteConfig 设置从 URL 上传用到的配置，测试结束后恢复
+func setupRemoteConfig(t *testing.T, allowPrivate bool) {
+	t.Helper()
+	saved := config.AppConfig
+	config.AppConfig = &config.Config{
+		Upload: config.UploadConfig{
+			MaxSize:            1024,
+			AllowedTypes:       []string{"image/jpeg", "image/png", "image/gif", "image/webp"},
+			RemoteTimeout:      5,
+			RemoteAllowPrivate: allowPrivate,
+		},
+	}
+	t.Cleanup(func() { config.AppConfig = saved })
+}
+
+// allowDialTo 只放行到 srv 的连接，其他地址仍由 checkRemoteAddress 检查，
+// 用来模拟一个公网服务器把请求重定向到内网
+func allowDialTo(t *testing.T, srv *httptest.Server) {
+	t.Helper()
+	transport := remoteClient.Transport.(*http.Transport)
+	saved := transport.DialContext
+	allowed := srv.Listener.Addr().String()
+	transport.DialContext = (&net.Dialer{
+		Control: func(network, address string, c syscall.RawConn) error {
+			if address == allowed {
+				return nil
+			}
+			return checkRemoteAddress(network, address, c)
+		},
+	}).DialContext
+	t.Cleanup(func() {
+		transport.DialContext = saved
+		transport.CloseIdleConnections()
+	})
+}
+
+func testPNG(t *testing.T) []byte {
+	t.Helper()
+	img := image.NewNRGBA(image.Rect(0, 0, 4, 3))
+	img.Set(1, 1, color.NRGBA{R: 255, A: 255})
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatalf("png.Encode: %v", err)
+	}
+	return buf.Bytes()
+}
+
+func fetchTestURL(t *testing.T, rawURL string) ([]byte, string, error) {
+	t.Helper()
+	target, err := url.Parse(rawURL)
+	if err != nil {
+		t.Fatalf("url.Parse(%q): %v", rawURL, err)
+	}
+	return fetchRemoteImage(context.Background(), target, newUploadPolicy(&models.User{}))
+}
+
+func TestFetchRemoteImageBlocksLoopback(t *testing.T) {
+	setupRemoteConfig(t, false)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Errorf("loopback server received a request for %s", r.URL)
+	}))
+	defer srv.Close()
+
+	if _, _, err := fetchTestURL(t, srv.URL+"/a.png"); !errors.Is(err, errRemoteForbidden) {
+		t.Fatalf("fetch loopback error = %v, want %v", err, errRemoteForbidden)
+	}
+}
+
+func TestFetchRemoteImageBlocksRedirectToPrivate(t *testing.T) {
+	setupRemoteConfig(t, false)
+	internal := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Errorf("internal server received a request for %s", r.URL)
+	}))
+	defer internal.Close()
+
+	for _, location := range []string{
+		internal.URL + "/secret.png",
+		"http://169.254.169.254/latest/meta-data/",
+	} {
+		srv := httptest.NewServer(http.RedirectHandler(location, http.StatusFound))
+		allowDialTo(t, srv)
+
+		if _, _, err := fetchTestURL(t, srv.URL+"/a.png"); !errors.Is(err, errRemoteForbidden) {
+			t.Errorf("redirect to %s: error = %v, want %v", location, err, errRemoteForbidden)
+		}
+		srv.Close()
+	}
+}
+
+func TestFetchRemoteImageRejectsLargeBody(t *testing.T) {
+	setupRemoteConfig(t, true)
+	body := bytes.Repeat([]byte{0}, 2048)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/chunked.png" {
+			// 不声明 Content-Length，只能靠读取时的限制拦截
+			w.Write(body[:1000])
+			w.(http.Flusher).Flush()
+			w.Write(body[1000:])
+			return
+		}
+		w.Header().Set("Content-Length", "2048")
+		w.Write(body)
+	}))
+	defer srv.Close()
+
+	for _, path := range []string{"/sized.png", "/chunked.png"} {
+		_, _, err := fetchTestURL(t, srv.URL+path)
+		if err == nil || !strings.Contains(err.Error(), "文件大小超过系统限制") {
+			t.Errorf("fetch %s error = %v, want size limit error", path, err)
+		}
+	}
+}
+
+func TestFetchRemoteImageRejectsNonImage(t *testing.T) {
+	setupRemoteConfig(t, true)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "image/png")
+		w.Write([]byte("<html><body>not an image</body></html>"))
+	}))
+	defer srv.Close()
+
+	data, name, err := fetchTestURL(t, srv.URL+"/fake.png")
+	if err != nil {
+		t.Fatalf("fetch: %v", err)
+	}
+	// 与 saveUploadedImage 一样，按内容识别格式，不信任 Content-Type
+	_, err = detectImage(uploadFile{Name: name, Data: data}, newUploadPolicy(&models.User{}))
+	if err == nil || err.Error() != "不支持的文件类型" {
+		t.Fatalf("detectImage error = %v, want 不支持的文件类型", err)
+	}
+}
+
+func TestFetchRemoteImageAllowPrivate(t *testing.T) {
+	setupRemoteConfig(t, true)
+	want := testPNG(t)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/final/photo.jpg" {
+			http.Redirect(w, r, "/final/photo.jpg", http.StatusFound)
+			return
+		}
+		w.Header().Set("Content-Type", "image/jpeg")
+		w.Write(want)
+	}))
+	defer srv.Close()
+
+	data, name, err := fetchTestURL(t, srv.URL+"/start")
+	if err != nil {
+		t.Fatalf("fetch: %v", err)
+	}
+	if !bytes.Equal(data, want) {
+		t.Fatalf("fetched %d bytes, want %d", len(data), len(want))
+	}
+	// 扩展名按内容修正
+	if name != "photo.png" {
+		t.Fatalf("name = %q, want photo.png", name)
+	}
+	detected, err := detectImage(uploadFile{Name: name, Data: data}, newUploadPolicy(&models.User{}))
+	if err != nil {
+		t.Fatalf("detectImage: %v", err)
+	}
+	if detected.Format != "png" {
+		t.Fatalf("format = %q, want png", detected.Format)
+	}
+}
+
+func TestIsPublicAddress(t *testing.T) {
+	for addr, want := range map[string]bool{
+		"93.184.216.34":      true,
+		"2606:2800:220:1::":  true,
+		"127.0.0.1":          false,
+		"10.1.2.3":           false,
+		"172.16.0.1":         false,
+		"192.168.1.1":        false,
+		"169.254.169.254":    false,
+		"100.64.0.1":         false,
+		"0.0.0.0":            false,
+		"::1":                false,
+		"fe80::1":            false,
+		"fd00::1":            false,
+		"::ffff:127.0.0.1":   false,
+		"64:ff9b::a9fe:a9fe": false,
+		"2002:a9fe:a9fe::1":  false,
+		"255.255.255.255":    false,
+		"224.0.0.1":          false,
+	} {
+		if got := isPublicAddress(netip.MustParseAddr(addr)); got != want {
+			t.Errorf("isPublicAddress(%s) = %v, want %v", addr, got, want)
+		}
+	}
+}
@@ -0,0 +1,161 @@
+package controllers
+
+import (
+	"context"
+	"gotux/middleware"
+	"gotux/models"
+	"gotux/storage"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// reviewRequest 批量审核请求
+type reviewRequest struct {
+	ImageIDs []uint `json:"image_ids" binding:"required,min=1,max=100"`
+	Reason   string `json:"reason" binding:"max=500"`
+}
+
+// GetReviewQueue 按审核状态获取图片，默认返回待审核的图片(管理员)
+func GetReviewQueue(c *gin.Context) {
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	pageSize, _ := strconv.Atoi(c.DefaultQuery("page_size", "20"))
+
+	status := c.DefaultQuery("status", models.ReviewPending)
+	switch status {
+	case models.ReviewPending, models.ReviewApproved, models.ReviewRejected:
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的审核状态"})
+		return
+	}
+
+	images, total, err := models.GetImagesByReviewStatus(status, page, pageSize)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取审核列表失败"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"images":    images,
+		"total":     total,
+		"page":      page,
+		"page_size": pageSize,
+	})
+}
+
+// ApproveImages 批量通过图片审核(管理员)
+func ApproveImages(c *gin.Context) {
+	reviewImages(c, models.ReviewApproved)
+}
+
+// RejectImages 批量拒绝图片，被拒绝的图片不能公开访问，所有者仍可查看和删除(管理员)
+func RejectImages(c *gin.Context) {
+	reviewImages(c, models.ReviewRejected)
+}
+
+func reviewImages(c *gin.Context, status string) {
+	admin, exists := middleware.GetUser(c)
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "未授权"})
+		return
+	}
+
+	var req reviewRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请求参数错误"})
+		return
+	}
+	// 通过审核时不保留原因，避免再次展示之前的拒绝原因
+	if status == models.ReviewApproved {
+		req.Reason = ""
+	}
+
+	images, err := models.GetImagesByIDs(req.ImageIDs)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "审核失败"})
+		return
+	}
+
+	count := 0
+	for i := range images {
+		if err := reviewImage(c.Request.Context(), &images[i], status, admin.ID, req.Reason); err != nil {
+			log.Printf("审核图片 %d 失败: %v", images[i].ID, err)
+			continue
+		}
+		count++
+	}
+	if count == 0 && len(images) > 0 {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "审核失败"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "审核完成",
+		"count":   count,
+	})
+}
+
+// reviewImage 保存审核结果。通过审核的图片文件移出 review/ 前缀，可以通过 /uploads 直接访问；
+// 其他状态的图片文件移入该前缀。先复制文件再更新记录，成功后才删除旧文件
+func reviewImage(ctx context.Context, image *models.Image, status string, reviewerID uint, reason string) error {
+	approved := status == models.ReviewApproved
+	var moved []string // 新复制的文件，更新记录失败时删除
+	var stale []string // 旧文件，更新记录成功后删除
+	move := func(key *string) error {
+		to := reviewStorageKey(*key, approved)
+		if to == *key {
+			return nil
+		}
+		if err := copyObject(ctx, *key, to); err != nil {
+			return err
+		}
+		moved = append(moved, to)
+		stale = append(stale, *key)
+		*key = to
+		return nil
+	}
+
+	err := move(&image.FilePath)
+	for i := range image.Variants {
+		if err != nil {
+			break
+		}
+		err = move(&image.Variants[i].FilePath)
+	}
+	if err == nil {
+		err = image.Review(status, reviewerID, reason)
+	}
+	if err != nil {
+		for _, key := range moved {
+			storage.Default.Delete(ctx, key)
+		}
+		return err
+	}
+
+	for _, key := range stale {
+		storage.Default.Delete(ctx, key)
+	}
+	return nil
+}
+
+// reviewStorageKey 返回文件按审核状态应保存的存储路径，未通过审核的加上 review/ 前缀
+func reviewStorageKey(key string, approved bool) string {
+	key = strings.TrimPrefix(key, models.ReviewKeyPrefix)
+	if approved {
+		return key
+	}
+	return models.ReviewKeyPrefix + key
+}
+
+// copyObject 在存储后端中复制文件
+func copyObject(ctx context.Context, from, to string) error {
+	rc, info, err := storage.Default.Get(ctx, from)
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+	return storage.Default.Put(ctx, to, rc, info.Size, info.ContentType)
+}
@@ -0,0 +1,146 @@
+package controllers
+
+import (
+	"errors"
+	"gotux/middleware"
+	"gotux/models"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// SearchImages 搜索当前用户的图片，支持前缀、短语搜索以及时间、类型、大小和尺寸筛选。
+// 使用 FTS5 时结果按相关度排序并带有匹配摘要
+func SearchImages(c *gin.Context) {
+	userID, exists := middleware.GetUserID(c)
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "未授权"})
+		return
+	}
+
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	pageSize, _ := strconv.Atoi(c.DefaultQuery("page_size", "20"))
+	if page < 1 {
+		page = 1
+	}
+	if pageSize <= 0 || pageSize > 100 {
+		pageSize = 20
+	}
+
+	filter, err := searchFilter(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "搜索条件无效: " + err.Error()})
+		return
+	}
+	filter.UserID = userID
+
+	tags, anyTag, ok := tagFilter(c)
+	if !ok {
+		return
+	}
+	filter.Tags = tags
+	filter.AnyTag = anyTag
+
+	results, total, err := models.SearchImages(filter, page, pageSize)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "搜索图片失败"})
+		return
+	}
+
+	mode := "like"
+	if models.SearchEnabled() {
+		mode = "fts"
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"images":    results,
+		"total":     total,
+		"page":      page,
+		"page_size": pageSize,
+		"mode":      mode,
+	})
+}
+
+// searchFilter 解析 q、from、to、mime 以及大小和尺寸范围参数
+func searchFilter(c *gin.Context) (models.SearchFilter, error) {
+	filter := models.SearchFilter{Query: c.Query("q")}
+
+	var err error
+	if filter.From, err = searchDate(c.Query("from"), false); err != nil {
+		return filter, errors.New("from 应为 YYYY-MM-DD 或 RFC3339 格式")
+	}
+	if filter.To, err = searchDate(c.Query("to"), true); err != nil {
+		return filter, errors.New("to 应为 YYYY-MM-DD 或 RFC3339 格式")
+	}
+
+	for _, mime := range strings.Split(c.Query("mime"), ",") {
+		mime = strings.ToLower(strings.TrimSpace(mime))
+		if mime == "" {
+			continue
+		}
+		// 允许简写为 jpg、png 等
+		if !strings.Contains(mime, "/") {
+			if mime == "jpg" {
+				mime = "jpeg"
+			}
+			mime = "image/" + mime
+		}
+		filter.MimeTypes = append(filter.MimeTypes, mime)
+	}
+
+	ranges := []struct {
+		name  string
+		value *int64
+	}{
+		{"min_size", &filter.MinSize},
+		{"max_size", &filter.MaxSize},
+	}
+	for _, r := range ranges {
+		if v := c.Query(r.name); v != "" {
+			if *r.value, err = strconv.ParseInt(v, 10, 64); err != nil || *r.value < 0 {
+				return filter, errors.New(r.name + " 应为非负整数")
+			}
+		}
+	}
+
+	dimensions := []struct {
+		name  string
+		value *int
+	}{
+		{"min_width", &filter.MinWidth},
+		{"max_width", &filter.MaxWidth},
+		{"min_height", &filter.MinHeight},
+		{"max_height", &filter.MaxHeight},
+	}
+	for _, d := range dimensions {
+		if v := c.Query(d.name); v != "" {
+			if *d.value, err = strconv.Atoi(v); err != nil || *d.value < 0 {
+				return filter, errors.New(d.name + " 应为非负整数")
+			}
+		}
+	}
+
+	return filter, nil
+}
+
+// searchDate 解析日期参数，只有日期时按服务器本地时区处理，作为结束时间时包含当天
+func searchDate(value string, end bool) (*time.Time, error) {
+	if value == "" {
+		return nil, nil
+	}
+	// 数据库中的时间按本地时区保存为字符串，需转换后再比较
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		t = t.Local()
+		return &t, nil
+	}
+	t, err := time.ParseInLocation("2006-01-02", value, time.Local)
+	if err != nil {
+		return nil, err
+	}
+	if end {
+		t = t.AddDate(0, 0, 1)
+	}
+	return &t, nil
+}
@@ -0,0 +1,183 @@
+package controllers
+
+import (
+	"errors"
+	"gotux/config"
+	"gotux/middleware"
+	"gotux/models"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RefreshToken 用刷新令牌换取新的访问令牌，刷新令牌同时轮换，旧令牌随即作废
+func RefreshToken(c *gin.Context) {
+	var req struct {
+		RefreshToken string `json:"refresh_token" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请求参数错误"})
+		return
+	}
+
+	session, secret, err := models.RotateSession(req.RefreshToken, c.ClientIP(), sessionExpiresAt())
+	if err != nil {
+		if errors.Is(err, models.ErrRefreshTokenReused) {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "刷新令牌已被使用，会话已吊销，请重新登录"})
+			return
+		}
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "会话已失效，请重新登录"})
+		return
+	}
+
+	user, err := models.GetUserByID(session.UserID)
+	if err != nil {
+		session.Revoke()
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "用户不存在"})
+		return
+	}
+	if !user.IsActive() {
+		session.Revoke()
+		c.JSON(http.StatusForbidden, gin.H{"error": "账户已被禁用"})
+		return
+	}
+
+	token, err := generateToken(user, session.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "生成令牌失败"})
+		return
+	}
+
+	c.JSON(http.StatusOK, LoginResponse{
+		Token:        token,
+		RefreshToken: secret,
+		ExpiresIn:    int(accessTokenLifetime().Seconds()),
+		User:         user,
+	})
+}
+
+// Logout 退出登录，吊销刷新令牌所属的会话。访问令牌在会话吊销后同样失效
+func Logout(c *gin.Context) {
+	var req struct {
+		RefreshToken string `json:"refresh_token" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请求参数错误"})
+		return
+	}
+
+	// 令牌无效或会话已吊销时同样视为退出成功
+	if session, err := models.GetSessionByRefreshToken(req.RefreshToken); err == nil && session.RevokedAt == nil {
+		if err := session.Revoke(); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "退出登录失败"})
+			return
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "已退出登录"})
+}
+
+// GetSessions 获取当前用户的登录会话列表
+func GetSessions(c *gin.Context) {
+	userID, exists := middleware.GetUserID(c)
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "未授权"})
+		return
+	}
+	currentID, _ := middleware.GetSessionID(c)
+
+	sessions, err := models.GetActiveSessionsByUserID(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取会话列表失败"})
+		return
+	}
+
+	result := make([]gin.H, 0, len(sessions))
+	for _, session := range sessions {
+		result = append(result, gin.H{
+			"id":           session.ID,
+			"created_at":   session.CreatedAt,
+			"last_used_at": session.LastUsedAt,
+			"expires_at":   session.ExpiresAt,
+			"user_agent":   session.UserAgent,
+			"ip":           session.IP,
+			"current":      session.ID == currentID,
+		})
+	}
+
+	c.JSON(http.StatusOK, gin.H{"sessions": result})
+}
+
+// RevokeSession 吊销指定会话（让该设备退出登录）
+func RevokeSession(c *gin.Context) {
+	userID, exists := middleware.GetUserID(c)
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "未授权"})
+		return
+	}
+
+	session, err := models.GetActiveSession(c.Param("id"), userID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "会话不存在"})
+		return
+	}
+
+	if err := session.Revoke(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "吊销会话失败"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "会话已吊销"})
+}
+
+// RevokeOtherSessions 吊销除当前会话以外的所有会话
+func RevokeOtherSessions(c *gin.Context) {
+	userID, exists := middleware.GetUserID(c)
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "未授权"})
+		return
+	}
+	currentID, _ := middleware.GetSessionID(c)
+
+	if err := models.RevokeUserSessions(userID, currentID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "吊销会话失败"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "其他设备已退出登录"})
+}
+
+// issueSession 为用户创建登录会话，返回访问令牌和刷新令牌
+func issueSession(c *gin.Context, user *models.User) (*LoginResponse, error) {
+	// 顺便清理过期的会话
+	go models.DeleteExpiredSessions()
+
+	session, secret, err := models.CreateSession(user.ID, c.Request.UserAgent(), c.ClientIP(), sessionExpiresAt())
+	if err != nil {
+		return nil, err
+	}
+
+	token, err := generateToken(user, session.ID)
+	if err != nil {
+		session.Revoke()
+		return nil, err
+	}
+
+	return &LoginResponse{
+		Token:        token,
+		RefreshToken: secret,
+		ExpiresIn:    int(accessTokenLifetime().Seconds()),
+		User:         user,
+	}, nil
+}
+
+func accessTokenLifetime() time.Duration {
+	return time.Duration(config.AppConfig.JWT.AccessExpireTime) * time.Minute
+}
+
+func sessionExpiresAt() time.Time {
+	return time.Now().Add(time.Duration(config.AppConfig.JWT.ExpireTime) * time.Hour)
+}
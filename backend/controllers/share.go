@@ -0,0 +1,529 @@
+package controllers
+
+import (
+	"archive/zip"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"gotux/config"
+	"gotux/loginguard"
+	"gotux/middleware"
+	"gotux/models"
+	"gotux/storage"
+	"io"
+	"log"
+	"math"
+	"mime"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+// shareAccessLifetime 验证分享密码后签发的访问凭据有效期，不超过分享本身的有效期
+const shareAccessLifetime = 12 * time.Hour
+
+// shareAccessClaims 访问分享内容的凭据，用于通过 /i/:uuid?share= 访问非公开图片和打包下载。
+// Fingerprint 绑定分享当前的密码，修改密码后已签发的凭据失效
+type shareAccessClaims struct {
+	ShareID     uint   `json:"share_id"`
+	Fingerprint string `json:"fp"`
+	jwt.RegisteredClaims
+}
+
+// shareRequest 创建和更新分享链接的请求，更新时未提供的字段保持不变
+type shareRequest struct {
+	ImageIDs       *[]uint `json:"image_ids" binding:"omitempty,min=1,max=500"`
+	Title          *string `json:"title" binding:"omitempty,max=100"`
+	Description    *string `json:"description" binding:"omitempty,max=1000"`
+	Password       *string `json:"password" binding:"omitempty,max=64"`                  // 空字符串表示取消密码
+	ExpiresInHours *int    `json:"expires_in_hours" binding:"omitempty,min=0,max=87600"` // 0 表示永不过期
+	AllowDownload  *bool   `json:"allow_download"`
+}
+
+// apply 将请求中提供的字段写入分享链接
+func (r *shareRequest) apply(link *models.ShareLink) error {
+	if r.Title != nil {
+		link.Title = strings.TrimSpace(*r.Title)
+	}
+	if r.Description != nil {
+		link.Description = *r.Description
+	}
+	if r.Password != nil {
+		if err := link.SetPassword(*r.Password); err != nil {
+			return err
+		}
+	}
+	if r.ExpiresInHours != nil {
+		link.ExpiresAt = nil
+		if *r.ExpiresInHours > 0 {
+			t := time.Now().Add(time.Duration(*r.ExpiresInHours) * time.Hour)
+			link.ExpiresAt = &t
+		}
+	}
+	if r.AllowDownload != nil {
+		link.AllowDownload = *r.AllowDownload
+	}
+	return nil
+}
+
+// shareURL 前端分享页面的地址，优先使用 PUBLIC_URL
+func shareURL(c *gin.Context, link *models.ShareLink) string {
+	if base := strings.TrimSuffix(config.AppConfig.Server.PublicURL, "/"); base != "" {
+		return base + "/s/" + link.Token
+	}
+	return requestBaseURL(c) + "/s/" + link.Token
+}
+
+// requestBaseURL 按当前请求的地址生成 URL 前缀
+func requestBaseURL(c *gin.Context) string {
+	scheme := "http"
+	if c.Request.TLS != nil {
+		scheme = "https"
+	}
+	return fmt.Sprintf("%s://%s", scheme, c.Request.Host)
+}
+
+// getOwnedShareLink 获取当前用户自己的分享链接，失败时已写入错误响应
+func getOwnedShareLink(c *gin.Context) (*models.ShareLink, bool) {
+	userID, exists := middleware.GetUserID(c)
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "未授权"})
+		return nil, false
+	}
+
+	shareID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的分享ID"})
+		return nil, false
+	}
+
+	link, err := models.GetShareLinkByID(uint(shareID))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "分享不存在"})
+		return nil, false
+	}
+
+	if link.UserID != userID {
+		c.JSON(http.StatusForbidden, gin.H{"error": "没有权限访问该分享"})
+		return nil, false
+	}
+
+	return link, true
+}
+
+// GetShareLinks 获取当前用户的分享链接
+func GetShareLinks(c *gin.Context) {
+	userID, exists := middleware.GetUserID(c)
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "未授权"})
+		return
+	}
+
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	pageSize, _ := strconv.Atoi(c.DefaultQuery("page_size", "20"))
+
+	links, total, err := models.GetShareLinksByUserID(userID, page, pageSize)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取分享列表失败"})
+		return
+	}
+
+	for i := range links {
+		links[i].URL = shareURL(c, &links[i])
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"shares":    links,
+		"total":     total,
+		"page":      page,
+		"page_size": pageSize,
+	})
+}
+
+// CreateShareLink 为一组自己的图片创建分享链接
+func CreateShareLink(c *gin.Context) {
+	userID, exists := middleware.GetUserID(c)
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "未授权"})
+		return
+	}
+
+	var req shareRequest
+	if err := c.ShouldBindJSON(&req); err != nil || req.ImageIDs == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请求参数错误"})
+		return
+	}
+
+	link := &models.ShareLink{UserID: userID}
+	if err := req.apply(link); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "创建分享失败"})
+		return
+	}
+
+	if err := models.CreateShareLink(link, *req.ImageIDs); err != nil {
+		if errors.Is(err, models.ErrShareImagesNotOwned) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "创建分享失败"})
+		}
+		return
+	}
+
+	link.URL = shareURL(c, link)
+	c.JSON(http.StatusCreated, gin.H{
+		"message": "创建成功",
+		"share":   link,
+	})
+}
+
+// GetShareLink 获取分享链接详情及其中的图片
+func GetShareLink(c *gin.Context) {
+	link, ok := getOwnedShareLink(c)
+	if !ok {
+		return
+	}
+
+	images, err := link.GetImages()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取分享图片失败"})
+		return
+	}
+
+	link.URL = shareURL(c, link)
+	c.JSON(http.StatusOK, gin.H{
+		"share":  link,
+		"images": images,
+	})
+}
+
+// UpdateShareLink 修改分享链接的设置或图片列表
+func UpdateShareLink(c *gin.Context) {
+	link, ok := getOwnedShareLink(c)
+	if !ok {
+		return
+	}
+
+	var req shareRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请求参数错误"})
+		return
+	}
+
+	if err := req.apply(link); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "更新失败"})
+		return
+	}
+
+	var imageIDs []uint
+	if req.ImageIDs != nil {
+		imageIDs = *req.ImageIDs
+	}
+	if err := link.Update(imageIDs); err != nil {
+		if errors.Is(err, models.ErrShareImagesNotOwned) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "更新失败"})
+		}
+		return
+	}
+
+	link.URL = shareURL(c, link)
+	c.JSON(http.StatusOK, gin.H{
+		"message": "更新成功",
+		"share":   link,
+	})
+}
+
+// DeleteShareLink 删除分享链接，已打开的分享页面随之失效
+func DeleteShareLink(c *gin.Context) {
+	link, ok := getOwnedShareLink(c)
+	if !ok {
+		return
+	}
+
+	if err := link.Delete(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "删除失败"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "删除成功"})
+}
+
+// GetSharedImages 公开访问分享链接，返回分享信息和每张图片的 /i/:uuid 地址。
+// 设置了密码时需要在 X-Share-Password 请求头中提供
+func GetSharedImages(c *gin.Context) {
+	link, ok := getActiveShareLink(c)
+	if !ok {
+		return
+	}
+
+	if link.HasPassword && !checkSharePassword(c, link) {
+		return
+	}
+
+	owner, err := models.GetUserByID(link.UserID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "分享不存在或已过期"})
+		return
+	}
+
+	images, err := link.GetImages()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取分享图片失败"})
+		return
+	}
+
+	access, err := issueShareAccess(link)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取分享图片失败"})
+		return
+	}
+
+	if err := link.RecordView(); err != nil {
+		log.Printf("记录分享 %d 的访问次数失败: %v", link.ID, err)
+	}
+
+	// 未通过审核的图片不对外展示；非公开的图片在地址中附带访问凭据
+	baseURL := userBaseURL(c, owner)
+	items := make([]gin.H, 0, len(images))
+	for i := range images {
+		image := &images[i]
+		if !image.IsApproved() {
+			continue
+		}
+		imageURL := fmt.Sprintf("%s/i/%s", baseURL, image.UUID)
+		query := ""
+		if !image.IsPublic {
+			query = "share=" + access
+		}
+		thumbURL := imageURL
+		if _, ok := config.AppConfig.Upload.GetVariant("thumb"); ok {
+			thumbURL = joinQuery(imageURL, "variant=thumb")
+		}
+		items = append(items, gin.H{
+			"uuid":          image.UUID,
+			"original_name": image.OriginalName,
+			"description":   image.Description,
+			"width":         image.Width,
+			"height":        image.Height,
+			"file_size":     image.FileSize,
+			"mime_type":     image.MimeType,
+			"url":           joinQuery(imageURL, query),
+			"thumb_url":     joinQuery(thumbURL, query),
+		})
+	}
+
+	response := gin.H{
+		"share": gin.H{
+			"title":          link.Title,
+			"description":    link.Description,
+			"owner":          owner.Username,
+			"created_at":     link.CreatedAt,
+			"expires_at":     link.ExpiresAt,
+			"allow_download": link.AllowDownload,
+			"view_count":     link.ViewCount,
+			"image_count":    len(items),
+		},
+		"images": items,
+	}
+	if link.AllowDownload {
+		response["download_url"] = fmt.Sprintf("%s/api/s/%s/download?access=%s", requestBaseURL(c), link.Token, access)
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// DownloadSharedImages 将分享中的图片打包为 zip 下载，需要分享允许下载
+func DownloadSharedImages(c *gin.Context) {
+	link, ok := getActiveShareLink(c)
+	if !ok {
+		return
+	}
+
+	if !link.AllowDownload {
+		c.JSON(http.StatusForbidden, gin.H{"error": "该分享不允许下载"})
+		return
+	}
+
+	// 设置了密码时需要 GetSharedImages 返回的下载地址中的访问凭据
+	if link.HasPassword {
+		granted, ok := parseShareAccess(c.Query("access"))
+		if !ok || granted.ID != link.ID {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "访问凭据无效或已过期，请重新打开分享页面"})
+			return
+		}
+	}
+
+	images, err := link.GetImages()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取分享图片失败"})
+		return
+	}
+
+	name := link.Title
+	if name == "" {
+		name = "share-" + link.Token
+	}
+	c.Header("Content-Type", "application/zip")
+	c.Header("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": name + ".zip"}))
+	c.Status(http.StatusOK)
+
+	// 响应已经开始，出错时只能中断并记录日志
+	zw := zip.NewWriter(c.Writer)
+	used := make(map[string]int)
+	for i := range images {
+		image := &images[i]
+		if !image.IsApproved() {
+			continue
+		}
+		if err := writeZipEntry(c, zw, uniqueZipName(used, image.OriginalName), image.FilePath); err != nil {
+			log.Printf("打包分享 %d 的图片 %d 失败: %v", link.ID, image.ID, err)
+			return
+		}
+	}
+	if err := zw.Close(); err != nil {
+		log.Printf("打包分享 %d 失败: %v", link.ID, err)
+	}
+}
+
+// getActiveShareLink 根据路径中的 Token 获取未过期的分享链接，失败时已写入错误响应
+func getActiveShareLink(c *gin.Context) (*models.ShareLink, bool) {
+	link, err := models.GetShareLinkByToken(c.Param("token"))
+	if err != nil || link.IsExpired() {
+		c.JSON(http.StatusNotFound, gin.H{"error": "分享不存在或已过期"})
+		return nil, false
+	}
+	return link, true
+}
+
+// checkSharePassword 校验分享密码，连续输错会像登录一样被限制，失败时已写入错误响应
+func checkSharePassword(c *gin.Context, link *models.ShareLink) bool {
+	password := c.GetHeader("X-Share-Password")
+	if password == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "请输入访问密码", "password_required": true})
+		return false
+	}
+
+	// 分享密码单独计数，输错不会影响同一 IP 的账户登录
+	if result := loginguard.Share.Check(link.Token, c.ClientIP()); result.RetryAfter > 0 {
+		seconds := int(math.Ceil(result.RetryAfter.Seconds()))
+		c.Header("Retry-After", strconv.Itoa(seconds))
+		c.JSON(http.StatusTooManyRequests, gin.H{"error": fmt.Sprintf("密码错误次数过多，请 %d 秒后再试", seconds), "retry_after": seconds})
+		return false
+	}
+	defer loginguard.Share.Release(link.Token, c.ClientIP())
+
+	if !link.CheckPassword(password) {
+		loginguard.Share.Fail(link.Token, c.ClientIP())
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "访问密码错误", "password_required": true})
+		return false
+	}
+
+	loginguard.Share.Succeed(link.Token)
+	return true
+}
+
+// shareFingerprint 分享当前密码的摘要，修改密码后变化
+func shareFingerprint(link *models.ShareLink) string {
+	mac := hmac.New(sha256.New, []byte(config.AppConfig.JWT.Secret))
+	mac.Write([]byte(link.Token + "\x00" + link.PasswordHash))
+	return hex.EncodeToString(mac.Sum(nil))[:32]
+}
+
+// issueShareAccess 签发访问分享内容的凭据
+func issueShareAccess(link *models.ShareLink) (string, error) {
+	now := time.Now()
+	expiresAt := now.Add(shareAccessLifetime)
+	if link.ExpiresAt != nil && link.ExpiresAt.Before(expiresAt) {
+		expiresAt = *link.ExpiresAt
+	}
+
+	claims := &shareAccessClaims{
+		ShareID:     link.ID,
+		Fingerprint: shareFingerprint(link),
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        uuid.New().String(),
+			ExpiresAt: jwt.NewNumericDate(expiresAt),
+			IssuedAt:  jwt.NewNumericDate(now),
+		},
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	return token.SignedString([]byte(config.AppConfig.JWT.Secret))
+}
+
+// parseShareAccess 校验访问凭据，返回对应的有效分享链接
+func parseShareAccess(tokenString string) (*models.ShareLink, bool) {
+	if tokenString == "" {
+		return nil, false
+	}
+
+	claims := &shareAccessClaims{}
+	token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		return []byte(config.AppConfig.JWT.Secret), nil
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}), jwt.WithExpirationRequired())
+	if err != nil || !token.Valid {
+		return nil, false
+	}
+
+	link, err := models.GetShareLinkByID(claims.ShareID)
+	if err != nil || link.IsExpired() || !hmac.Equal([]byte(claims.Fingerprint), []byte(shareFingerprint(link))) {
+		return nil, false
+	}
+	return link, true
+}
+
+// canAccessShared 请求附带的分享凭据是否允许访问该图片
+func canAccessShared(c *gin.Context, image *models.Image) bool {
+	link, ok := parseShareAccess(c.Query("share"))
+	return ok && link.UserID == image.UserID && link.HasImage(image.ID)
+}
+
+// joinQuery 在地址后追加查询参数
+func joinQuery(u, query string) string {
+	if query == "" {
+		return u
+	}
+	if strings.Contains(u, "?") {
+		return u + "&" + query
+	}
+	return u + "?" + query
+}
+
+// uniqueZipName 为压缩包中的文件生成不重复的名称
+func uniqueZipName(used map[string]int, name string) string {
+	name = path.Base(strings.ReplaceAll(name, "\\", "/"))
+	if name == "." || name == "/" || name == "" {
+		name = "image"
+	}
+	used[name]++
+	if used[name] == 1 {
+		return name
+	}
+	ext := path.Ext(name)
+	return fmt.Sprintf("%s (%d)%s", strings.TrimSuffix(name, ext), used[name], ext)
+}
+
+// writeZipEntry 从存储后端读取文件写入压缩包，图片已经是压缩格式，不再压缩
+func writeZipEntry(c *gin.Context, zw *zip.Writer, name, key string) error {
+	rc, _, err := storage.Default.Get(c.Request.Context(), key)
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+
+	w, err := zw.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Store, Modified: time.Now()})
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(w, rc)
+	return err
+}
@@ -0,0 +1,87 @@
+package controllers
+
+import (
+	"encoding/json"
+	"gotux/middleware"
+	"gotux/models"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// tagList 请求中的标签，兼容旧版的逗号分隔字符串和字符串数组两种写法
+type tagList []string
+
+// UnmarshalJSON 解析字符串或字符串数组
+func (t *tagList) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err == nil {
+		*t = models.SplitTags(s)
+		return nil
+	}
+	var names []string
+	if err := json.Unmarshal(data, &names); err != nil {
+		return err
+	}
+	*t = names
+	return nil
+}
+
+// tagFilter 解析 tags 和 tag_mode 查询参数，多个标签用逗号分隔，tag_mode=any 时匹配任意一个标签，
+// 默认需要匹配全部标签。失败时已写入错误响应
+func tagFilter(c *gin.Context) (names []string, anyTag bool, ok bool) {
+	names, err := models.NormalizeTags(models.SplitTags(c.Query("tags")))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "标签筛选条件无效: " + err.Error()})
+		return nil, false, false
+	}
+	return names, c.Query("tag_mode") == "any", true
+}
+
+// GetTags 获取当前用户使用过的标签及每个标签的图片数量
+func GetTags(c *gin.Context) {
+	userID, exists := middleware.GetUserID(c)
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "未授权"})
+		return
+	}
+
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	pageSize, _ := strconv.Atoi(c.DefaultQuery("page_size", "50"))
+
+	tags, total, err := models.GetUserTags(userID, page, pageSize)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取标签列表失败"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"tags":      tags,
+		"total":     total,
+		"page":      page,
+		"page_size": pageSize,
+	})
+}
+
+// SuggestTags 按前缀补全当前用户使用过的标签，常用的在前
+func SuggestTags(c *gin.Context) {
+	userID, exists := middleware.GetUserID(c)
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "未授权"})
+		return
+	}
+
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "10"))
+	if limit <= 0 || limit > 50 {
+		limit = 10
+	}
+
+	tags, err := models.SuggestTags(userID, c.Query("q"), limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取标签失败"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"tags": tags})
+}
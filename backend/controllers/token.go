@@ -0,0 +1,192 @@
+package controllers
+
+import (
+	"gotux/middleware"
+	"gotux/models"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetAPITokens 获取当前用户的 API Token 列表
+func GetAPITokens(c *gin.Context) {
+	userID, exists := middleware.GetUserID(c)
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "未授权"})
+		return
+	}
+
+	tokens, err := models.GetAPITokensByUserID(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取 Token 列表失败"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"tokens": tokens,
+		"scopes": models.TokenScopes,
+	})
+}
+
+// CreateAPIToken 创建 API Token，明文只在响应中返回一次
+func CreateAPIToken(c *gin.Context) {
+	user, exists := middleware.GetUser(c)
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "未授权"})
+		return
+	}
+
+	var req struct {
+		Name          string   `json:"name" binding:"required,max=64"`
+		Scopes        []string `json:"scopes" binding:"required,min=1"`
+		ExpiresInDays int      `json:"expires_in_days" binding:"min=0,max=3650"` // 0 表示永不过期
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请求参数错误"})
+		return
+	}
+
+	scopes, ok := validateTokenScopes(c, user, req.Scopes)
+	if !ok {
+		return
+	}
+
+	var expiresAt *time.Time
+	if req.ExpiresInDays > 0 {
+		t := time.Now().AddDate(0, 0, req.ExpiresInDays)
+		expiresAt = &t
+	}
+
+	token, secret, err := models.CreateAPIToken(user.ID, strings.TrimSpace(req.Name), scopes, expiresAt)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "创建 Token 失败"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"message":   "创建成功，请妥善保存 Token，它只会显示一次",
+		"token":     secret,
+		"api_token": token,
+	})
+}
+
+// UpdateAPIToken 修改 API Token 的名称或权限
+func UpdateAPIToken(c *gin.Context) {
+	user, exists := middleware.GetUser(c)
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "未授权"})
+		return
+	}
+
+	token, ok := getOwnAPIToken(c, user.ID)
+	if !ok {
+		return
+	}
+
+	var req struct {
+		Name   string   `json:"name" binding:"max=64"`
+		Scopes []string `json:"scopes"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请求参数错误"})
+		return
+	}
+
+	if name := strings.TrimSpace(req.Name); name != "" {
+		token.Name = name
+	}
+	if req.Scopes != nil {
+		scopes, ok := validateTokenScopes(c, user, req.Scopes)
+		if !ok {
+			return
+		}
+		token.Scopes = strings.Join(scopes, ",")
+	}
+
+	if err := token.Update(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "更新失败"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":   "更新成功",
+		"api_token": token,
+	})
+}
+
+// DeleteAPIToken 删除（吊销）API Token
+func DeleteAPIToken(c *gin.Context) {
+	userID, exists := middleware.GetUserID(c)
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "未授权"})
+		return
+	}
+
+	token, ok := getOwnAPIToken(c, userID)
+	if !ok {
+		return
+	}
+
+	if err := token.Delete(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "删除失败"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "删除成功"})
+}
+
+func getOwnAPIToken(c *gin.Context, userID uint) (*models.APIToken, bool) {
+	tokenID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的 Token ID"})
+		return nil, false
+	}
+
+	token, err := models.GetAPIToken(uint(tokenID), userID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Token 不存在"})
+		return nil, false
+	}
+	return token, true
+}
+
+// validateTokenScopes 检查权限范围是否有效并去重，只有管理员可以授予 admin 权限
+func validateTokenScopes(c *gin.Context, user *models.User, scopes []string) ([]string, bool) {
+	var result []string
+	seen := make(map[string]bool)
+	for _, scope := range scopes {
+		scope = strings.ToLower(strings.TrimSpace(scope))
+		if seen[scope] {
+			continue
+		}
+		if !isValidTokenScope(scope) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "无效的权限范围: " + scope})
+			return nil, false
+		}
+		if scope == models.ScopeAdmin && !user.IsAdmin() {
+			c.JSON(http.StatusForbidden, gin.H{"error": "只有管理员可以授予 admin 权限"})
+			return nil, false
+		}
+		seen[scope] = true
+		result = append(result, scope)
+	}
+	if len(result) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "至少需要一个权限范围"})
+		return nil, false
+	}
+	return result, true
+}
+
+func isValidTokenScope(scope string) bool {
+	for _, s := range models.TokenScopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
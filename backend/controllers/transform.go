@@ -0,0 +1,150 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"gotux/config"
+	"gotux/imageproc"
+	"gotux/models"
+	"gotux/storage"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+var (
+	// errInvalidTransform 按需处理参数格式错误
+	errInvalidTransform = errors.New("invalid transform")
+	// errTransformNotAllowed 按需处理参数不在预设列表中
+	errTransformNotAllowed = errors.New("transform not allowed")
+)
+
+// parseTransform 从查询参数（preset 或 w、h、fit、q、fmt）解析按需处理参数，
+// 未请求处理时返回 nil。参数必须与某个预设一致
+func parseTransform(c *gin.Context, image *models.Image) (*imageproc.Transform, error) {
+	var t imageproc.Transform
+	presetName := c.Query("preset")
+	if presetName != "" {
+		preset, ok := config.AppConfig.Upload.GetPreset(presetName)
+		if !ok {
+			return nil, errTransformNotAllowed
+		}
+		t = presetTransform(preset)
+		if t.Format == "" {
+			t.Format = c.Query("fmt")
+		}
+	} else {
+		if c.Query("w") == "" && c.Query("h") == "" && c.Query("fit") == "" && c.Query("q") == "" && c.Query("fmt") == "" {
+			return nil, nil
+		}
+
+		var err error
+		for _, p := range []struct {
+			name string
+			dst  *int
+		}{{"w", &t.Width}, {"h", &t.Height}, {"q", &t.Quality}} {
+			if v := c.Query(p.name); v != "" {
+				if *p.dst, err = strconv.Atoi(v); err != nil {
+					return nil, errInvalidTransform
+				}
+			}
+		}
+		t.Fit = c.Query("fit")
+		t.Format = c.Query("fmt")
+	}
+
+	normalized, err := t.Normalize(image.MimeType)
+	if err != nil {
+		return nil, errInvalidTransform
+	}
+	if presetName == "" && !transformAllowed(normalized, image.MimeType) {
+		return nil, errTransformNotAllowed
+	}
+	return &normalized, nil
+}
+
+// transformAllowed 参数是否与某个预设一致，预设未指定格式时允许任意输出格式
+func transformAllowed(t imageproc.Transform, sourceMimeType string) bool {
+	for _, preset := range config.AppConfig.Upload.TransformPresets {
+		allowed := presetTransform(preset)
+		if allowed.Format == "" {
+			allowed.Format = t.Format
+		}
+		allowed, err := allowed.Normalize(sourceMimeType)
+		if err == nil && allowed == t {
+			return true
+		}
+	}
+	return false
+}
+
+func presetTransform(preset config.TransformPreset) imageproc.Transform {
+	return imageproc.Transform{
+		Width:   preset.Width,
+		Height:  preset.Height,
+		Fit:     preset.Fit,
+		Quality: preset.Quality,
+		Format:  preset.Format,
+	}
+}
+
+// getOrCreateTransform 返回处理结果的缓存文件路径，缓存不存在时从原图生成
+func getOrCreateTransform(ctx context.Context, image *models.Image, t imageproc.Transform) (string, error) {
+	// <cache>/<uuid>/w800_h0_q85.jpg
+	dir := transformCacheDir(image.UUID)
+	cachePath := filepath.Join(dir, t.Key())
+	if _, err := os.Stat(cachePath); err == nil {
+		return cachePath, nil
+	}
+
+	rc, _, err := storage.Default.Get(ctx, image.FilePath)
+	if err != nil {
+		return "", err
+	}
+	data, err := io.ReadAll(rc)
+	rc.Close()
+	if err != nil {
+		return "", err
+	}
+
+	result, err := imageproc.Apply(data, t)
+	if err != nil {
+		return "", err
+	}
+
+	// 先写临时文件再重命名，并发请求同一结果时不会读到不完整的文件
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", err
+	}
+	tmp, err := os.CreateTemp(dir, ".tmp-*")
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(result.Data); err != nil {
+		tmp.Close()
+		return "", err
+	}
+	if err := tmp.Close(); err != nil {
+		return "", err
+	}
+	if err := os.Rename(tmp.Name(), cachePath); err != nil {
+		return "", err
+	}
+	return cachePath, nil
+}
+
+// deleteTransformCache 删除图片的所有按需处理缓存
+func deleteTransformCache(uuid string) {
+	if uuid == "" {
+		return
+	}
+	os.RemoveAll(transformCacheDir(uuid))
+}
+
+func transformCacheDir(uuid string) string {
+	return filepath.Join(config.AppConfig.Upload.TransformCachePath, uuid)
+}
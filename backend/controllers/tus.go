@@ -0,0 +1,331 @@
+package controllers
+
+import (
+	"encoding/base64"
+	"errors"
+	"gotux/config"
+	"gotux/middleware"
+	"gotux/models"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// tus 1.0 断点续传协议，支持 creation、termination 和 expiration 扩展
+// 参考 https://tus.io/protocols/resumable-upload
+
+const (
+	tusVersion    = "1.0.0"
+	tusExtensions = "creation,termination,expiration"
+)
+
+// tusLocks 防止同一上传被并发 PATCH
+var tusLocks sync.Map
+
+// TusOptions 返回服务端支持的协议版本和扩展
+func TusOptions(c *gin.Context) {
+	c.Header("Tus-Resumable", tusVersion)
+	c.Header("Tus-Version", tusVersion)
+	c.Header("Tus-Extension", tusExtensions)
+	c.Header("Tus-Max-Size", strconv.FormatInt(config.AppConfig.Upload.MaxSize, 10))
+	c.Status(http.StatusNoContent)
+}
+
+// CreateTusUpload 创建上传（creation 扩展），返回上传地址
+func CreateTusUpload(c *gin.Context) {
+	if !checkTusResumable(c) {
+		return
+	}
+
+	user, exists := middleware.GetUser(c)
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "未授权"})
+		return
+	}
+
+	if c.GetHeader("Upload-Defer-Length") != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "不支持延迟声明文件大小"})
+		return
+	}
+	length, err := strconv.ParseInt(c.GetHeader("Upload-Length"), 10, 64)
+	if err != nil || length <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的 Upload-Length"})
+		return
+	}
+
+	// 在接收数据前先检查大小限制和配额，未完成的上传也计入配额，
+	// 否则可以同时创建大量上传占满服务器磁盘
+	if err := newUploadPolicy(user).CheckSize(length); err != nil {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": err.Error()})
+		return
+	}
+	pending, err := models.GetUserTusUploadsLength(user.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取存储使用量失败"})
+		return
+	}
+	if err := checkStorageQuota(user, pending+length); err != nil {
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		return
+	}
+
+	metadata := parseTusMetadata(c.GetHeader("Upload-Metadata"))
+	fileName := metadata["filename"]
+	if fileName == "" {
+		fileName = metadata["name"]
+	}
+
+	// 顺便清理过期的上传
+	go cleanupExpiredTusUploads()
+
+	upload := &models.TusUpload{
+		ID:        uuid.New().String(),
+		UserID:    user.ID,
+		FileName:  filepath.Base(fileName),
+		Length:    length,
+		ExpiresAt: tusExpiresAt(),
+	}
+	if fileName == "" {
+		upload.FileName = upload.ID
+	}
+
+	if err := os.MkdirAll(config.AppConfig.Upload.TusPath, 0755); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "创建上传失败"})
+		return
+	}
+	f, err := os.Create(tusFilePath(upload.ID))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "创建上传失败"})
+		return
+	}
+	f.Close()
+
+	if err := models.CreateTusUpload(upload); err != nil {
+		os.Remove(tusFilePath(upload.ID))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "创建上传失败"})
+		return
+	}
+
+	c.Header("Location", strings.TrimSuffix(c.Request.URL.Path, "/")+"/"+upload.ID)
+	c.Header("Upload-Expires", upload.ExpiresAt.UTC().Format(http.TimeFormat))
+	c.Status(http.StatusCreated)
+}
+
+// GetTusUploadOffset 返回已接收的字节数，客户端据此续传
+func GetTusUploadOffset(c *gin.Context) {
+	if !checkTusResumable(c) {
+		return
+	}
+
+	upload, ok := getTusUpload(c)
+	if !ok {
+		return
+	}
+
+	c.Header("Cache-Control", "no-store")
+	c.Header("Upload-Offset", strconv.FormatInt(upload.Offset, 10))
+	c.Header("Upload-Length", strconv.FormatInt(upload.Length, 10))
+	c.Header("Upload-Expires", upload.ExpiresAt.UTC().Format(http.TimeFormat))
+	c.Status(http.StatusOK)
+}
+
+// PatchTusUpload 从 Upload-Offset 处追加数据，全部接收后按普通上传流程保存图片
+func PatchTusUpload(c *gin.Context) {
+	if !checkTusResumable(c) {
+		return
+	}
+
+	if c.ContentType() != "application/offset+octet-stream" {
+		c.JSON(http.StatusUnsupportedMediaType, gin.H{"error": "Content-Type 必须为 application/offset+octet-stream"})
+		return
+	}
+
+	upload, ok := getTusUpload(c)
+	if !ok {
+		return
+	}
+
+	lock, _ := tusLocks.LoadOrStore(upload.ID, &sync.Mutex{})
+	mu := lock.(*sync.Mutex)
+	if !mu.TryLock() {
+		c.JSON(http.StatusLocked, gin.H{"error": "该上传正在进行中"})
+		return
+	}
+	defer mu.Unlock()
+
+	// 加锁后重新读取，避免使用其他请求更新前的偏移量
+	upload, ok = getTusUpload(c)
+	if !ok {
+		return
+	}
+
+	offset, err := strconv.ParseInt(c.GetHeader("Upload-Offset"), 10, 64)
+	if err != nil || offset != upload.Offset {
+		c.JSON(http.StatusConflict, gin.H{"error": "Upload-Offset 与已接收的数据不一致"})
+		return
+	}
+
+	f, err := os.OpenFile(tusFilePath(upload.ID), os.O_WRONLY, 0644)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "上传文件不存在"})
+		return
+	}
+	// 从记录的偏移量处写入。上次写入后如果没能保存偏移量，文件会比记录的长，先截掉多出的部分
+	if err := f.Truncate(upload.Offset); err != nil {
+		f.Close()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "写入上传数据失败"})
+		return
+	}
+	if _, err := f.Seek(upload.Offset, io.SeekStart); err != nil {
+		f.Close()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "写入上传数据失败"})
+		return
+	}
+
+	// 连接中断时也保存已收到的部分，客户端可以从新的偏移量继续
+	n, copyErr := io.Copy(f, io.LimitReader(c.Request.Body, upload.Length-upload.Offset))
+	closeErr := f.Close()
+	if closeErr != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "写入上传数据失败"})
+		return
+	}
+	if err := upload.UpdateOffset(upload.Offset+n, tusExpiresAt()); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "保存上传进度失败"})
+		return
+	}
+	if copyErr != nil {
+		log.Printf("tus 上传 %s 接收中断: %v", upload.ID, copyErr)
+		return
+	}
+
+	c.Header("Upload-Offset", strconv.FormatInt(upload.Offset, 10))
+	c.Header("Upload-Expires", upload.ExpiresAt.UTC().Format(http.TimeFormat))
+	if upload.Offset < upload.Length {
+		c.Status(http.StatusNoContent)
+		return
+	}
+
+	// 全部接收完成，走与表单上传相同的保存流程
+	image, err := finishTusUpload(c, upload)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.Header("X-Image-ID", strconv.FormatUint(uint64(image.ID), 10))
+	c.Header("X-Image-UUID", image.UUID)
+	c.Status(http.StatusNoContent)
+}
+
+// DeleteTusUpload 取消上传（termination 扩展）
+func DeleteTusUpload(c *gin.Context) {
+	if !checkTusResumable(c) {
+		return
+	}
+
+	upload, ok := getTusUpload(c)
+	if !ok {
+		return
+	}
+
+	removeTusUpload(upload.ID)
+	c.Status(http.StatusNoContent)
+}
+
+// finishTusUpload 保存已接收完的上传，无论成功与否都会删除临时数据
+func finishTusUpload(c *gin.Context, upload *models.TusUpload) (*models.Image, error) {
+	defer removeTusUpload(upload.ID)
+
+	user, exists := middleware.GetUser(c)
+	if !exists {
+		return nil, errors.New("未授权")
+	}
+
+	data, err := os.ReadFile(tusFilePath(upload.ID))
+	if err != nil {
+		return nil, errors.New("文件读取失败")
+	}
+
+	return saveUploadedImage(c.Request.Context(), user, uploadFile{
+		Name: upload.FileName,
+		Data: data,
+	})
+}
+
+// checkTusResumable 设置 Tus-Resumable 响应头，并检查客户端的协议版本
+func checkTusResumable(c *gin.Context) bool {
+	c.Header("Tus-Resumable", tusVersion)
+	if c.GetHeader("Tus-Resumable") != tusVersion {
+		c.Header("Tus-Version", tusVersion)
+		c.JSON(http.StatusPreconditionFailed, gin.H{"error": "不支持的 tus 协议版本"})
+		return false
+	}
+	return true
+}
+
+// getTusUpload 获取当前用户的上传记录，不存在时写入 404 响应
+func getTusUpload(c *gin.Context) (*models.TusUpload, bool) {
+	userID, exists := middleware.GetUserID(c)
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "未授权"})
+		return nil, false
+	}
+
+	upload, err := models.GetTusUpload(c.Param("id"), userID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "上传不存在或已过期"})
+		return nil, false
+	}
+	return upload, true
+}
+
+// parseTusMetadata 解析 Upload-Metadata: "filename d29ybGQuanBn,filetype aW1hZ2UvanBlZw=="
+func parseTusMetadata(header string) map[string]string {
+	metadata := make(map[string]string)
+	for _, pair := range strings.Split(header, ",") {
+		key, value, _ := strings.Cut(strings.TrimSpace(pair), " ")
+		if key == "" {
+			continue
+		}
+		decoded, err := base64.StdEncoding.DecodeString(value)
+		if err != nil {
+			continue
+		}
+		metadata[key] = string(decoded)
+	}
+	return metadata
+}
+
+// cleanupExpiredTusUploads 删除过期未完成的上传
+func cleanupExpiredTusUploads() {
+	uploads, err := models.GetExpiredTusUploads()
+	if err != nil {
+		return
+	}
+	for _, upload := range uploads {
+		removeTusUpload(upload.ID)
+	}
+}
+
+func removeTusUpload(id string) {
+	os.Remove(tusFilePath(id))
+	models.DeleteTusUpload(id)
+	tusLocks.Delete(id)
+}
+
+func tusFilePath(id string) string {
+	return filepath.Join(config.AppConfig.Upload.TusPath, id)
+}
+
+func tusExpiresAt() time.Time {
+	return time.Now().Add(time.Duration(config.AppConfig.Upload.TusExpire) * time.Hour)
+}
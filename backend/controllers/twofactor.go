@@ -0,0 +1,495 @@
+package controllers
+
+import (
+	"errors"
+	"gotux/config"
+	"gotux/loginguard"
+	"gotux/middleware"
+	"gotux/models"
+	"gotux/totp"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+// totpIssuer 验证器应用中显示的服务名称
+const totpIssuer = "Gotux"
+
+// 登录挑战令牌：密码验证通过后签发，完成两步验证后才换取正式的访问令牌
+const (
+	challengeLogin = "2fa"       // 已开启两步验证，等待输入验证码
+	challengeSetup = "2fa_setup" // 角色要求两步验证但尚未开启，需先完成绑定
+
+	challengeLifetime    = 5 * time.Minute
+	maxChallengeAttempts = 5
+)
+
+type challengeClaims struct {
+	UserID  uint   `json:"user_id"`
+	Purpose string `json:"purpose"`
+	jwt.RegisteredClaims
+}
+
+// challengeAttempts 记录每个挑战令牌的验证次数，防止在有效期内穷举验证码
+var challengeAttempts sync.Map
+
+type challengeAttempt struct {
+	mu        sync.Mutex
+	count     int
+	expiresAt time.Time
+}
+
+var (
+	errTOTPAlreadyEnabled = errors.New("两步验证已开启")
+	errTOTPNotEnrolled    = errors.New("请先获取两步验证密钥")
+	errTOTPInvalidCode    = errors.New("验证码错误")
+)
+
+// VerifyTwoFactorLogin 登录第二步：校验验证码或恢复码后签发访问令牌
+func VerifyTwoFactorLogin(c *gin.Context) {
+	var req struct {
+		ChallengeToken string `json:"challenge_token" binding:"required"`
+		Code           string `json:"code"`
+		RecoveryCode   string `json:"recovery_code"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil || (req.Code == "" && req.RecoveryCode == "") {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请求参数错误"})
+		return
+	}
+
+	user, ok := useChallenge(c, req.ChallengeToken, challengeLogin)
+	if !ok {
+		return
+	}
+
+	// 验证码和密码共用登录失败计数，每个挑战令牌的次数限制无法阻止反复登录获取新令牌
+	if rejectThrottledLogin(c, user.Username) {
+		return
+	}
+	defer loginguard.Release(user.Username, c.ClientIP())
+	if !verifySecondFactor(user, req.Code, req.RecoveryCode) {
+		loginguard.Fail(user.Username, c.ClientIP())
+		c.JSON(http.StatusUnauthorized, gin.H{"error": errTOTPInvalidCode.Error()})
+		return
+	}
+
+	resp, err := issueSession(c, user)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "生成令牌失败"})
+		return
+	}
+	loginguard.Succeed(user.Username)
+
+	c.JSON(http.StatusOK, resp)
+}
+
+// BeginTwoFactorSetup 登录时被要求开启两步验证：获取密钥
+func BeginTwoFactorSetup(c *gin.Context) {
+	var req struct {
+		ChallengeToken string `json:"challenge_token" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请求参数错误"})
+		return
+	}
+
+	user, ok := parseChallenge(c, req.ChallengeToken, challengeSetup)
+	if !ok {
+		return
+	}
+
+	enrollTwoFactor(c, user)
+}
+
+// CompleteTwoFactorSetup 登录时被要求开启两步验证：校验验证码、开启两步验证并签发访问令牌
+func CompleteTwoFactorSetup(c *gin.Context) {
+	var req struct {
+		ChallengeToken string `json:"challenge_token" binding:"required"`
+		Code           string `json:"code" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请求参数错误"})
+		return
+	}
+
+	user, ok := useChallenge(c, req.ChallengeToken, challengeSetup)
+	if !ok {
+		return
+	}
+
+	codes, err := enableTOTP(user, req.Code)
+	if err != nil {
+		c.JSON(twoFactorErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	resp, err := issueSession(c, user)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "生成令牌失败"})
+		return
+	}
+	loginguard.Succeed(user.Username)
+
+	c.JSON(http.StatusOK, gin.H{
+		"token":          resp.Token,
+		"refresh_token":  resp.RefreshToken,
+		"expires_in":     resp.ExpiresIn,
+		"user":           resp.User,
+		"recovery_codes": codes,
+	})
+}
+
+// GetTwoFactorStatus 获取当前用户的两步验证状态
+func GetTwoFactorStatus(c *gin.Context) {
+	user, exists := middleware.GetUser(c)
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "未授权"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"enabled":                  user.TOTPEnabled,
+		"required":                 twoFactorRequired(user),
+		"recovery_codes_remaining": models.CountRecoveryCodes(user.ID),
+	})
+}
+
+// EnrollTwoFactor 生成新的两步验证密钥，调用 EnableTwoFactor 校验后才会生效
+func EnrollTwoFactor(c *gin.Context) {
+	user, exists := middleware.GetUser(c)
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "未授权"})
+		return
+	}
+
+	enrollTwoFactor(c, user)
+}
+
+// EnableTwoFactor 校验验证器应用生成的验证码并开启两步验证，返回一次性恢复码
+func EnableTwoFactor(c *gin.Context) {
+	user, exists := middleware.GetUser(c)
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "未授权"})
+		return
+	}
+
+	var req struct {
+		Code string `json:"code" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请求参数错误"})
+		return
+	}
+
+	codes, err := enableTOTP(user, req.Code)
+	if err != nil {
+		c.JSON(twoFactorErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":        "两步验证已开启，请妥善保存恢复码，它们只会显示一次",
+		"recovery_codes": codes,
+	})
+}
+
+// DisableTwoFactor 关闭两步验证，需要密码和验证码（或恢复码）
+func DisableTwoFactor(c *gin.Context) {
+	user, exists := middleware.GetUser(c)
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "未授权"})
+		return
+	}
+
+	var req struct {
+		Password     string `json:"password" binding:"required"`
+		Code         string `json:"code"`
+		RecoveryCode string `json:"recovery_code"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil || (req.Code == "" && req.RecoveryCode == "") {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请求参数错误"})
+		return
+	}
+
+	if !user.TOTPEnabled {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "两步验证未开启"})
+		return
+	}
+	if twoFactorRequired(user) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "管理员账户必须开启两步验证"})
+		return
+	}
+	if err := user.CheckPassword(req.Password); err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "密码错误"})
+		return
+	}
+	if !verifySecondFactor(user, req.Code, req.RecoveryCode) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": errTOTPInvalidCode.Error()})
+		return
+	}
+
+	if err := disableTOTP(user); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "关闭两步验证失败"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "两步验证已关闭"})
+}
+
+// RegenerateRecoveryCodes 重新生成恢复码，旧的恢复码全部作废
+func RegenerateRecoveryCodes(c *gin.Context) {
+	user, exists := middleware.GetUser(c)
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "未授权"})
+		return
+	}
+
+	var req struct {
+		Code string `json:"code" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请求参数错误"})
+		return
+	}
+
+	if !user.TOTPEnabled {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "两步验证未开启"})
+		return
+	}
+	if !verifyTOTP(user, req.Code) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": errTOTPInvalidCode.Error()})
+		return
+	}
+
+	codes, err := models.GenerateRecoveryCodes(user.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "生成恢复码失败"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":        "恢复码已重新生成，旧的恢复码已作废",
+		"recovery_codes": codes,
+	})
+}
+
+// loginChallenge 需要两步验证时返回挑战令牌，不需要时返回空
+func loginChallenge(user *models.User) (gin.H, error) {
+	var purpose string
+	switch {
+	case user.TOTPEnabled:
+		purpose = challengeLogin
+	case twoFactorRequired(user):
+		purpose = challengeSetup
+	default:
+		return nil, nil
+	}
+
+	token, err := generateChallengeToken(user, purpose)
+	if err != nil {
+		return nil, err
+	}
+
+	resp := gin.H{
+		"challenge_token": token,
+		"expires_in":      int(challengeLifetime.Seconds()),
+	}
+	if purpose == challengeLogin {
+		resp["two_factor_required"] = true
+	} else {
+		resp["two_factor_setup_required"] = true
+	}
+	return resp, nil
+}
+
+// twoFactorRequired 管理员是否被要求开启两步验证
+func twoFactorRequired(user *models.User) bool {
+	return user.IsAdmin() && models.GetBoolSetting(models.SettingRequireAdmin2FA, false)
+}
+
+func generateChallengeToken(user *models.User, purpose string) (string, error) {
+	now := time.Now()
+	expiresAt := now.Add(challengeLifetime)
+
+	// 顺便清理已过期挑战的计数
+	challengeAttempts.Range(func(key, value interface{}) bool {
+		if now.After(value.(*challengeAttempt).expiresAt) {
+			challengeAttempts.Delete(key)
+		}
+		return true
+	})
+
+	claims := &challengeClaims{
+		UserID:  user.ID,
+		Purpose: purpose,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        uuid.New().String(),
+			ExpiresAt: jwt.NewNumericDate(expiresAt),
+			IssuedAt:  jwt.NewNumericDate(now),
+		},
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	return token.SignedString([]byte(config.AppConfig.JWT.Secret))
+}
+
+// parseChallenge 校验挑战令牌并返回对应用户，失败时写入错误响应
+func parseChallenge(c *gin.Context, tokenString, purpose string) (*models.User, bool) {
+	claims, user, ok := loadChallenge(c, tokenString, purpose)
+	if !ok {
+		return nil, false
+	}
+	if attempt, exists := challengeAttempts.Load(claims.ID); exists && attempt.(*challengeAttempt).exhausted() {
+		c.JSON(http.StatusTooManyRequests, gin.H{"error": "验证失败次数过多，请重新登录"})
+		return nil, false
+	}
+	return user, true
+}
+
+// useChallenge 与 parseChallenge 相同，但会计入验证次数
+func useChallenge(c *gin.Context, tokenString, purpose string) (*models.User, bool) {
+	claims, user, ok := loadChallenge(c, tokenString, purpose)
+	if !ok {
+		return nil, false
+	}
+
+	value, _ := challengeAttempts.LoadOrStore(claims.ID, &challengeAttempt{expiresAt: claims.ExpiresAt.Time})
+	attempt := value.(*challengeAttempt)
+	attempt.mu.Lock()
+	defer attempt.mu.Unlock()
+	if attempt.count >= maxChallengeAttempts {
+		c.JSON(http.StatusTooManyRequests, gin.H{"error": "验证失败次数过多，请重新登录"})
+		return nil, false
+	}
+	attempt.count++
+	return user, true
+}
+
+func loadChallenge(c *gin.Context, tokenString, purpose string) (*challengeClaims, *models.User, bool) {
+	claims := &challengeClaims{}
+	token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		return []byte(config.AppConfig.JWT.Secret), nil
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}))
+	if err != nil || !token.Valid || claims.Purpose != purpose || claims.ID == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "验证已过期，请重新登录"})
+		return nil, nil, false
+	}
+
+	user, err := models.GetUserByID(claims.UserID)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "用户不存在"})
+		return nil, nil, false
+	}
+	if !user.IsActive() {
+		c.JSON(http.StatusForbidden, gin.H{"error": "账户已被禁用"})
+		return nil, nil, false
+	}
+	return claims, user, true
+}
+
+func (a *challengeAttempt) exhausted() bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.count >= maxChallengeAttempts
+}
+
+// enrollTwoFactor 生成待验证的密钥并返回 otpauth 地址
+func enrollTwoFactor(c *gin.Context, user *models.User) {
+	if user.TOTPEnabled {
+		c.JSON(http.StatusConflict, gin.H{"error": errTOTPAlreadyEnabled.Error()})
+		return
+	}
+
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "生成密钥失败"})
+		return
+	}
+
+	user.TOTPSecret = secret
+	if err := user.Update(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "保存密钥失败"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"secret":      secret,
+		"otpauth_uri": totp.URI(totpIssuer, user.Username, secret),
+	})
+}
+
+// enableTOTP 校验待验证密钥的验证码，开启两步验证并生成恢复码
+func enableTOTP(user *models.User, code string) ([]string, error) {
+	if user.TOTPEnabled {
+		return nil, errTOTPAlreadyEnabled
+	}
+	if user.TOTPSecret == "" {
+		return nil, errTOTPNotEnrolled
+	}
+	if !verifyTOTP(user, code) {
+		return nil, errTOTPInvalidCode
+	}
+
+	user.TOTPEnabled = true
+	if err := user.Update(); err != nil {
+		return nil, errors.New("开启两步验证失败")
+	}
+	codes, err := models.GenerateRecoveryCodes(user.ID)
+	if err != nil {
+		return nil, errors.New("生成恢复码失败")
+	}
+	return codes, nil
+}
+
+// disableTOTP 关闭两步验证并删除密钥和恢复码
+func disableTOTP(user *models.User) error {
+	user.TOTPEnabled = false
+	user.TOTPSecret = ""
+	user.TOTPLastCounter = 0
+	if err := user.Update(); err != nil {
+		return err
+	}
+	return models.DeleteRecoveryCodes(user.ID)
+}
+
+// verifyTOTP 校验验证码，每个时间步只能使用一次
+func verifyTOTP(user *models.User, code string) bool {
+	if user.TOTPSecret == "" {
+		return false
+	}
+	counter, ok := totp.Validate(user.TOTPSecret, code, time.Now())
+	if !ok {
+		return false
+	}
+	return user.UseTOTPCounter(counter)
+}
+
+// verifySecondFactor 校验验证码，未提供时校验恢复码
+func verifySecondFactor(user *models.User, code, recoveryCode string) bool {
+	if code != "" {
+		return verifyTOTP(user, code)
+	}
+	return models.UseRecoveryCode(user.ID, recoveryCode)
+}
+
+func twoFactorErrorStatus(err error) int {
+	switch err {
+	case errTOTPAlreadyEnabled:
+		return http.StatusConflict
+	case errTOTPNotEnrolled:
+		return http.StatusBadRequest
+	case errTOTPInvalidCode:
+		return http.StatusUnauthorized
+	}
+	return http.StatusInternalServerError
+}
@@ -0,0 +1,230 @@
+package controllers
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"gotux/config"
+	"gotux/imageproc"
+	"gotux/models"
+	"gotux/storage"
+	"image"
+	"log"
+	"path"
+	"path/filepath"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// uploadFile 待保存的上传文件
+type uploadFile struct {
+	Name          string // 原始文件名
+	Data          []byte
+	SkipWatermark bool // 本次上传不添加水印
+}
+
+// saveUploadedImage 按用户设置处理图片并保存到存储后端，返回新建的图片记录；
+// 与已有图片重复时直接返回已有记录
+func saveUploadedImage(ctx context.Context, user *models.User, file uploadFile) (*models.Image, error) {
+	policy := newUploadPolicy(user)
+	if err := policy.CheckSize(int64(len(file.Data))); err != nil {
+		return nil, err
+	}
+
+	// 根据文件内容识别格式，不信任客户端声明的类型和扩展名
+	detected, err := detectImage(file, policy)
+	if err != nil {
+		return nil, err
+	}
+
+	// 原始文件哈希，用于识别重复上传
+	sum := md5.Sum(file.Data)
+	originalHash := hex.EncodeToString(sum[:])
+
+	if existing, err := models.GetImageByHash(originalHash, user.ID); err == nil {
+		return existing, nil
+	}
+
+	// 按用户设置处理图片
+	opts := imageproc.Options{
+		Compress: user.CompressImage,
+		Quality:  user.CompressQuality,
+	}
+	if user.EnableWatermark && !file.SkipWatermark {
+		if user.WatermarkText != "" {
+			opts.TextWatermark = &imageproc.TextWatermark{
+				Text:     user.WatermarkText,
+				Position: user.WatermarkPosition,
+				Opacity:  float64(user.WatermarkOpacity) / 100,
+			}
+		}
+		if user.WatermarkImage != "" {
+			if logo, err := loadWatermarkImage(ctx, user.WatermarkImage); err != nil {
+				log.Printf("加载用户 %d 的水印图片失败: %v", user.ID, err)
+			} else {
+				opts.ImageWatermark = &imageproc.ImageWatermark{
+					Logo:     logo,
+					Position: user.WatermarkImagePosition,
+					Scale:    float64(user.WatermarkImageScale) / 100,
+					Margin:   user.WatermarkImageMargin,
+					Opacity:  float64(user.WatermarkImageOpacity) / 100,
+				}
+			}
+		}
+	}
+
+	result, err := imageproc.Process(file.Data, opts)
+	if err != nil {
+		if errors.Is(err, imageproc.ErrAnimationTooLarge) {
+			return nil, errors.New("动图帧数过多，无法添加水印，请关闭水印后上传")
+		}
+		return nil, errors.New("图片解析失败")
+	}
+	watermarked := result.Reencoded && (opts.TextWatermark != nil || opts.ImageWatermark != nil)
+
+	data := file.Data
+	hashStr := originalHash
+	mimeType := detected.MimeType
+	ext := detected.Ext
+	if result.Reencoded {
+		data = result.Data
+		sum = md5.Sum(data)
+		hashStr = hex.EncodeToString(sum[:])
+		mimeType = result.MimeType
+		ext = result.Ext
+
+		// 处理后的文件也可能与已有图片相同
+		if existing, err := models.GetImageByHash(hashStr, user.ID); err == nil {
+			return existing, nil
+		}
+	}
+
+	// 检查存储配额（加了水印时原图也计入）
+	storedSize := int64(len(data))
+	if watermarked {
+		storedSize += int64(len(file.Data))
+	}
+	if err := checkStorageQuota(user, storedSize); err != nil {
+		return nil, err
+	}
+
+	// 生成唯一文件名，按日期组织文件夹
+	newFileName := fmt.Sprintf("%s%s", uuid.New().String(), ext)
+	dateFolder := time.Now().Format("2006/01/02")
+	// 开启图片审核的用户上传的图片保存在 review/ 下，通过审核前不能从 /uploads 直接访问
+	storageKey := reviewStorageKey(path.Join(dateFolder, newFileName), !user.EnableImageReview)
+
+	// 保存文件
+	if err := storage.Default.Put(ctx, storageKey, bytes.NewReader(data), int64(len(data)), mimeType); err != nil {
+		return nil, errors.New("文件保存失败")
+	}
+
+	// 加了水印时保留原图，供所有者下载
+	var originalKey string
+	var originalSize int64
+	if watermarked {
+		originalKey = path.Join("originals", dateFolder, uuid.New().String()+detected.Ext)
+		originalSize = int64(len(file.Data))
+		if err := storage.Default.Put(ctx, originalKey, bytes.NewReader(file.Data), originalSize, detected.MimeType); err != nil {
+			storage.Default.Delete(ctx, storageKey)
+			return nil, errors.New("原图保存失败")
+		}
+	}
+
+	// 创建数据库记录
+	image := &models.Image{
+		UserID:       user.ID,
+		FileName:     newFileName,
+		OriginalName: file.Name,
+		FilePath:     storageKey,
+		FileSize:     int64(len(data)),
+		MimeType:     mimeType,
+		Width:        result.Width,
+		Height:       result.Height,
+		Hash:         hashStr,
+		OriginalHash: originalHash,
+		OriginalPath: originalKey,
+		OriginalSize: originalSize,
+		IsPublic:     true,
+		ReviewStatus: models.ReviewApproved,
+		Exif:         imageproc.ExtractExif(file.Data), // 处理后的图片可能已去除 EXIF，从原始文件读取
+	}
+	// 开启图片审核的用户上传的图片需要管理员审核后才能公开访问
+	if user.EnableImageReview {
+		image.ReviewStatus = models.ReviewPending
+	}
+
+	if err := models.CreateImage(image); err != nil {
+		deleteImageFiles(ctx, image) // 删除已保存的文件
+		return nil, errors.New("数据库保存失败")
+	}
+
+	// 生成缩略图等衍生尺寸
+	generateVariants(ctx, image, data)
+
+	return image, nil
+}
+
+// detectImage 识别上传文件的真实格式，并检查是否允许上传、扩展名是否与内容一致
+func detectImage(file uploadFile, policy uploadPolicy) (*imageproc.Detected, error) {
+	detected, err := imageproc.Detect(file.Data)
+	if err != nil {
+		if errors.Is(err, imageproc.ErrCorruptImage) {
+			return nil, errors.New("图片文件已损坏")
+		}
+		if errors.Is(err, imageproc.ErrTooManyPixels) {
+			return nil, fmt.Errorf("图片尺寸过大，最多 %d 万像素", config.AppConfig.Upload.MaxPixels/10000)
+		}
+		return nil, errors.New("不支持的文件类型")
+	}
+	if err := policy.CheckFormat(detected.Format); err != nil {
+		return nil, err
+	}
+	if !detected.MatchesExt(filepath.Ext(file.Name)) {
+		return nil, errors.New("文件扩展名与内容不符")
+	}
+	return detected, nil
+}
+
+// checkStorageQuota 检查再保存 size 字节后是否超出用户的存储配额
+func checkStorageQuota(user *models.User, size int64) error {
+	if user.StorageQuota <= 0 {
+		return nil
+	}
+	storageUsed, err := models.GetUserStorageUsed(user.ID)
+	if err != nil {
+		return errors.New("获取存储使用量失败")
+	}
+	if storageUsed+size > user.StorageQuota {
+		return errors.New("存储空间不足")
+	}
+	return nil
+}
+
+// loadWatermarkImage 从存储后端读取并解码水印图片
+func loadWatermarkImage(ctx context.Context, key string) (image.Image, error) {
+	rc, _, err := storage.Default.Get(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+
+	img, _, err := image.Decode(rc)
+	return img, err
+}
+
+// deleteImageFiles 删除图片在存储后端中的所有文件
+func deleteImageFiles(ctx context.Context, image *models.Image) {
+	storage.Default.Delete(ctx, image.FilePath)
+	if image.OriginalPath != "" {
+		storage.Default.Delete(ctx, image.OriginalPath)
+	}
+	if image.ID != 0 {
+		deleteImageVariants(ctx, image.ID)
+	}
+	deleteTransformCache(image.UUID)
+}
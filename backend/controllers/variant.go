@@ -0,0 +1,120 @@
+package controllers
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"gotux/config"
+	"gotux/imageproc"
+	"gotux/models"
+	"gotux/storage"
+	"io"
+	"log"
+	"path"
+	"strings"
+)
+
+// errUnknownVariant 请求了未配置的衍生尺寸
+var errUnknownVariant = errors.New("unknown variant")
+
+// generateVariants 上传时为图片生成所有配置的衍生尺寸，失败只记录日志
+func generateVariants(ctx context.Context, image *models.Image, data []byte) {
+	if config.AppConfig.Upload.LazyVariants {
+		return
+	}
+
+	for _, cfg := range config.AppConfig.Upload.Variants {
+		variant, err := createVariant(ctx, image, cfg, data)
+		if err != nil {
+			log.Printf("生成图片 %d 的衍生图 %s 失败: %v", image.ID, cfg.Name, err)
+			continue
+		}
+		if variant != nil {
+			image.Variants = append(image.Variants, *variant)
+		}
+	}
+}
+
+// getOrCreateVariant 获取图片的衍生图，不存在时从存储的文件生成；
+// 图片本身不超过该尺寸时返回 nil，调用方应直接使用原图
+func getOrCreateVariant(ctx context.Context, image *models.Image, name string) (*models.ImageVariant, error) {
+	cfg, ok := config.AppConfig.Upload.GetVariant(name)
+	if !ok {
+		return nil, errUnknownVariant
+	}
+
+	if variant, err := models.GetImageVariant(image.ID, name); err == nil {
+		return variant, nil
+	}
+	if fitsWithin(image.Width, image.Height, cfg.Size) {
+		return nil, nil
+	}
+
+	rc, _, err := storage.Default.Get(ctx, image.FilePath)
+	if err != nil {
+		return nil, err
+	}
+	data, err := io.ReadAll(rc)
+	rc.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	return createVariant(ctx, image, cfg, data)
+}
+
+// createVariant 生成并保存一个衍生图，图片不超过该尺寸时不生成并返回 nil
+func createVariant(ctx context.Context, image *models.Image, cfg config.VariantConfig, data []byte) (*models.ImageVariant, error) {
+	if fitsWithin(image.Width, image.Height, cfg.Size) {
+		return nil, nil
+	}
+
+	result, err := imageproc.Resize(data, cfg.Size)
+	if err != nil {
+		return nil, err
+	}
+
+	// variants/<name>/2006/01/02/<uuid>.jpg，未通过审核的图片与原图一样带 review/ 前缀
+	base, inReview := strings.CutPrefix(image.FilePath, models.ReviewKeyPrefix)
+	base = strings.TrimSuffix(base, path.Ext(base))
+	key := reviewStorageKey(path.Join("variants", cfg.Name, base+result.Ext), !inReview)
+	if err := storage.Default.Put(ctx, key, bytes.NewReader(result.Data), int64(len(result.Data)), result.MimeType); err != nil {
+		return nil, err
+	}
+
+	variant := &models.ImageVariant{
+		ImageID:  image.ID,
+		Name:     cfg.Name,
+		FilePath: key,
+		FileSize: int64(len(result.Data)),
+		MimeType: result.MimeType,
+		Width:    result.Width,
+		Height:   result.Height,
+	}
+	if err := models.CreateImageVariant(variant); err != nil {
+		// 并发请求可能已经生成了同一衍生图，此时文件路径相同，不能删除
+		if existing, getErr := models.GetImageVariant(image.ID, cfg.Name); getErr == nil {
+			return existing, nil
+		}
+		storage.Default.Delete(ctx, key)
+		return nil, err
+	}
+	return variant, nil
+}
+
+// deleteImageVariants 删除图片的所有衍生图文件及记录
+func deleteImageVariants(ctx context.Context, imageID uint) {
+	variants, err := models.GetImageVariants(imageID)
+	if err != nil {
+		return
+	}
+	for _, variant := range variants {
+		storage.Default.Delete(ctx, variant.FilePath)
+	}
+	models.DeleteImageVariants(imageID)
+}
+
+// fitsWithin 图片尺寸是否已不超过 size（尺寸未知时视为需要生成）
+func fitsWithin(width, height, size int) bool {
+	return width > 0 && height > 0 && width <= size && height <= size
+}
@@ -0,0 +1,123 @@
+package imageproc
+
+import (
+	"bytes"
+	"errors"
+	"gotux/config"
+	"image"
+	"strings"
+)
+
+var (
+	// ErrUnknownFormat 文件头不是支持的图片格式
+	ErrUnknownFormat = errors.New("unknown image format")
+	// ErrCorruptImage 文件头是图片格式，但无法完整解码
+	ErrCorruptImage = errors.New("corrupt image")
+	// ErrTooManyPixels 图片声明的尺寸超过 MaxPixels
+	ErrTooManyPixels = errors.New("image dimensions too large")
+)
+
+// Detected 根据文件内容识别出的图片信息
+type Detected struct {
+	Format   string // jpeg, png, gif, webp
+	MimeType string
+	Ext      string // 保存时使用的扩展名
+	Width    int
+	Height   int
+}
+
+// magicNumbers 各格式的文件头，"?" 匹配任意字节
+var magicNumbers = []struct {
+	format string
+	magic  string
+}{
+	{"jpeg", "\xff\xd8\xff"},
+	{"png", "\x89PNG\r\n\x1a\n"},
+	{"gif", "GIF87a"},
+	{"gif", "GIF89a"},
+	{"webp", "RIFF????WEBPVP8"},
+}
+
+// extensions 各格式可接受的文件扩展名
+var extensions = map[string][]string{
+	"jpeg": {".jpg", ".jpeg", ".jpe", ".jfif"},
+	"png":  {".png"},
+	"gif":  {".gif"},
+	"webp": {".webp"},
+}
+
+// Detect 通过文件头识别图片格式，并完整解码一次以确认文件没有损坏或伪造。
+// 解码前先读取文件头中的尺寸，几 KB 的文件也可以声明极大的尺寸，直接解码会占用大量内存
+func Detect(data []byte) (*Detected, error) {
+	format := sniff(data)
+	if format == "" {
+		return nil, ErrUnknownFormat
+	}
+
+	// 解码器识别的格式必须与文件头一致
+	cfg, decodedFormat, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil || decodedFormat != format {
+		return nil, ErrCorruptImage
+	}
+	if maxPixels := config.AppConfig.Upload.MaxPixels; maxPixels > 0 && int64(cfg.Width)*int64(cfg.Height) > maxPixels {
+		return nil, ErrTooManyPixels
+	}
+
+	img, decodedFormat, err := image.Decode(bytes.NewReader(data))
+	if err != nil || decodedFormat != format {
+		return nil, ErrCorruptImage
+	}
+
+	bounds := img.Bounds()
+	info := formatInfo[format]
+	return &Detected{
+		Format:   format,
+		MimeType: info.mimeType,
+		Ext:      info.ext,
+		Width:    bounds.Dx(),
+		Height:   bounds.Dy(),
+	}, nil
+}
+
+// MatchesExt 文件扩展名是否与识别出的格式一致，没有扩展名时视为一致
+func (d *Detected) MatchesExt(ext string) bool {
+	if ext == "" {
+		return true
+	}
+	ext = strings.ToLower(ext)
+	for _, e := range extensions[d.Format] {
+		if e == ext {
+			return true
+		}
+	}
+	return false
+}
+
+// SniffExt 只根据文件头返回对应的扩展名，无法识别时返回空字符串
+func SniffExt(data []byte) string {
+	if format := sniff(data); format != "" {
+		return formatInfo[format].ext
+	}
+	return ""
+}
+
+func sniff(data []byte) string {
+	for _, m := range magicNumbers {
+		if matchMagic(data, m.magic) {
+			return m.format
+		}
+	}
+	return ""
+}
+
+func matchMagic(data []byte, magic string) bool {
+	if len(data) < len(magic) {
+		return false
+	}
+	for i := 0; i < len(magic); i++ {
+		if magic[i] != '?' && data[i] != magic[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,66 @@
+package imageproc
+
+import (
+	"bytes"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/rwcarlsen/goexif/exif"
+	"github.com/rwcarlsen/goexif/tiff"
+)
+
+// exifFields 保存并用于搜索的 EXIF 文本字段，不包含 GPS 等隐私信息
+var exifFields = []exif.FieldName{
+	exif.Make,
+	exif.Model,
+	exif.LensMake,
+	exif.LensModel,
+	exif.Software,
+	exif.DateTimeOriginal,
+	exif.Artist,
+	exif.Copyright,
+	exif.ImageDescription,
+}
+
+// maxExifValueLength 单个字段保存的最大字符数
+const maxExifValueLength = 200
+
+// ExtractExif 读取图片中常用的 EXIF 文本字段，没有 EXIF 或无法解析时返回 nil。
+// 需要传入原始文件，重新编码后 EXIF 已经丢失
+func ExtractExif(data []byte) (fields map[string]string) {
+	// 上传的文件不可信，解析库遇到畸形数据可能 panic
+	defer func() {
+		if recover() != nil {
+			fields = nil
+		}
+	}()
+
+	x, err := exif.Decode(bytes.NewReader(data))
+	if err != nil && x == nil {
+		return nil
+	}
+
+	fields = make(map[string]string)
+	for _, name := range exifFields {
+		tag, err := x.Get(name)
+		if err != nil || tag.Format() != tiff.StringVal {
+			continue
+		}
+		value, err := tag.StringVal()
+		if err != nil {
+			continue
+		}
+		value = strings.TrimSpace(strings.ToValidUTF8(strings.Trim(value, "\x00"), ""))
+		if value == "" {
+			continue
+		}
+		if utf8.RuneCountInString(value) > maxExifValueLength {
+			value = string([]rune(value)[:maxExifValueLength])
+		}
+		fields[string(name)] = value
+	}
+	if len(fields) == 0 {
+		return nil
+	}
+	return fields
+}
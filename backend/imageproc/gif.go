@@ -0,0 +1,153 @@
+package imageproc
+
+import (
+	"bytes"
+	"errors"
+	"gotux/config"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/gif"
+)
+
+// ErrAnimationTooLarge 动图的帧数乘以画布尺寸超过 MaxPixels，逐帧添加水印会占用过多内存
+var ErrAnimationTooLarge = errors.New("animation too large to watermark")
+
+// watermarkGIF 为 GIF 的每一帧添加水印并保留动画。
+// 每一帧都合成为完整画布后再叠加水印，颜色映射到该帧原有的调色板
+func watermarkGIF(data []byte, opts Options) ([]byte, int, int, error) {
+	cfg, err := gif.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, 0, 0, err
+	}
+	frames, err := gifFrameCount(data)
+	if err != nil {
+		return nil, 0, 0, err
+	}
+	if maxPixels := config.AppConfig.Upload.MaxPixels; maxPixels > 0 &&
+		int64(frames)*int64(cfg.Width)*int64(cfg.Height) > maxPixels {
+		return nil, 0, 0, ErrAnimationTooLarge
+	}
+
+	g, err := gif.DecodeAll(bytes.NewReader(data))
+	if err != nil {
+		return nil, 0, 0, err
+	}
+	bounds := image.Rect(0, 0, g.Config.Width, g.Config.Height)
+
+	// 水印只在透明图层上绘制一次，再叠加到每一帧
+	var overlay image.Image = image.NewNRGBA(bounds)
+	if opts.ImageWatermark != nil {
+		overlay = DrawImageWatermark(overlay, *opts.ImageWatermark)
+	}
+	if opts.TextWatermark != nil {
+		if overlay, err = DrawTextWatermark(overlay, *opts.TextWatermark); err != nil {
+			return nil, 0, 0, err
+		}
+	}
+
+	canvas := image.NewRGBA(bounds)
+	composed := image.NewRGBA(bounds)
+	for i, frame := range g.Image {
+		var previous *image.RGBA
+		if g.Disposal[i] == gif.DisposalPrevious {
+			previous = image.NewRGBA(bounds)
+			copy(previous.Pix, canvas.Pix)
+		}
+
+		draw.Draw(canvas, frame.Bounds(), frame, frame.Bounds().Min, draw.Over)
+		copy(composed.Pix, canvas.Pix)
+		draw.Draw(composed, bounds, overlay, bounds.Min, draw.Over)
+
+		out := image.NewPaletted(bounds, withTransparent(frame.Palette))
+		draw.Draw(out, bounds, composed, bounds.Min, draw.Src)
+
+		switch g.Disposal[i] {
+		case gif.DisposalBackground:
+			draw.Draw(canvas, frame.Bounds(), image.Transparent, image.Point{}, draw.Src)
+		case gif.DisposalPrevious:
+			canvas = previous
+		}
+
+		// 输出的每一帧都是完整画布，显示下一帧前需要清空
+		g.Image[i] = out
+		g.Disposal[i] = gif.DisposalBackground
+	}
+
+	var buf bytes.Buffer
+	if err := gif.EncodeAll(&buf, g); err != nil {
+		return nil, 0, 0, err
+	}
+	return buf.Bytes(), bounds.Dx(), bounds.Dy(), nil
+}
+
+// gifFrameCount 只遍历 GIF 的数据块统计帧数，不解压图像数据
+func gifFrameCount(data []byte) (int, error) {
+	errFormat := errors.New("gif: invalid block structure")
+	if len(data) < 13 {
+		return 0, errFormat
+	}
+
+	// 文件头 6 字节，逻辑屏幕描述符 7 字节，之后可能是全局调色板
+	pos := 13
+	if flags := data[10]; flags&0x80 != 0 {
+		pos += 3 << (flags&0x07 + 1)
+	}
+
+	// skipSubBlocks 跳过以 0 长度结尾的数据子块
+	skipSubBlocks := func() bool {
+		for pos < len(data) {
+			n := int(data[pos])
+			pos += 1 + n
+			if n == 0 {
+				return true
+			}
+		}
+		return false
+	}
+
+	frames := 0
+	for pos < len(data) {
+		switch data[pos] {
+		case 0x21: // 扩展块：标签后跟数据子块
+			pos += 2
+			if !skipSubBlocks() {
+				return 0, errFormat
+			}
+		case 0x2c: // 图像描述符 10 字节，可能带局部调色板，之后是 LZW 最小码长和图像数据子块
+			if pos+10 > len(data) {
+				return 0, errFormat
+			}
+			flags := data[pos+9]
+			pos += 10
+			if flags&0x80 != 0 {
+				pos += 3 << (flags&0x07 + 1)
+			}
+			pos++
+			if !skipSubBlocks() {
+				return 0, errFormat
+			}
+			frames++
+		case 0x3b: // 文件结束
+			return frames, nil
+		default:
+			return 0, errFormat
+		}
+	}
+	// 缺少结束标记时由之后的完整解码报错
+	return frames, nil
+}
+
+// withTransparent 调色板中没有透明色且还有空位时补充一个，
+// 帧没有覆盖的画布区域需要保持透明
+func withTransparent(p color.Palette) color.Palette {
+	for _, c := range p {
+		if _, _, _, a := c.RGBA(); a == 0 {
+			return p
+		}
+	}
+	if len(p) >= 256 {
+		return p
+	}
+	return append(append(color.Palette(nil), p...), color.Transparent)
+}
@@ -0,0 +1,194 @@
+package imageproc
+
+import (
+	"bytes"
+	"image"
+	"image/jpeg"
+	"image/png"
+
+	"github.com/disintegration/imaging"
+	_ "golang.org/x/image/webp"
+)
+
+// Options 上传处理选项
+type Options struct {
+	Compress       bool            // 是否重新编码压缩
+	Quality        int             // JPEG 压缩质量 (1-100)
+	TextWatermark  *TextWatermark  // 文字水印，nil 表示不添加
+	ImageWatermark *ImageWatermark // 图片水印，nil 表示不添加
+}
+
+// hasWatermark 是否需要添加水印
+func (o Options) hasWatermark() bool {
+	return o.TextWatermark != nil || o.ImageWatermark != nil
+}
+
+// defaultQuality 未开启压缩但需要重新编码（如添加水印）时使用的 JPEG 质量
+const defaultQuality = 92
+
+// Result 处理结果
+type Result struct {
+	Data         []byte
+	Format       string // 输出格式: jpeg, png, gif, webp
+	SourceFormat string // 原始格式
+	MimeType     string
+	Ext          string
+	Width        int
+	Height       int
+	Reencoded    bool // Data 是否为重新编码后的数据
+}
+
+var formatInfo = map[string]struct {
+	mimeType string
+	ext      string
+}{
+	"jpeg": {"image/jpeg", ".jpg"},
+	"png":  {"image/png", ".png"},
+	"gif":  {"image/gif", ".gif"},
+	"webp": {"image/webp", ".webp"},
+}
+
+// Process 按选项处理上传的图片
+//
+// 无需处理或仅压缩但体积反而变大时返回原始数据。GIF 可能包含动画，不压缩，
+// 添加水印时逐帧处理并保留动画；
+// WebP 只能无损编码，体积较大，重新编码时无透明通道转为 JPEG，否则转为 PNG。
+func Process(data []byte, opts Options) (*Result, error) {
+	cfg, format, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+
+	original := newResult(data, format, cfg.Width, cfg.Height)
+	original.SourceFormat = format
+	if !opts.hasWatermark() && (format == "gif" || !opts.Compress) {
+		return original, nil
+	}
+	if format == "gif" {
+		encoded, width, height, err := watermarkGIF(data, opts)
+		if err != nil {
+			return nil, err
+		}
+		result := newResult(encoded, format, width, height)
+		result.SourceFormat = format
+		result.Reencoded = true
+		return result, nil
+	}
+
+	// 重新编码会丢失 EXIF，需要先按方向信息旋转
+	var img image.Image
+	img, err = imaging.Decode(bytes.NewReader(data), imaging.AutoOrientation(true))
+	if err != nil {
+		return nil, err
+	}
+
+	modified := false
+	if opts.ImageWatermark != nil {
+		img = DrawImageWatermark(img, *opts.ImageWatermark)
+		modified = true
+	}
+	if opts.TextWatermark != nil {
+		if img, err = DrawTextWatermark(img, *opts.TextWatermark); err != nil {
+			return nil, err
+		}
+		modified = true
+	}
+
+	outFormat := format
+	if format == "webp" {
+		outFormat = "png"
+		if isOpaque(img) {
+			outFormat = "jpeg"
+		}
+	}
+
+	quality := defaultQuality
+	if opts.Compress {
+		quality = opts.Quality
+	}
+	encoded, err := encode(img, outFormat, quality, opts.Compress)
+	if err != nil {
+		return nil, err
+	}
+	if !modified && len(encoded) >= len(data) {
+		return original, nil
+	}
+
+	bounds := img.Bounds()
+	result := newResult(encoded, outFormat, bounds.Dx(), bounds.Dy())
+	result.SourceFormat = format
+	result.Reencoded = true
+	return result, nil
+}
+
+func newResult(data []byte, format string, width, height int) *Result {
+	info := formatInfo[format]
+	return &Result{
+		Data:     data,
+		Format:   format,
+		MimeType: info.mimeType,
+		Ext:      info.ext,
+		Width:    width,
+		Height:   height,
+	}
+}
+
+func encode(img image.Image, format string, quality int, compress bool) ([]byte, error) {
+	if quality < 1 || quality > 100 {
+		quality = 80
+	}
+
+	var buf bytes.Buffer
+	var err error
+	switch format {
+	case "png":
+		level := png.DefaultCompression
+		if compress {
+			level = png.BestCompression
+		}
+		err = imaging.Encode(&buf, img, imaging.PNG, imaging.PNGCompressionLevel(level))
+	case "webp":
+		err = EncodeWebP(&buf, img)
+	default:
+		err = jpeg.Encode(&buf, img, &jpeg.Options{Quality: quality})
+	}
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// isOpaque 判断图片是否没有透明像素
+func isOpaque(img image.Image) bool {
+	if o, ok := img.(interface{ Opaque() bool }); ok {
+		return o.Opaque()
+	}
+	return false
+}
+
+// variantQuality 衍生图的 JPEG 质量
+const variantQuality = 85
+
+// Resize 生成最长边不超过 size 的衍生图（不放大），透明图片输出 PNG，其余输出 JPEG
+func Resize(data []byte, size int) (*Result, error) {
+	img, err := imaging.Decode(bytes.NewReader(data), imaging.AutoOrientation(true))
+	if err != nil {
+		return nil, err
+	}
+
+	resized := imaging.Fit(img, size, size, imaging.Lanczos)
+
+	format := "png"
+	if isOpaque(resized) {
+		format = "jpeg"
+	}
+	encoded, err := encode(resized, format, variantQuality, false)
+	if err != nil {
+		return nil, err
+	}
+
+	bounds := resized.Bounds()
+	result := newResult(encoded, format, bounds.Dx(), bounds.Dy())
+	result.Reencoded = true
+	return result, nil
+}
@@ -0,0 +1,117 @@
+package imageproc
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+
+	"github.com/disintegration/imaging"
+)
+
+// MaxTransformSize 按需处理时允许的最大宽高
+const MaxTransformSize = 8192
+
+// Transform 按需处理参数
+type Transform struct {
+	Width   int    // 目标宽度，0 表示按高度等比缩放
+	Height  int    // 目标高度，0 表示按宽度等比缩放
+	Fit     string // 同时指定宽高时的缩放方式: cover（裁剪填满）、contain（完整显示，默认）
+	Quality int    // JPEG 质量 (1-100)，0 使用默认值
+	Format  string // 输出格式: jpeg, png, webp，为空保持原格式
+}
+
+// Normalize 校验参数并补全默认值，sourceMimeType 用于确定未指定时的输出格式
+func (t Transform) Normalize(sourceMimeType string) (Transform, error) {
+	if t.Width < 0 || t.Height < 0 || t.Width > MaxTransformSize || t.Height > MaxTransformSize {
+		return t, fmt.Errorf("size must be between 0 and %d", MaxTransformSize)
+	}
+	if t.Quality < 0 || t.Quality > 100 {
+		return t, errors.New("quality must be between 1 and 100")
+	}
+
+	switch t.Fit {
+	case "", "contain", "cover":
+	default:
+		return t, fmt.Errorf("unsupported fit %q", t.Fit)
+	}
+	if t.Width == 0 || t.Height == 0 {
+		t.Fit = ""
+	} else if t.Fit == "" {
+		t.Fit = "contain"
+	}
+
+	switch t.Format {
+	case "jpeg", "png", "webp":
+	case "jpg":
+		t.Format = "jpeg"
+	case "":
+		t.Format = DefaultFormat(sourceMimeType)
+	default:
+		return t, fmt.Errorf("unsupported format %q", t.Format)
+	}
+
+	// 质量只对 JPEG 有效，其他格式统一为 0 以免产生重复缓存
+	if t.Format != "jpeg" {
+		t.Quality = 0
+	} else if t.Quality == 0 {
+		t.Quality = variantQuality
+	}
+	return t, nil
+}
+
+// Key 返回参数的规范表示，可用作缓存文件名（需先调用 Normalize）
+func (t Transform) Key() string {
+	key := fmt.Sprintf("w%d_h%d", t.Width, t.Height)
+	if t.Fit != "" {
+		key += "_" + t.Fit
+	}
+	if t.Quality != 0 {
+		key += fmt.Sprintf("_q%d", t.Quality)
+	}
+	return key + formatInfo[t.Format].ext
+}
+
+// DefaultFormat 返回未指定输出格式时使用的格式，GIF 只输出第一帧，因此转为 PNG
+func DefaultFormat(mimeType string) string {
+	switch mimeType {
+	case "image/jpeg":
+		return "jpeg"
+	case "image/webp":
+		return "webp"
+	default:
+		return "png"
+	}
+}
+
+// Apply 按参数缩放并转换格式，t 需先调用 Normalize
+//
+// 同时指定宽高时 cover 裁剪居中部分填满目标尺寸，contain 完整缩放到目标尺寸内；
+// 只指定一边时等比缩放。除 cover 外都不会放大图片。
+func Apply(data []byte, t Transform) (*Result, error) {
+	img, err := imaging.Decode(bytes.NewReader(data), imaging.AutoOrientation(true))
+	if err != nil {
+		return nil, err
+	}
+
+	bounds := img.Bounds()
+	switch {
+	case t.Width > 0 && t.Height > 0 && t.Fit == "cover":
+		img = imaging.Fill(img, t.Width, t.Height, imaging.Center, imaging.Lanczos)
+	case t.Width > 0 && t.Height > 0:
+		img = imaging.Fit(img, t.Width, t.Height, imaging.Lanczos)
+	case t.Width > 0 && t.Width < bounds.Dx():
+		img = imaging.Resize(img, t.Width, 0, imaging.Lanczos)
+	case t.Height > 0 && t.Height < bounds.Dy():
+		img = imaging.Resize(img, 0, t.Height, imaging.Lanczos)
+	}
+
+	encoded, err := encode(img, t.Format, t.Quality, false)
+	if err != nil {
+		return nil, err
+	}
+
+	bounds = img.Bounds()
+	result := newResult(encoded, t.Format, bounds.Dx(), bounds.Dy())
+	result.Reencoded = true
+	return result, nil
+}
@@ -0,0 +1,218 @@
+package imageproc
+
+import (
+	"fmt"
+	"gotux/config"
+	"image"
+	"image/color"
+	"image/draw"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/disintegration/imaging"
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/gofont/goregular"
+	"golang.org/x/image/font/opentype"
+	"golang.org/x/image/math/fixed"
+)
+
+// TextWatermark 文字水印
+type TextWatermark struct {
+	Text     string
+	Position string  // top-left, top-center, top-right, middle-left, center, middle-right, bottom-left, bottom-center, bottom-right
+	Opacity  float64 // 0-1
+}
+
+// ImageWatermark 图片水印（如 Logo）
+type ImageWatermark struct {
+	Logo     image.Image
+	Position string  // 与 TextWatermark 相同的九宫格位置
+	Scale    float64 // Logo 宽度占图片宽度的比例 (0-1]
+	Margin   int     // 距图片边缘的距离（像素）
+	Opacity  float64 // 0-1
+}
+
+// watermarkFont 水印字体，默认使用内置的 Go Regular（不含中文字形）
+var watermarkFont = mustParseFont(goregular.TTF)
+
+// InitFont 加载水印字体，配置了 WATERMARK_FONT 时使用外部字体（如需显示中文）
+func InitFont() {
+	path := config.AppConfig.Upload.WatermarkFont
+	if path == "" {
+		return
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		log.Fatal("Failed to read watermark font:", err)
+	}
+	f, err := opentype.Parse(data)
+	if err != nil {
+		log.Fatal("Failed to parse watermark font:", err)
+	}
+	watermarkFont = f
+}
+
+func mustParseFont(data []byte) *opentype.Font {
+	f, err := opentype.Parse(data)
+	if err != nil {
+		panic(err)
+	}
+	return f
+}
+
+// DrawTextWatermark 在图片上绘制文字水印，字号按图片短边缩放
+func DrawTextWatermark(img image.Image, wm TextWatermark) (*image.NRGBA, error) {
+	text := strings.TrimSpace(wm.Text)
+	dst := imaging.Clone(img)
+	if text == "" {
+		return dst, nil
+	}
+
+	bounds := dst.Bounds()
+	shortSide := bounds.Dx()
+	if bounds.Dy() < shortSide {
+		shortSide = bounds.Dy()
+	}
+	size := clampFloat(float64(shortSide)*0.05, 12, 256)
+
+	face, err := newFace(size)
+	if err != nil {
+		return nil, err
+	}
+
+	// 文字过长时缩小字号，保证完整显示
+	margin := watermarkMargin(size)
+	textWidth := font.MeasureString(face, text).Ceil()
+	if maxWidth := bounds.Dx() - 2*margin; textWidth > maxWidth && maxWidth > 0 {
+		size = clampFloat(size*float64(maxWidth)/float64(textWidth), 6, 256)
+		face.Close()
+		if face, err = newFace(size); err != nil {
+			return nil, err
+		}
+		margin = watermarkMargin(size)
+		textWidth = font.MeasureString(face, text).Ceil()
+	}
+	defer face.Close()
+
+	metrics := face.Metrics()
+	textHeight := (metrics.Ascent + metrics.Descent).Ceil()
+	origin := placeRect(bounds, textWidth, textHeight, margin, wm.Position)
+
+	alpha := uint8(clampFloat(wm.Opacity, 0, 1) * 255)
+	baseline := fixed.P(origin.X, origin.Y+metrics.Ascent.Ceil())
+
+	// 先绘制阴影，保证在浅色背景上也能看清
+	shadowOffset := fixed.I(int(size/24) + 1)
+	drawText(dst, face, text, fixed.Point26_6{X: baseline.X + shadowOffset, Y: baseline.Y + shadowOffset}, color.NRGBA{0, 0, 0, alpha / 2})
+	drawText(dst, face, text, baseline, color.NRGBA{255, 255, 255, alpha})
+
+	return dst, nil
+}
+
+// DrawImageWatermark 将 Logo 按比例缩放后叠加到图片上
+func DrawImageWatermark(img image.Image, wm ImageWatermark) *image.NRGBA {
+	dst := imaging.Clone(img)
+	if wm.Logo == nil {
+		return dst
+	}
+
+	bounds := dst.Bounds()
+	logoBounds := wm.Logo.Bounds()
+	if logoBounds.Dx() == 0 || logoBounds.Dy() == 0 {
+		return dst
+	}
+
+	// 按图片宽度缩放，同时不超过图片高度的相同比例
+	scale := clampFloat(wm.Scale, 0.01, 1)
+	width := int(float64(bounds.Dx()) * scale)
+	height := width * logoBounds.Dy() / logoBounds.Dx()
+	if maxHeight := int(float64(bounds.Dy()) * scale); height > maxHeight {
+		height = maxHeight
+		width = height * logoBounds.Dx() / logoBounds.Dy()
+	}
+	if width < 1 || height < 1 {
+		return dst
+	}
+
+	logo := imaging.Resize(wm.Logo, width, height, imaging.Lanczos)
+	margin := wm.Margin
+	if margin < 0 {
+		margin = 0
+	}
+	origin := placeRect(bounds, width, height, margin, wm.Position)
+
+	return imaging.Overlay(dst, logo, origin, clampFloat(wm.Opacity, 0, 1))
+}
+
+func newFace(size float64) (font.Face, error) {
+	face, err := opentype.NewFace(watermarkFont, &opentype.FaceOptions{
+		Size:    size,
+		DPI:     72,
+		Hinting: font.HintingFull,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("create font face: %w", err)
+	}
+	return face, nil
+}
+
+func drawText(dst draw.Image, face font.Face, text string, dot fixed.Point26_6, c color.Color) {
+	d := &font.Drawer{
+		Dst:  dst,
+		Src:  image.NewUniform(c),
+		Face: face,
+		Dot:  dot,
+	}
+	d.DrawString(text)
+}
+
+func watermarkMargin(size float64) int {
+	margin := int(size / 2)
+	if margin < 4 {
+		margin = 4
+	}
+	return margin
+}
+
+// placeRect 按九宫格位置计算宽 w、高 h 的矩形在 bounds 中的左上角坐标
+func placeRect(bounds image.Rectangle, w, h, margin int, position string) image.Point {
+	vertical, horizontal := "bottom", "right"
+	switch position {
+	case "center":
+		vertical, horizontal = "middle", "center"
+	default:
+		if parts := strings.SplitN(position, "-", 2); len(parts) == 2 {
+			vertical, horizontal = parts[0], parts[1]
+		}
+	}
+
+	x := bounds.Max.X - w - margin
+	switch horizontal {
+	case "left":
+		x = bounds.Min.X + margin
+	case "center":
+		x = bounds.Min.X + (bounds.Dx()-w)/2
+	}
+
+	y := bounds.Max.Y - h - margin
+	switch vertical {
+	case "top":
+		y = bounds.Min.Y + margin
+	case "middle":
+		y = bounds.Min.Y + (bounds.Dy()-h)/2
+	}
+
+	return image.Pt(x, y)
+}
+
+func clampFloat(v, min, max float64) float64 {
+	if v < min {
+		return min
+	}
+	if v > max {
+		return max
+	}
+	return v
+}
@@ -0,0 +1,468 @@
+package imageproc
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"image"
+	"image/draw"
+	"io"
+	"sort"
+)
+
+// EncodeWebP 将图片编码为无损 WebP (VP8L)
+//
+// 这是一个精简实现：只使用减绿变换和预测变换，再对残差做熵编码，
+// 不使用颜色缓存和向后引用，压缩率不如 libwebp，但不依赖 cgo。
+func EncodeWebP(w io.Writer, img image.Image) error {
+	bounds := img.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	if width < 1 || height < 1 || width > 1<<14 || height > 1<<14 {
+		return errors.New("webp: invalid image size")
+	}
+
+	nrgba := image.NewNRGBA(image.Rect(0, 0, width, height))
+	draw.Draw(nrgba, nrgba.Bounds(), img, bounds.Min, draw.Src)
+	pix := nrgba.Pix // 紧凑排列的 RGBA
+
+	hasAlpha := false
+	for i := 3; i < len(pix); i += 4 {
+		if pix[i] != 0xff {
+			hasAlpha = true
+			break
+		}
+	}
+
+	bw := &bitWriter{}
+	bw.write(0x2f, 8) // VP8L 签名
+	bw.write(uint32(width-1), 14)
+	bw.write(uint32(height-1), 14)
+	if hasAlpha {
+		bw.write(1, 1)
+	} else {
+		bw.write(0, 1)
+	}
+	bw.write(0, 3) // 版本号
+
+	// 减绿变换：红、蓝通道减去绿色通道
+	for i := 0; i < len(pix); i += 4 {
+		pix[i] -= pix[i+1]
+		pix[i+2] -= pix[i+1]
+	}
+	bw.write(1, 1)
+	bw.write(webpSubtractGreenTransform, 2)
+
+	// 预测变换：按块选择预测模式，只保留残差
+	modes, residuals := applyPredictor(pix, width, height)
+	bw.write(1, 1)
+	bw.write(webpPredictorTransform, 2)
+	bw.write(webpPredictorBlockBits-2, 3)
+	writeEntropyImage(bw, modes, false)
+
+	bw.write(0, 1) // 没有更多变换
+	writeEntropyImage(bw, residuals, true)
+	data := bw.bytes()
+
+	// RIFF 容器，块大小为奇数时需要补齐
+	chunkSize := len(data)
+	padding := chunkSize & 1
+	header := make([]byte, 20)
+	copy(header[0:], "RIFF")
+	binary.LittleEndian.PutUint32(header[4:], uint32(4+8+chunkSize+padding))
+	copy(header[8:], "WEBPVP8L")
+	binary.LittleEndian.PutUint32(header[16:], uint32(chunkSize))
+
+	if _, err := w.Write(header); err != nil {
+		return err
+	}
+	if _, err := w.Write(data); err != nil {
+		return err
+	}
+	if padding == 1 {
+		_, err := w.Write([]byte{0})
+		return err
+	}
+	return nil
+}
+
+const (
+	webpPredictorTransform     = 0
+	webpSubtractGreenTransform = 2
+
+	// webpPredictorBlockBits 预测模式块大小为 2^5 = 32 像素
+	webpPredictorBlockBits = 5
+)
+
+// webpPredictorModes 候选预测模式：左、上、左上平均、梯度
+var webpPredictorModes = []int{1, 2, 7, 12}
+
+// applyPredictor 为每个块选择残差最小的预测模式，返回模式子图和残差图（均为 RGBA）
+func applyPredictor(pix []uint8, width, height int) ([]uint8, []uint8) {
+	blockSize := 1 << webpPredictorBlockBits
+	blocksX := (width + blockSize - 1) / blockSize
+	blocksY := (height + blockSize - 1) / blockSize
+
+	modes := make([]uint8, blocksX*blocksY*4)
+	residuals := make([]uint8, len(pix))
+
+	for by := 0; by < blocksY; by++ {
+		for bx := 0; bx < blocksX; bx++ {
+			x0, y0 := bx*blockSize, by*blockSize
+			x1, y1 := min(x0+blockSize, width), min(y0+blockSize, height)
+
+			best, bestCost := webpPredictorModes[0], -1
+			for _, mode := range webpPredictorModes {
+				cost := 0
+				for y := y0; y < y1; y++ {
+					for x := x0; x < x1; x++ {
+						pred := predict(pix, width, x, y, mode)
+						i := (y*width + x) * 4
+						for c := 0; c < 4; c++ {
+							d := int(pix[i+c] - pred[c])
+							if d > 128 {
+								d = 256 - d
+							}
+							cost += d
+						}
+					}
+				}
+				if bestCost < 0 || cost < bestCost {
+					best, bestCost = mode, cost
+				}
+			}
+
+			// 模式保存在子图像素的绿色通道
+			m := (by*blocksX + bx) * 4
+			modes[m+1] = uint8(best)
+			modes[m+3] = 0xff
+
+			for y := y0; y < y1; y++ {
+				for x := x0; x < x1; x++ {
+					pred := predict(pix, width, x, y, best)
+					i := (y*width + x) * 4
+					for c := 0; c < 4; c++ {
+						residuals[i+c] = pix[i+c] - pred[c]
+					}
+				}
+			}
+		}
+	}
+
+	return modes, residuals
+}
+
+// predict 计算 (x, y) 处像素的预测值，首行用左侧像素、首列用上方像素
+func predict(pix []uint8, width, x, y, mode int) [4]uint8 {
+	if x == 0 && y == 0 {
+		return [4]uint8{0, 0, 0, 0xff}
+	}
+	if y == 0 {
+		mode = 1
+	} else if x == 0 {
+		mode = 2
+	}
+
+	at := func(x, y int) [4]uint8 {
+		i := (y*width + x) * 4
+		return [4]uint8{pix[i], pix[i+1], pix[i+2], pix[i+3]}
+	}
+
+	switch mode {
+	case 1:
+		return at(x-1, y)
+	case 2:
+		return at(x, y-1)
+	}
+
+	l, t, tl := at(x-1, y), at(x, y-1), at(x-1, y-1)
+	var p [4]uint8
+	for c := 0; c < 4; c++ {
+		switch mode {
+		case 7:
+			p[c] = uint8((int(l[c]) + int(t[c])) / 2)
+		case 12:
+			p[c] = uint8(clampInt(int(l[c])+int(t[c])-int(tl[c]), 0, 255))
+		}
+	}
+	return p
+}
+
+func clampInt(v, lo, hi int) int {
+	if v < lo {
+		return lo
+	}
+	if v > hi {
+		return hi
+	}
+	return v
+}
+
+// writeEntropyImage 写入熵编码图像，isMain 表示主图（需写入元前缀码标记）
+func writeEntropyImage(bw *bitWriter, pix []uint8, isMain bool) {
+	bw.write(0, 1) // 无颜色缓存
+	if isMain {
+		bw.write(0, 1) // 单一前缀码组
+	}
+
+	// 绿色通道的字母表包含 24 个长度前缀码，这里不会用到
+	var green [256 + 24]int
+	var red, blue, alpha [256]int
+	for i := 0; i < len(pix); i += 4 {
+		red[pix[i]]++
+		green[pix[i+1]]++
+		blue[pix[i+2]]++
+		alpha[pix[i+3]]++
+	}
+
+	greenCode := writePrefixCode(bw, green[:])
+	redCode := writePrefixCode(bw, red[:])
+	blueCode := writePrefixCode(bw, blue[:])
+	alphaCode := writePrefixCode(bw, alpha[:])
+	writePrefixCode(bw, make([]int, 40)) // 距离码，未使用
+
+	for i := 0; i < len(pix); i += 4 {
+		greenCode.write(bw, int(pix[i+1]))
+		redCode.write(bw, int(pix[i]))
+		blueCode.write(bw, int(pix[i+2]))
+		alphaCode.write(bw, int(pix[i+3]))
+	}
+}
+
+// bitWriter 按 LSB 优先的顺序写入比特
+type bitWriter struct {
+	buf   bytes.Buffer
+	acc   uint64
+	nbits uint
+}
+
+func (b *bitWriter) write(value uint32, n uint) {
+	b.acc |= uint64(value) << b.nbits
+	b.nbits += n
+	for b.nbits >= 8 {
+		b.buf.WriteByte(byte(b.acc))
+		b.acc >>= 8
+		b.nbits -= 8
+	}
+}
+
+func (b *bitWriter) bytes() []byte {
+	if b.nbits > 0 {
+		b.buf.WriteByte(byte(b.acc))
+		b.acc, b.nbits = 0, 0
+	}
+	return b.buf.Bytes()
+}
+
+// prefixCode 规范前缀码，codes 已按写入顺序反转
+type prefixCode struct {
+	lengths []int
+	codes   []uint32
+}
+
+func (p *prefixCode) write(bw *bitWriter, symbol int) {
+	if n := p.lengths[symbol]; n > 0 {
+		bw.write(p.codes[symbol], uint(n))
+	}
+}
+
+// codeLengthCodeOrder 码长码的写入顺序
+var codeLengthCodeOrder = [19]int{17, 18, 0, 1, 2, 3, 4, 5, 16, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15}
+
+// writePrefixCode 根据直方图构建前缀码并写入码表，返回用于编码符号的前缀码
+func writePrefixCode(bw *bitWriter, histogram []int) *prefixCode {
+	var used []int
+	for symbol, count := range histogram {
+		if count > 0 {
+			used = append(used, symbol)
+		}
+	}
+
+	// 不超过两个符号且都小于 256 时使用简单码
+	if len(used) <= 2 && (len(used) == 0 || used[len(used)-1] < 256) {
+		code := &prefixCode{lengths: make([]int, len(histogram)), codes: make([]uint32, len(histogram))}
+		bw.write(1, 1)
+		if len(used) == 0 {
+			used = []int{0}
+		}
+		bw.write(uint32(len(used)-1), 1)
+		for i, symbol := range used {
+			if i == 0 {
+				// 第一个符号可以用 1 比特或 8 比特表示
+				if symbol < 2 {
+					bw.write(0, 1)
+					bw.write(uint32(symbol), 1)
+				} else {
+					bw.write(1, 1)
+					bw.write(uint32(symbol), 8)
+				}
+			} else {
+				bw.write(uint32(symbol), 8)
+			}
+		}
+		if len(used) == 2 {
+			code.lengths[used[0]], code.codes[used[0]] = 1, 0
+			code.lengths[used[1]], code.codes[used[1]] = 1, 1
+		}
+		return code
+	}
+
+	lengths := huffmanLengths(histogram, 15)
+	code := canonicalCode(lengths)
+
+	// 码长本身再用一个前缀码（码长码）编码，只使用 0-15 的字面码长
+	lengthHistogram := make([]int, 19)
+	for _, l := range lengths {
+		lengthHistogram[l]++
+	}
+	lengthLengths := huffmanLengths(lengthHistogram, 7)
+	lengthLengths = ensureCompleteCode(lengthLengths)
+	lengthCode := canonicalCode(lengthLengths)
+
+	numCodes := 19
+	for numCodes > 4 && lengthLengths[codeLengthCodeOrder[numCodes-1]] == 0 {
+		numCodes--
+	}
+
+	bw.write(0, 1) // 普通码
+	bw.write(uint32(numCodes-4), 4)
+	for i := 0; i < numCodes; i++ {
+		bw.write(uint32(lengthLengths[codeLengthCodeOrder[i]]), 3)
+	}
+	bw.write(0, 1) // max_symbol 等于字母表大小
+	for _, l := range lengths {
+		lengthCode.write(bw, l)
+	}
+
+	return code
+}
+
+// ensureCompleteCode 只有一个符号有码长时补一个符号，保证是完整的前缀码
+func ensureCompleteCode(lengths []int) []int {
+	nonZero := -1
+	for symbol, l := range lengths {
+		if l > 0 {
+			if nonZero >= 0 {
+				return lengths
+			}
+			nonZero = symbol
+		}
+	}
+	if nonZero < 0 {
+		return lengths
+	}
+
+	lengths[nonZero] = 1
+	if nonZero == 0 {
+		lengths[1] = 1
+	} else {
+		lengths[0] = 1
+	}
+	return lengths
+}
+
+// huffmanLengths 计算码长不超过 maxLength 的哈夫曼码长，超长时压缩频率后重建
+func huffmanLengths(histogram []int, maxLength int) []int {
+	freqs := append([]int(nil), histogram...)
+	for {
+		lengths := buildHuffmanLengths(freqs)
+		ok := true
+		for _, l := range lengths {
+			if l > maxLength {
+				ok = false
+				break
+			}
+		}
+		if ok {
+			return lengths
+		}
+		for i, f := range freqs {
+			if f > 0 {
+				freqs[i] = (f + 1) / 2
+			}
+		}
+	}
+}
+
+func buildHuffmanLengths(freqs []int) []int {
+	type node struct {
+		freq        int
+		symbol      int
+		left, right *node
+	}
+
+	var nodes []*node
+	for symbol, f := range freqs {
+		if f > 0 {
+			nodes = append(nodes, &node{freq: f, symbol: symbol})
+		}
+	}
+
+	lengths := make([]int, len(freqs))
+	if len(nodes) == 0 {
+		return lengths
+	}
+	if len(nodes) == 1 {
+		lengths[nodes[0].symbol] = 1
+		return lengths
+	}
+
+	for len(nodes) > 1 {
+		sort.SliceStable(nodes, func(i, j int) bool { return nodes[i].freq < nodes[j].freq })
+		merged := &node{freq: nodes[0].freq + nodes[1].freq, symbol: -1, left: nodes[0], right: nodes[1]}
+		nodes = append([]*node{merged}, nodes[2:]...)
+	}
+
+	var walk func(n *node, depth int)
+	walk = func(n *node, depth int) {
+		if n.left == nil {
+			lengths[n.symbol] = depth
+			return
+		}
+		walk(n.left, depth+1)
+		walk(n.right, depth+1)
+	}
+	walk(nodes[0], 0)
+	return lengths
+}
+
+// canonicalCode 根据码长生成规范哈夫曼码，并按 LSB 优先的写入顺序反转
+func canonicalCode(lengths []int) *prefixCode {
+	maxLength := 0
+	for _, l := range lengths {
+		if l > maxLength {
+			maxLength = l
+		}
+	}
+
+	count := make([]int, maxLength+1)
+	for _, l := range lengths {
+		if l > 0 {
+			count[l]++
+		}
+	}
+	next := make([]uint32, maxLength+2)
+	code := uint32(0)
+	for l := 1; l <= maxLength; l++ {
+		code = (code + uint32(count[l-1])) << 1
+		next[l] = code
+	}
+
+	codes := make([]uint32, len(lengths))
+	for symbol, l := range lengths {
+		if l == 0 {
+			continue
+		}
+		codes[symbol] = reverseBits(next[l], l)
+		next[l]++
+	}
+	return &prefixCode{lengths: lengths, codes: codes}
+}
+
+func reverseBits(code uint32, n int) uint32 {
+	var r uint32
+	for i := 0; i < n; i++ {
+		r = r<<1 | code&1
+		code >>= 1
+	}
+	return r
+}
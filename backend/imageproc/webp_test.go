@@ -0,0 +1,130 @@
+package imageproc
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/draw"
+	"math/rand"
+	"testing"
+
+	"golang.org/x/image/webp"
+)
+
+// roundTripWebP 编码后用 x/image/webp 解码，逐像素比较（无损编码必须完全一致）
+func roundTripWebP(t *testing.T, name string, img image.Image) {
+	t.Helper()
+
+	var buf bytes.Buffer
+	if err := EncodeWebP(&buf, img); err != nil {
+		t.Fatalf("%s: EncodeWebP: %v", name, err)
+	}
+	data := buf.Bytes()
+	if len(data)%2 != 0 {
+		t.Fatalf("%s: RIFF data has odd length %d", name, len(data))
+	}
+
+	decoded, err := webp.Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("%s: webp.Decode: %v", name, err)
+	}
+
+	bounds := img.Bounds()
+	want := image.NewNRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	draw.Draw(want, want.Bounds(), img, bounds.Min, draw.Src)
+	got := image.NewNRGBA(want.Bounds())
+	if decoded.Bounds().Size() != want.Bounds().Size() {
+		t.Fatalf("%s: decoded size %v, want %v", name, decoded.Bounds().Size(), want.Bounds().Size())
+	}
+	draw.Draw(got, got.Bounds(), decoded, decoded.Bounds().Min, draw.Src)
+
+	for y := 0; y < want.Rect.Dy(); y++ {
+		for x := 0; x < want.Rect.Dx(); x++ {
+			if w, g := want.NRGBAAt(x, y), got.NRGBAAt(x, y); w != g {
+				t.Fatalf("%s: pixel (%d, %d) = %v, want %v", name, x, y, g, w)
+			}
+		}
+	}
+}
+
+// noiseImage 随机像素与渐变混合，既有大量不同符号，也有可预测的区域
+func noiseImage(w, h int, alpha bool, seed int64) *image.NRGBA {
+	rng := rand.New(rand.NewSource(seed))
+	img := image.NewNRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			c := color.NRGBA{R: uint8(x * 7), G: uint8(y * 5), B: uint8(x + y), A: 0xff}
+			if (x/8+y/8)%2 == 0 {
+				c.R, c.G, c.B = uint8(rng.Intn(256)), uint8(rng.Intn(256)), uint8(rng.Intn(256))
+			}
+			if alpha {
+				c.A = uint8(rng.Intn(256))
+				if x%5 == 0 {
+					c.A = 0
+				}
+			}
+			img.SetNRGBA(x, y, c)
+		}
+	}
+	return img
+}
+
+func uniformImage(w, h int, c color.NRGBA) *image.NRGBA {
+	img := image.NewNRGBA(image.Rect(0, 0, w, h))
+	draw.Draw(img, img.Bounds(), image.NewUniform(c), image.Point{}, draw.Src)
+	return img
+}
+
+func TestEncodeWebPOpaque(t *testing.T) {
+	roundTripWebP(t, "noise 64x48", noiseImage(64, 48, false, 1))
+	roundTripWebP(t, "noise 300x200", noiseImage(300, 200, false, 2))
+	roundTripWebP(t, "uniform", uniformImage(40, 30, color.NRGBA{R: 10, G: 200, B: 30, A: 0xff}))
+}
+
+func TestEncodeWebPAlpha(t *testing.T) {
+	roundTripWebP(t, "noise alpha 64x48", noiseImage(64, 48, true, 3))
+	roundTripWebP(t, "transparent", uniformImage(16, 16, color.NRGBA{}))
+	roundTripWebP(t, "semi-transparent", uniformImage(20, 10, color.NRGBA{R: 255, G: 128, B: 0, A: 0x80}))
+}
+
+func TestEncodeWebPTiny(t *testing.T) {
+	roundTripWebP(t, "1x1 opaque", uniformImage(1, 1, color.NRGBA{R: 1, G: 2, B: 3, A: 0xff}))
+	roundTripWebP(t, "1x1 transparent", uniformImage(1, 1, color.NRGBA{R: 9, A: 0}))
+	roundTripWebP(t, "1x1 noise alpha", noiseImage(1, 1, true, 4))
+}
+
+func TestEncodeWebPOddSizes(t *testing.T) {
+	// 覆盖预测块（32 像素）边界两侧和单行、单列
+	for i, size := range []image.Point{{3, 5}, {31, 33}, {33, 31}, {65, 1}, {1, 65}, {97, 47}} {
+		roundTripWebP(t, size.String()+" opaque", noiseImage(size.X, size.Y, false, int64(10+i)))
+		roundTripWebP(t, size.String()+" alpha", noiseImage(size.X, size.Y, true, int64(20+i)))
+	}
+}
+
+func TestEncodeWebPOtherModels(t *testing.T) {
+	// 非 NRGBA 输入和不从原点开始的边界
+	gray := image.NewGray(image.Rect(5, 7, 42, 29))
+	for i := range gray.Pix {
+		gray.Pix[i] = uint8(i * 13)
+	}
+	roundTripWebP(t, "gray", gray)
+
+	paletted := image.NewPaletted(image.Rect(0, 0, 19, 23), color.Palette{
+		color.NRGBA{A: 0}, color.NRGBA{R: 255, A: 255}, color.NRGBA{G: 255, A: 255},
+	})
+	for i := range paletted.Pix {
+		paletted.Pix[i] = uint8(i % 3)
+	}
+	roundTripWebP(t, "paletted", paletted)
+
+	sub := noiseImage(80, 80, true, 5).SubImage(image.Rect(13, 17, 50, 61))
+	roundTripWebP(t, "sub image", sub)
+}
+
+func TestEncodeWebPInvalidSize(t *testing.T) {
+	for _, r := range []image.Rectangle{image.Rect(0, 0, 0, 10), image.Rect(0, 0, 1<<14+1, 1)} {
+		if err := EncodeWebP(&bytes.Buffer{}, image.NewNRGBA(r)); err == nil {
+			t.Errorf("EncodeWebP(%v) succeeded, want error", r.Size())
+		}
+	}
+}
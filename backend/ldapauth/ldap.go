@@ -0,0 +1,256 @@
+// Package ldapauth 实现 LDAP 目录登录：以用户的凭据绑定验证密码，
+// 按过滤器查找用户条目，并把邮箱和由分组得到的角色同步到本地用户
+package ldapauth
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"gotux/config"
+	"gotux/models"
+	"log"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/go-ldap/ldap/v3"
+)
+
+// ProviderName LDAP 用户在 User.AuthProvider 中的取值
+const ProviderName = "ldap"
+
+const timeout = 10 * time.Second
+
+var (
+	errUserNotFound = errors.New("LDAP 中未找到唯一的用户条目")
+	errUnavailable  = errors.New("无法连接 LDAP 服务，请稍后再试")
+)
+
+// Authenticator 先使用 LDAP 验证，LocalFallback 中的本地账户（默认内置管理员）仍使用本地密码
+type Authenticator struct {
+	cfg   config.LDAPConfig
+	local models.LocalAuthenticator
+}
+
+// New 创建 LDAP 登录方式
+func New(cfg config.LDAPConfig) *Authenticator {
+	return &Authenticator{cfg: cfg}
+}
+
+// Init 配置了 LDAP 时替换默认的登录方式
+func Init() {
+	cfg := config.AppConfig.LDAP
+	if !cfg.Enabled() {
+		return
+	}
+	if cfg.BindDN == "" && cfg.UserDN == "" {
+		log.Fatal("启用 LDAP 需要设置 LDAP_BIND_DN 或 LDAP_USER_DN")
+	}
+	models.SetAuthenticator(New(cfg))
+	log.Printf("已启用 LDAP 登录: %s", cfg.URL)
+}
+
+// Authenticate 实现 models.Authenticator
+func (a *Authenticator) Authenticate(username, password string) (*models.User, error) {
+	if a.isLocalUser(username) {
+		return a.local.Authenticate(username, password)
+	}
+
+	// 空密码会被服务器当作匿名绑定而成功，必须拒绝
+	if username == "" || password == "" {
+		return nil, models.ErrInvalidCredentials
+	}
+
+	entry, err := a.lookup(username, password)
+	if err != nil {
+		if errors.Is(err, errUserNotFound) || ldap.IsErrorWithCode(err, ldap.LDAPResultInvalidCredentials) {
+			return nil, models.ErrInvalidCredentials
+		}
+		log.Printf("LDAP 登录失败: %v", err)
+		return nil, errUnavailable
+	}
+
+	return a.provision(username, entry)
+}
+
+// isLocalUser 用户名在 LocalFallback 中且存在对应的本地账户
+func (a *Authenticator) isLocalUser(username string) bool {
+	for _, name := range a.cfg.LocalFallback {
+		if name == username {
+			user, err := models.GetUserByUsername(username)
+			return err == nil && user.AuthProvider == ""
+		}
+	}
+	return false
+}
+
+// lookup 验证密码并返回用户条目。配置了服务账号时先查找用户 DN 再以用户凭据绑定，
+// 否则按 UserDN 模板直接绑定，再以用户身份读取自己的条目
+func (a *Authenticator) lookup(username, password string) (*ldap.Entry, error) {
+	conn, err := a.dial()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	if a.cfg.BindDN != "" {
+		if err := conn.Bind(a.cfg.BindDN, a.cfg.BindPassword); err != nil {
+			return nil, fmt.Errorf("服务账号绑定失败: %w", err)
+		}
+		entry, err := a.search(conn, username)
+		if err != nil {
+			return nil, err
+		}
+		if err := conn.Bind(entry.DN, password); err != nil {
+			return nil, err
+		}
+		return entry, nil
+	}
+
+	dn := strings.ReplaceAll(a.cfg.UserDN, "{username}", ldap.EscapeDN(username))
+	if err := conn.Bind(dn, password); err != nil {
+		return nil, err
+	}
+	return a.search(conn, username)
+}
+
+func (a *Authenticator) dial() (*ldap.Conn, error) {
+	u, err := url.Parse(a.cfg.URL)
+	if err != nil {
+		return nil, err
+	}
+	tlsConfig := &tls.Config{
+		ServerName:         u.Hostname(),
+		InsecureSkipVerify: a.cfg.SkipVerify,
+		MinVersion:         tls.VersionTLS12,
+	}
+
+	conn, err := ldap.DialURL(a.cfg.URL,
+		ldap.DialWithDialer(&net.Dialer{Timeout: timeout}),
+		ldap.DialWithTLSConfig(tlsConfig))
+	if err != nil {
+		return nil, err
+	}
+	conn.SetTimeout(timeout)
+
+	if a.cfg.StartTLS {
+		if err := conn.StartTLS(tlsConfig); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("StartTLS 失败: %w", err)
+		}
+	}
+	return conn, nil
+}
+
+// search 按过滤器查找用户，结果必须唯一
+func (a *Authenticator) search(conn *ldap.Conn, username string) (*ldap.Entry, error) {
+	filter := strings.ReplaceAll(a.cfg.UserFilter, "{username}", ldap.EscapeFilter(username))
+	req := ldap.NewSearchRequest(a.cfg.BaseDN,
+		ldap.ScopeWholeSubtree, ldap.NeverDerefAliases, 2, int(timeout.Seconds()), false,
+		filter, []string{a.cfg.UsernameAttr, a.cfg.EmailAttr, a.cfg.GroupAttr}, nil)
+
+	result, err := conn.Search(req)
+	if err != nil {
+		if ldap.IsErrorWithCode(err, ldap.LDAPResultSizeLimitExceeded) || ldap.IsErrorWithCode(err, ldap.LDAPResultNoSuchObject) {
+			return nil, errUserNotFound
+		}
+		return nil, err
+	}
+	if len(result.Entries) != 1 {
+		return nil, errUserNotFound
+	}
+	return result.Entries[0], nil
+}
+
+// provision 查找或创建本地用户，每次登录同步邮箱和角色
+func (a *Authenticator) provision(username string, entry *ldap.Entry) (*models.User, error) {
+	externalID := entry.GetAttributeValue(a.cfg.UsernameAttr)
+	if externalID == "" {
+		externalID = username
+	}
+	externalID = strings.ToLower(externalID)
+	email := entry.GetAttributeValue(a.cfg.EmailAttr)
+
+	role, mapped := a.mapRole(entry.GetAttributeValues(a.cfg.GroupAttr))
+	if a.cfg.RequireRole && !mapped {
+		return nil, errors.New("你的账户没有访问权限，请联系管理员")
+	}
+
+	user, err := models.GetUserByExternalID(ProviderName, externalID)
+	if err != nil {
+		// 启用 LDAP 前已存在的同名本地账户关联到目录用户。本地账户可能是他人注册的，
+		// 关联时作废其会话、API Token 和本地密码，只保留图片等数据。
+		// 本地管理员不自动关联，否则目录中的同名用户会直接获得管理员权限
+		if local, err := models.GetUserByUsername(username); err == nil {
+			if local.AuthProvider != "" || local.IsAdmin() {
+				return nil, errors.New("用户名已被其他账户使用，请联系管理员")
+			}
+			if err := local.LinkExternal(ProviderName, externalID); err != nil {
+				log.Printf("LDAP 关联用户失败: %v", err)
+				return nil, errors.New("关联用户失败")
+			}
+			user = local
+		}
+	}
+
+	if user == nil {
+		if !a.cfg.AutoCreate {
+			return nil, errors.New("账户不存在，请联系管理员开通")
+		}
+		user, err = models.CreateExternalUser(ProviderName, externalID, username, placeholderEmail(email, externalID), role)
+		if err != nil {
+			log.Printf("LDAP 创建用户失败: %v", err)
+			return nil, errors.New("创建用户失败")
+		}
+		return user, nil
+	}
+
+	// 同步邮箱和角色，配置了角色映射时以目录为准
+	if email != "" && email != user.Email {
+		if other, err := models.GetUserByEmail(email); err != nil || other.ID == user.ID {
+			user.Email = email
+		}
+	}
+	if len(a.cfg.RoleMapping) > 0 {
+		user.Role = role
+	}
+	if err := user.Update(); err != nil {
+		return nil, errors.New("更新用户失败")
+	}
+	return user, nil
+}
+
+// mapRole 分组可以按完整 DN 或其 cn 映射，任一分组映射到 admin 即为管理员；
+// 没有可映射的分组时返回 user 和 false
+func (a *Authenticator) mapRole(groups []string) (string, bool) {
+	role, mapped := "user", false
+	for _, group := range groups {
+		keys := []string{strings.ToLower(group)}
+		if dn, err := ldap.ParseDN(group); err == nil && len(dn.RDNs) > 0 && len(dn.RDNs[0].Attributes) > 0 {
+			keys = append(keys, strings.ToLower(dn.RDNs[0].Attributes[0].Value))
+		}
+		for _, key := range keys {
+			if r, ok := a.cfg.RoleMapping[key]; ok {
+				mapped = true
+				if r == "admin" {
+					role = "admin"
+				}
+			}
+		}
+	}
+	return role, mapped
+}
+
+// placeholderEmail 邮箱为空或已被其他账户使用时，生成一个不会冲突的占位邮箱
+func placeholderEmail(email, externalID string) string {
+	if email != "" {
+		if _, err := models.GetUserByEmail(email); err != nil {
+			return email
+		}
+	}
+	sum := sha256.Sum256([]byte(externalID))
+	return hex.EncodeToString(sum[:8]) + "@ldap.invalid"
+}
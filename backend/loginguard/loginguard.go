@@ -0,0 +1,297 @@
+// Package loginguard 限制登录失败次数，防止暴力破解密码。
+// 按用户名和 IP 分别统计失败次数：同一用户名连续失败时按指数退避拒绝后续尝试，
+// 达到上限后临时锁定；同一 IP 达到上限后同样锁定。记录保存在内存中并同步写入数据库，重启后不会丢失。
+// 分享链接的访问密码使用独立的 Share 计数，输错分享密码不影响账户登录
+package loginguard
+
+import (
+	"fmt"
+	"gotux/config"
+	"gotux/models"
+	"log"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// 同一用户名第 2 次失败后开始退避，每次翻倍，最长 maxBackoff
+	baseBackoff = time.Second
+	maxBackoff  = 30 * time.Second
+
+	// maxEntries 内存中最多保留的记录数，超过时清理已过期的记录
+	maxEntries      = 10000
+	cleanupInterval = time.Hour
+)
+
+var (
+	mu      sync.Mutex
+	entries = make(map[string]*models.LoginThrottle)
+	// inflight 已通过 Check 但还未 Release 的尝试数，只保存在内存中
+	inflight    = make(map[string]int)
+	lastCleanup time.Time
+)
+
+// Guard 一组独立的失败计数，尝试的对象（用户名或分享链接）和 IP 分别使用各自的键前缀
+type Guard struct {
+	subjectPrefix string
+	ipPrefix      string
+	foldCase      bool   // 对象不区分大小写，如用户名
+	auditAction   string // 锁定时写入审计日志的动作
+}
+
+var (
+	// Login 账户登录，包括两步验证
+	Login = &Guard{subjectPrefix: "user:", ipPrefix: "ip:", foldCase: true, auditAction: models.AuditLoginLocked}
+	// Share 分享链接的访问密码
+	Share = &Guard{subjectPrefix: "share:", ipPrefix: "share-ip:", auditAction: models.AuditShareLocked}
+)
+
+// Result 登录前检查的结果
+type Result struct {
+	Allowed    bool
+	Locked     bool          // 为 true 时已被锁定，否则为退避中
+	RetryAfter time.Duration // 需要等待的时间
+}
+
+// Check 登录前检查用户名和 IP 是否允许尝试，见 Guard.Check
+func Check(username, ip string) Result {
+	return Login.Check(username, ip)
+}
+
+// Release 结束 Check 预留的尝试，见 Guard.Release
+func Release(username, ip string) {
+	Login.Release(username, ip)
+}
+
+// Fail 记录一次登录失败，见 Guard.Fail
+func Fail(username, ip string) {
+	Login.Fail(username, ip)
+}
+
+// Succeed 登录成功后清除该用户名的失败记录，见 Guard.Succeed
+func Succeed(username string) {
+	Login.Succeed(username)
+}
+
+// Check 检查对象和 IP 是否允许尝试。允许时为本次尝试预留名额，
+// 调用方在校验结束后必须调用 Release。进行中的尝试按失败计算，
+// 这样并发请求不能在 Fail 记录之前绕过退避和锁定
+func (g *Guard) Check(subject, ip string) Result {
+	cfg := config.AppConfig.Login
+	now := time.Now()
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	result := Result{Allowed: true}
+	for _, key := range g.keys(subject, ip) {
+		entry := load(key)
+		if entry.LockedUntil != nil && now.Before(*entry.LockedUntil) {
+			return Result{Locked: true, RetryAfter: entry.LockedUntil.Sub(now)}
+		}
+
+		isUser := strings.HasPrefix(key, g.subjectPrefix)
+		limit := cfg.MaxFailures
+		if !isUser {
+			limit = cfg.IPMaxFailures
+		}
+		if limit <= 0 {
+			continue
+		}
+
+		failures := entry.Failures
+		if expired(entry, now) {
+			failures = 0
+		}
+		if isUser && failures >= 2 {
+			if wait := entry.LastFailureAt.Add(backoff(failures)).Sub(now); wait > 0 {
+				result = Result{RetryAfter: wait}
+			}
+		}
+		// 同一用户名进入退避后只允许一个进行中的尝试
+		if pending := inflight[key]; pending > 0 {
+			if failures+pending >= limit || (isUser && failures+pending >= 2) {
+				result = Result{RetryAfter: baseBackoff}
+			}
+		}
+	}
+
+	if result.Allowed {
+		for _, key := range g.keys(subject, ip) {
+			inflight[key]++
+		}
+	}
+	return result
+}
+
+// Release 结束 Check 预留的尝试，需在 Fail 或 Succeed 之后调用
+func (g *Guard) Release(subject, ip string) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	for _, key := range g.keys(subject, ip) {
+		if inflight[key] <= 1 {
+			delete(inflight, key)
+		} else {
+			inflight[key]--
+		}
+	}
+}
+
+// Fail 记录一次失败，达到上限时锁定并写入审计日志
+func (g *Guard) Fail(subject, ip string) {
+	cfg := config.AppConfig.Login
+	now := time.Now()
+
+	for _, key := range g.keys(subject, ip) {
+		limit := cfg.MaxFailures
+		if strings.HasPrefix(key, g.ipPrefix) {
+			limit = cfg.IPMaxFailures
+		}
+		if limit <= 0 {
+			continue
+		}
+
+		mu.Lock()
+		entry := load(key)
+		if expired(entry, now) {
+			entry.Failures = 0
+			entry.LockedUntil = nil
+		}
+		entry.Failures++
+		entry.LastFailureAt = now
+		locked := false
+		if entry.Failures >= limit && entry.LockedUntil == nil {
+			until := now.Add(lockoutDuration())
+			entry.LockedUntil = &until
+			locked = true
+		}
+		saved := *entry
+		mu.Unlock()
+
+		if err := models.SaveLoginThrottle(&saved); err != nil {
+			log.Printf("保存登录失败记录失败: %v", err)
+		}
+		if locked {
+			detail := fmt.Sprintf("连续登录失败 %d 次，锁定至 %s", saved.Failures, saved.LockedUntil.Format(time.RFC3339))
+			if err := models.CreateAuditLog(g.auditAction, 0, key, ip, detail); err != nil {
+				log.Printf("写入审计日志失败: %v", err)
+			}
+		}
+	}
+
+	cleanup(now)
+}
+
+// Succeed 成功后清除该对象的失败记录。IP 的记录不清除，
+// 否则攻击者可以穿插登录自己的账户来重置计数
+func (g *Guard) Succeed(subject string) {
+	key := g.subjectKey(subject)
+	mu.Lock()
+	delete(entries, key)
+	mu.Unlock()
+
+	if err := models.DeleteLoginThrottle(key); err != nil {
+		log.Printf("清除登录失败记录失败: %v", err)
+	}
+}
+
+// Unlock 解除用户名或 IP 的锁定（管理员操作），返回是否存在该记录
+func Unlock(key string) (bool, error) {
+	mu.Lock()
+	delete(entries, key)
+	mu.Unlock()
+
+	if _, err := models.GetLoginThrottle(key); err != nil {
+		return false, nil
+	}
+	return true, models.DeleteLoginThrottle(key)
+}
+
+// IPKey IP 对应的登录记录键
+func IPKey(ip string) string {
+	return Login.ipPrefix + ip
+}
+
+// UserKey 用户名对应的登录记录键，用户名不区分大小写
+func UserKey(username string) string {
+	return Login.subjectKey(username)
+}
+
+// Owns 记录键是否属于该组计数
+func (g *Guard) Owns(key string) bool {
+	return strings.HasPrefix(key, g.subjectPrefix) || strings.HasPrefix(key, g.ipPrefix)
+}
+
+func (g *Guard) subjectKey(subject string) string {
+	subject = strings.TrimSpace(subject)
+	if g.foldCase {
+		subject = strings.ToLower(subject)
+	}
+	return g.subjectPrefix + subject
+}
+
+func (g *Guard) keys(subject, ip string) []string {
+	return []string{g.subjectKey(subject), g.ipPrefix + ip}
+}
+
+// load 从内存获取记录，没有时从数据库加载，调用方需持有 mu
+func load(key string) *models.LoginThrottle {
+	if entry, ok := entries[key]; ok {
+		return entry
+	}
+	entry, err := models.GetLoginThrottle(key)
+	if err != nil {
+		entry = &models.LoginThrottle{Key: key}
+	}
+	entries[key] = entry
+	return entry
+}
+
+// expired 锁定已结束，或距最近一次失败已超过统计窗口，计数应当重新开始
+func expired(entry *models.LoginThrottle, now time.Time) bool {
+	if entry.LockedUntil != nil {
+		return !now.Before(*entry.LockedUntil)
+	}
+	return now.Sub(entry.LastFailureAt) > lockoutDuration()
+}
+
+func backoff(failures int) time.Duration {
+	if failures > 7 {
+		return maxBackoff
+	}
+	d := baseBackoff << (failures - 2)
+	if d > maxBackoff {
+		d = maxBackoff
+	}
+	return d
+}
+
+func lockoutDuration() time.Duration {
+	minutes := config.AppConfig.Login.LockoutDuration
+	if minutes <= 0 {
+		minutes = 15
+	}
+	return time.Duration(minutes) * time.Minute
+}
+
+// cleanup 定期清理内存和数据库中已过期的记录
+func cleanup(now time.Time) {
+	mu.Lock()
+	if len(entries) < maxEntries && now.Sub(lastCleanup) < cleanupInterval {
+		mu.Unlock()
+		return
+	}
+	lastCleanup = now
+	for key, entry := range entries {
+		if entry.Failures == 0 || expired(entry, now) {
+			delete(entries, key)
+		}
+	}
+	mu.Unlock()
+
+	if err := models.DeleteStaleLoginThrottles(now.Add(-lockoutDuration())); err != nil {
+		log.Printf("清理登录失败记录失败: %v", err)
+	}
+}
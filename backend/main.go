@@ -2,9 +2,15 @@ package main
 
 import (
 	"gotux/config"
+	"gotux/imageproc"
+	"gotux/ldapauth"
 	"gotux/models"
 	"gotux/routes"
+	"gotux/storage"
 	"log"
+	"net/http"
+	"path"
+	"strings"
 
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
@@ -17,31 +23,56 @@ func main() {
 	// 初始化数据库
 	models.InitDB()
 
-		// 创建默认管理员账户
-		models.CreateDefaultAdmin()
+	// 初始化存储后端
+	storage.InitStorage()
 
-		// 自动修正所有管理员配额为无限制（0）
-		if err := models.FixAdminQuota(); err != nil {
-			log.Println("自动修正管理员配额失败:", err)
-		}
+	// 加载水印字体
+	imageproc.InitFont()
+
+	// 配置了 LDAP 时使用目录登录
+	ldapauth.Init()
+
+	// 创建默认管理员账户
+	models.CreateDefaultAdmin()
+
+	// 自动修正所有管理员配额为无限制（0）
+	if err := models.FixAdminQuota(); err != nil {
+		log.Println("自动修正管理员配额失败:", err)
+	}
 
 	// 设置 Gin 模式
 	gin.SetMode(gin.ReleaseMode)
 
 	// 创建路由
 	r := gin.Default()
+	// 默认不信任任何代理，客户端 IP 取连接的来源地址，配置了 TRUSTED_PROXIES 才采信 X-Forwarded-For
+	var proxies []string
+	if len(config.AppConfig.Server.TrustedProxies) > 0 {
+		proxies = config.AppConfig.Server.TrustedProxies
+	}
+	if err := r.SetTrustedProxies(proxies); err != nil {
+		log.Fatal("无效的 TRUSTED_PROXIES:", err)
+	}
 
 	// 配置 CORS - 开发模式允许所有来源
 	r.Use(cors.New(cors.Config{
 		AllowAllOrigins:  true,
-		AllowMethods:     []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
-		AllowHeaders:     []string{"Origin", "Content-Type", "Authorization"},
-		ExposeHeaders:    []string{"Content-Length", "X-Image-UUID", "X-Image-ID"},
+		AllowMethods:     []string{"GET", "POST", "PUT", "PATCH", "DELETE", "HEAD", "OPTIONS"},
+		AllowHeaders:     []string{"Origin", "Content-Type", "Authorization", "X-API-Key", "X-Share-Password", "Tus-Resumable", "Upload-Length", "Upload-Offset", "Upload-Metadata", "Upload-Defer-Length"},
+		ExposeHeaders:    []string{"Content-Length", "X-Image-UUID", "X-Image-ID", "Location", "Tus-Resumable", "Tus-Version", "Tus-Extension", "Tus-Max-Size", "Upload-Offset", "Upload-Length", "Upload-Expires"},
 		AllowCredentials: false, // AllowAllOrigins 时必须设为 false
 	}))
 
-	// 静态文件服务 - 用于访问上传的图片
-	r.Static("/uploads", "./uploads")
+	// 静态文件服务 - 本地存储时用于直接访问上传的图片，未通过审核的图片不提供
+	if local, ok := storage.Default.(*storage.Local); ok && config.AppConfig.Upload.PublicPath != "" {
+		uploads := r.Group(config.AppConfig.Upload.PublicPath, func(c *gin.Context) {
+			filePath := strings.ToLower(path.Clean(c.Param("filepath")) + "/")
+			if strings.HasPrefix(filePath, "/"+models.ReviewKeyPrefix) {
+				c.AbortWithStatus(http.StatusNotFound)
+			}
+		})
+		uploads.Static("/", local.Root())
+	}
 
 	// 注册路由
 	routes.SetupRoutes(r)
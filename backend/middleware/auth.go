@@ -11,13 +11,14 @@ import (
 )
 
 type Claims struct {
-	UserID   uint   `json:"user_id"`
-	Username string `json:"username"`
-	Role     string `json:"role"`
+	UserID    uint   `json:"user_id"`
+	Username  string `json:"username"`
+	Role      string `json:"role"`
+	SessionID string `json:"sid"` // 登录会话 ID，会话被吊销后令牌立即失效
 	jwt.RegisteredClaims
 }
 
-// AuthMiddleware JWT 认证中间件
+// AuthMiddleware JWT 认证中间件，同时接受个人 API Token（gtx_ 开头）
 func AuthMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		authHeader := c.GetHeader("Authorization")
@@ -35,39 +36,148 @@ func AuthMiddleware() gin.HandlerFunc {
 			return
 		}
 
-		tokenString := parts[1]
-		claims := &Claims{}
+		if status, message := authenticate(c, parts[1]); status != 0 {
+			c.JSON(status, gin.H{"error": message})
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
 
-		token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
-			return []byte(config.AppConfig.JWT.Secret), nil
-		})
+// OptionalAuthMiddleware 用于公开接口：带有效令牌时与 AuthMiddleware 一样设置用户信息，
+// 没有令牌或令牌无效时按匿名访问继续处理，不返回错误
+func OptionalAuthMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		parts := strings.SplitN(c.GetHeader("Authorization"), " ", 2)
+		if len(parts) == 2 && parts[0] == "Bearer" {
+			authenticate(c, parts[1])
+		}
+		c.Next()
+	}
+}
 
-		if err != nil || !token.Valid {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "无效的认证令牌"})
-			c.Abort()
+// APIKeyMiddleware 供 PicGo、ShareX 等上传工具使用，除 Authorization 外
+// 还接受 X-API-Key 请求头或 key / token 查询参数中的个人 API Token
+func APIKeyMiddleware() gin.HandlerFunc {
+	auth := AuthMiddleware()
+	return func(c *gin.Context) {
+		key := c.GetHeader("X-API-Key")
+		if key == "" {
+			key = c.Query("key")
+		}
+		if key == "" {
+			key = c.Query("token")
+		}
+		if key == "" {
+			auth(c)
 			return
 		}
 
-		// 验证用户是否存在且状态正常
-		user, err := models.GetUserByID(claims.UserID)
-		if err != nil {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "用户不存在"})
+		if !strings.HasPrefix(key, models.APITokenPrefix) {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "无效的 API Key"})
 			c.Abort()
 			return
 		}
-
-		if !user.IsActive() {
-			c.JSON(http.StatusForbidden, gin.H{"error": "账户已被禁用"})
+		if status, message := authenticateAPIToken(c, key); status != 0 {
+			c.JSON(status, gin.H{"error": message})
 			c.Abort()
 			return
 		}
+		c.Next()
+	}
+}
+
+// authenticate 校验登录令牌或 API Token，成功时将用户信息存入上下文并返回 0，
+// 失败时返回应答的状态码和错误信息
+func authenticate(c *gin.Context, tokenString string) (int, string) {
+	if strings.HasPrefix(tokenString, models.APITokenPrefix) {
+		return authenticateAPIToken(c, tokenString)
+	}
+
+	claims := &Claims{}
+
+	token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		return []byte(config.AppConfig.JWT.Secret), nil
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}))
+
+	if err != nil || !token.Valid {
+		return http.StatusUnauthorized, "无效的认证令牌"
+	}
+
+	// 会话已退出或被吊销时令牌立即失效
+	if claims.SessionID == "" {
+		return http.StatusUnauthorized, "无效的认证令牌"
+	}
+	if _, err := models.GetActiveSession(claims.SessionID, claims.UserID); err != nil {
+		return http.StatusUnauthorized, "会话已失效，请重新登录"
+	}
 
-		// 将用户信息存储到上下文
-		c.Set("userID", claims.UserID)
-		c.Set("username", claims.Username)
-		c.Set("role", claims.Role)
-		c.Set("user", user)
+	// 验证用户是否存在且状态正常
+	user, err := models.GetUserByID(claims.UserID)
+	if err != nil {
+		return http.StatusUnauthorized, "用户不存在"
+	}
+
+	if !user.IsActive() {
+		return http.StatusForbidden, "账户已被禁用"
+	}
 
+	// 将用户信息存储到上下文
+	c.Set("userID", claims.UserID)
+	c.Set("username", claims.Username)
+	c.Set("role", claims.Role)
+	c.Set("user", user)
+	c.Set("sessionID", claims.SessionID)
+	return 0, ""
+}
+
+// authenticateAPIToken 使用个人 API Token 认证，权限由路由上的 RequireScope 检查
+func authenticateAPIToken(c *gin.Context, secret string) (int, string) {
+	token, err := models.GetAPITokenBySecret(secret)
+	if err != nil {
+		return http.StatusUnauthorized, "无效的认证令牌"
+	}
+
+	user, err := models.GetUserByID(token.UserID)
+	if err != nil {
+		return http.StatusUnauthorized, "用户不存在"
+	}
+
+	if !user.IsActive() {
+		return http.StatusForbidden, "账户已被禁用"
+	}
+
+	token.Touch(c.ClientIP())
+
+	c.Set("userID", user.ID)
+	c.Set("username", user.Username)
+	c.Set("role", user.Role)
+	c.Set("user", user)
+	c.Set("apiToken", token)
+	return 0, ""
+}
+
+// RequireScope 要求 API Token 拥有指定权限，JWT 登录不受限制
+func RequireScope(scope string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if token, ok := GetAPIToken(c); ok && !token.HasScope(scope) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "API Token 缺少 " + scope + " 权限"})
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+// SessionOnly 只允许登录会话访问，拒绝 API Token（如修改密码、管理 Token）
+func SessionOnly() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if _, ok := GetAPIToken(c); ok {
+			c.JSON(http.StatusForbidden, gin.H{"error": "该接口不支持 API Token"})
+			c.Abort()
+			return
+		}
 		c.Next()
 	}
 }
@@ -102,3 +212,21 @@ func GetUser(c *gin.Context) (*models.User, bool) {
 	}
 	return user.(*models.User), true
 }
+
+// GetAPIToken 获取当前请求使用的 API Token，JWT 登录时返回 false
+func GetAPIToken(c *gin.Context) (*models.APIToken, bool) {
+	token, exists := c.Get("apiToken")
+	if !exists {
+		return nil, false
+	}
+	return token.(*models.APIToken), true
+}
+
+// GetSessionID 获取当前登录会话的 ID，API Token 认证时返回 false
+func GetSessionID(c *gin.Context) (string, bool) {
+	sessionID, exists := c.Get("sessionID")
+	if !exists {
+		return "", false
+	}
+	return sessionID.(string), true
+}
@@ -0,0 +1,227 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Album 相册，一张图片可以属于多个相册
+type Album struct {
+	ID           uint      `gorm:"primarykey" json:"id"`
+	CreatedAt    time.Time `json:"created_at"`
+	UpdatedAt    time.Time `json:"updated_at"`
+	UserID       uint      `gorm:"not null;index" json:"user_id"`
+	Name         string    `gorm:"size:100;not null" json:"name"`
+	Description  string    `json:"description"`
+	IsPublic     bool      `json:"is_public"` // 公开的相册可以通过公开接口浏览，并用于随机图片 API
+	CoverImageID *uint     `json:"cover_image_id"`
+	Cover        *Image    `gorm:"foreignKey:CoverImageID" json:"cover,omitempty"`
+	ImageCount   int64     `gorm:"->;-:migration" json:"image_count"` // 查询时统计
+}
+
+// AlbumImage 相册与图片的关联，Position 为图片在相册中的顺序
+type AlbumImage struct {
+	AlbumID   uint      `gorm:"primarykey;autoIncrement:false" json:"album_id"`
+	ImageID   uint      `gorm:"primarykey;autoIncrement:false;index" json:"image_id"`
+	Position  int       `gorm:"not null;default:0" json:"position"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// albumWithCount 查询相册时附带图片数量
+func albumWithCount() *gorm.DB {
+	return DB.Model(&Album{}).
+		Select("albums.*, (SELECT COUNT(*) FROM album_images WHERE album_images.album_id = albums.id) AS image_count").
+		Preload("Cover")
+}
+
+// CreateAlbum 创建相册
+func CreateAlbum(album *Album) error {
+	return DB.Create(album).Error
+}
+
+// GetAlbumByID 根据ID获取相册
+func GetAlbumByID(id uint) (*Album, error) {
+	var album Album
+	if err := albumWithCount().Where("albums.id = ?", id).First(&album).Error; err != nil {
+		return nil, err
+	}
+	return &album, nil
+}
+
+// GetAlbumsByUserID 分页获取用户的相册，最近更新的在前
+func GetAlbumsByUserID(userID uint, page, pageSize int) ([]Album, int64, error) {
+	var albums []Album
+	var total int64
+
+	if err := DB.Model(&Album{}).Where("user_id = ?", userID).Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	offset := (page - 1) * pageSize
+	err := albumWithCount().Where("albums.user_id = ?", userID).Order("albums.updated_at DESC").Offset(offset).Limit(pageSize).Find(&albums).Error
+	return albums, total, err
+}
+
+// Update 更新相册信息
+func (a *Album) Update() error {
+	return DB.Model(a).Select("name", "description", "is_public", "cover_image_id").Omit(clause.Associations).Updates(a).Error
+}
+
+// Delete 删除相册，相册中的图片不受影响
+func (a *Album) Delete() error {
+	return DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("album_id = ?", a.ID).Delete(&AlbumImage{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(a).Error
+	})
+}
+
+// HasImage 图片是否在相册中
+func (a *Album) HasImage(imageID uint) bool {
+	var count int64
+	DB.Model(&AlbumImage{}).Where("album_id = ? AND image_id = ?", a.ID, imageID).Count(&count)
+	return count > 0
+}
+
+// AddImages 将用户自己的图片按顺序加到相册末尾，已在相册中的图片保持原位，返回新加入的数量；
+// 相册没有封面时使用第一张加入的图片
+func (a *Album) AddImages(imageIDs []uint) (int, error) {
+	added := 0
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		var owned []uint
+		if err := tx.Model(&Image{}).Where("id IN ? AND user_id = ?", imageIDs, a.UserID).Pluck("id", &owned).Error; err != nil {
+			return err
+		}
+		isOwned := make(map[uint]bool, len(owned))
+		for _, id := range owned {
+			isOwned[id] = true
+		}
+
+		var position int
+		if err := tx.Model(&AlbumImage{}).Where("album_id = ?", a.ID).Select("COALESCE(MAX(position), 0)").Scan(&position).Error; err != nil {
+			return err
+		}
+
+		for _, id := range imageIDs {
+			if !isOwned[id] {
+				continue
+			}
+			delete(isOwned, id) // 请求中重复的 ID 只加一次
+			position++
+			result := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&AlbumImage{AlbumID: a.ID, ImageID: id, Position: position})
+			if result.Error != nil {
+				return result.Error
+			}
+			if result.RowsAffected > 0 {
+				added++
+				if a.CoverImageID == nil {
+					coverID := id
+					a.CoverImageID = &coverID
+					a.Cover = nil
+				}
+			}
+		}
+		if added == 0 {
+			return nil
+		}
+
+		return tx.Model(&Album{ID: a.ID}).Update("cover_image_id", a.CoverImageID).Error
+	})
+	return added, err
+}
+
+// RemoveImages 从相册移除图片，返回移除的数量；移除了封面时改用相册中的第一张图片
+func (a *Album) RemoveImages(imageIDs []uint) (int64, error) {
+	var removed int64
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		result := tx.Where("album_id = ? AND image_id IN ?", a.ID, imageIDs).Delete(&AlbumImage{})
+		if result.Error != nil {
+			return result.Error
+		}
+		removed = result.RowsAffected
+		if removed == 0 {
+			return nil
+		}
+
+		if a.CoverImageID != nil {
+			var count int64
+			if err := tx.Model(&AlbumImage{}).Where("album_id = ? AND image_id = ?", a.ID, *a.CoverImageID).Count(&count).Error; err != nil {
+				return err
+			}
+			if count > 0 {
+				return tx.Model(&Album{ID: a.ID}).Update("updated_at", time.Now()).Error
+			}
+		}
+		return resetAlbumCover(tx, a)
+	})
+	return removed, err
+}
+
+// ReorderImages 按给定顺序排列相册中的图片，未列出的图片保持原有顺序排在后面
+func (a *Album) ReorderImages(imageIDs []uint) error {
+	return DB.Transaction(func(tx *gorm.DB) error {
+		var current []uint
+		if err := tx.Model(&AlbumImage{}).Where("album_id = ?", a.ID).Order("position, created_at").Pluck("image_id", &current).Error; err != nil {
+			return err
+		}
+		inAlbum := make(map[uint]bool, len(current))
+		for _, id := range current {
+			inAlbum[id] = true
+		}
+
+		ordered := make([]uint, 0, len(current))
+		for _, id := range imageIDs {
+			if inAlbum[id] {
+				ordered = append(ordered, id)
+				delete(inAlbum, id)
+			}
+		}
+		for _, id := range current {
+			if inAlbum[id] {
+				ordered = append(ordered, id)
+			}
+		}
+
+		for i, id := range ordered {
+			if err := tx.Model(&AlbumImage{}).Where("album_id = ? AND image_id = ?", a.ID, id).Update("position", i+1).Error; err != nil {
+				return err
+			}
+		}
+		return tx.Model(&Album{ID: a.ID}).Update("updated_at", time.Now()).Error
+	})
+}
+
+// resetAlbumCover 将相册封面设为相册中的第一张图片，相册为空时清除封面
+func resetAlbumCover(tx *gorm.DB, a *Album) error {
+	var first []uint
+	if err := tx.Model(&AlbumImage{}).Where("album_id = ?", a.ID).Order("position, created_at").Limit(1).Pluck("image_id", &first).Error; err != nil {
+		return err
+	}
+	a.CoverImageID = nil
+	a.Cover = nil
+	if len(first) > 0 {
+		a.CoverImageID = &first[0]
+	}
+	return tx.Model(&Album{ID: a.ID}).Update("cover_image_id", a.CoverImageID).Error
+}
+
+// removeImageFromAlbums 图片删除时将其移出所有相册，并更换以它为封面的相册封面
+func removeImageFromAlbums(tx *gorm.DB, imageID uint) error {
+	if err := tx.Where("image_id = ?", imageID).Delete(&AlbumImage{}).Error; err != nil {
+		return err
+	}
+
+	var albums []Album
+	if err := tx.Where("cover_image_id = ?", imageID).Find(&albums).Error; err != nil {
+		return err
+	}
+	for i := range albums {
+		if err := resetAlbumCover(tx, &albums[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
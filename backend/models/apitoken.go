@@ -0,0 +1,123 @@
+package models
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+	"time"
+)
+
+// API Token 权限范围
+const (
+	ScopeUpload = "upload" // 上传、编辑图片
+	ScopeRead   = "read"   // 查看图片和账户信息
+	ScopeDelete = "delete" // 删除图片
+	ScopeAdmin  = "admin"  // 管理员接口，仅管理员可授予
+)
+
+// TokenScopes 所有可用的权限范围
+var TokenScopes = []string{ScopeUpload, ScopeRead, ScopeDelete, ScopeAdmin}
+
+// APITokenPrefix 个人 API Token 的前缀，用于与 JWT 区分
+const APITokenPrefix = "gtx_"
+
+// APIToken 个人 API Token，供脚本和上传工具使用，只保存哈希
+type APIToken struct {
+	ID         uint       `gorm:"primarykey" json:"id"`
+	CreatedAt  time.Time  `json:"created_at"`
+	UpdatedAt  time.Time  `json:"updated_at"`
+	UserID     uint       `gorm:"not null;index" json:"user_id"`
+	Name       string     `gorm:"not null" json:"name"`
+	Prefix     string     `json:"prefix"`                        // Token 开头几位，便于用户辨认
+	TokenHash  string     `gorm:"not null;uniqueIndex" json:"-"` // SHA-256
+	Scopes     string     `gorm:"not null" json:"scopes"`        // 逗号分隔，如 upload,read
+	ExpiresAt  *time.Time `json:"expires_at"`                    // 为空表示永不过期
+	LastUsedAt *time.Time `json:"last_used_at"`
+	LastUsedIP string     `json:"last_used_ip"`
+}
+
+// CreateAPIToken 生成并保存新的 API Token，返回的明文只在创建时可见
+func CreateAPIToken(userID uint, name string, scopes []string, expiresAt *time.Time) (*APIToken, string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return nil, "", err
+	}
+	secret := APITokenPrefix + hex.EncodeToString(buf)
+
+	token := &APIToken{
+		UserID:    userID,
+		Name:      name,
+		Prefix:    secret[:len(APITokenPrefix)+8],
+		TokenHash: hashAPIToken(secret),
+		Scopes:    strings.Join(scopes, ","),
+		ExpiresAt: expiresAt,
+	}
+	if err := DB.Create(token).Error; err != nil {
+		return nil, "", err
+	}
+	return token, secret, nil
+}
+
+// GetAPITokenBySecret 根据明文查找未过期的 Token
+func GetAPITokenBySecret(secret string) (*APIToken, error) {
+	var token APIToken
+	err := DB.Where("token_hash = ? AND (expires_at IS NULL OR expires_at > ?)", hashAPIToken(secret), time.Now()).
+		First(&token).Error
+	if err != nil {
+		return nil, err
+	}
+	return &token, nil
+}
+
+// GetAPITokensByUserID 获取用户的所有 Token
+func GetAPITokensByUserID(userID uint) ([]APIToken, error) {
+	var tokens []APIToken
+	err := DB.Where("user_id = ?", userID).Order("created_at DESC").Find(&tokens).Error
+	return tokens, err
+}
+
+// GetAPIToken 获取用户的指定 Token
+func GetAPIToken(id, userID uint) (*APIToken, error) {
+	var token APIToken
+	if err := DB.Where("id = ? AND user_id = ?", id, userID).First(&token).Error; err != nil {
+		return nil, err
+	}
+	return &token, nil
+}
+
+// Update 更新 Token
+func (t *APIToken) Update() error {
+	return DB.Save(t).Error
+}
+
+// Delete 删除 Token
+func (t *APIToken) Delete() error {
+	return DB.Delete(t).Error
+}
+
+// HasScope 是否拥有指定权限
+func (t *APIToken) HasScope(scope string) bool {
+	for _, s := range strings.Split(t.Scopes, ",") {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// Touch 记录最后使用时间和 IP，一分钟内不重复写入
+func (t *APIToken) Touch(ip string) {
+	now := time.Now()
+	if t.LastUsedAt != nil && now.Sub(*t.LastUsedAt) < time.Minute && t.LastUsedIP == ip {
+		return
+	}
+	t.LastUsedAt = &now
+	t.LastUsedIP = ip
+	DB.Model(t).UpdateColumns(map[string]interface{}{"last_used_at": now, "last_used_ip": ip})
+}
+
+func hashAPIToken(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
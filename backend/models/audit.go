@@ -0,0 +1,50 @@
+package models
+
+import "time"
+
+// 审计日志动作
+const (
+	AuditLoginLocked   = "login_locked"   // 登录失败次数过多被锁定
+	AuditLoginUnlocked = "login_unlocked" // 管理员解除锁定
+	AuditShareLocked   = "share_locked"   // 分享链接的访问密码输错次数过多被锁定
+)
+
+// AuditLog 安全相关事件的审计记录
+type AuditLog struct {
+	ID        uint      `gorm:"primarykey" json:"id"`
+	CreatedAt time.Time `gorm:"index" json:"created_at"`
+	Action    string    `gorm:"size:64;index;not null" json:"action"`
+	ActorID   uint      `json:"actor_id"` // 执行操作的用户，0 表示系统
+	Target    string    `json:"target"`   // 被操作的对象，如用户名或 IP
+	IP        string    `json:"ip"`
+	Detail    string    `json:"detail"`
+}
+
+// CreateAuditLog 写入一条审计记录
+func CreateAuditLog(action string, actorID uint, target, ip, detail string) error {
+	return DB.Create(&AuditLog{
+		Action:  action,
+		ActorID: actorID,
+		Target:  target,
+		IP:      ip,
+		Detail:  detail,
+	}).Error
+}
+
+// GetAuditLogs 分页获取审计记录，action 为空时返回全部
+func GetAuditLogs(action string, page, pageSize int) ([]AuditLog, int64, error) {
+	var logs []AuditLog
+	var total int64
+
+	query := DB.Model(&AuditLog{})
+	if action != "" {
+		query = query.Where("action = ?", action)
+	}
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	offset := (page - 1) * pageSize
+	err := query.Order("id DESC").Offset(offset).Limit(pageSize).Find(&logs).Error
+	return logs, total, err
+}
@@ -0,0 +1,56 @@
+package models
+
+import "errors"
+
+var (
+	ErrInvalidCredentials = errors.New("用户名或密码错误")
+	ErrUserDisabled       = errors.New("账户已被禁用")
+	ErrEmailNotVerified   = errors.New("邮箱尚未验证，请先点击验证邮件中的链接")
+)
+
+// Authenticator 用户名密码登录方式，成功时返回对应的本地用户
+type Authenticator interface {
+	Authenticate(username, password string) (*User, error)
+}
+
+// LocalAuthenticator 使用本地数据库中的 bcrypt 密码登录
+type LocalAuthenticator struct{}
+
+// Authenticate 校验本地密码。由 LDAP、OIDC 管理的账户不能使用本地密码登录，
+// 否则身份提供方禁用用户后，用户仍可凭以前设置的本地密码登录
+func (LocalAuthenticator) Authenticate(username, password string) (*User, error) {
+	user, err := GetUserByUsername(username)
+	if err != nil || user.IsExternal() {
+		return nil, ErrInvalidCredentials
+	}
+
+	if err := user.CheckPassword(password); err != nil {
+		return nil, ErrInvalidCredentials
+	}
+
+	return user, nil
+}
+
+var authenticator Authenticator = LocalAuthenticator{}
+
+// SetAuthenticator 替换登录方式（如 LDAP），需在启动时调用
+func SetAuthenticator(a Authenticator) {
+	authenticator = a
+}
+
+// ValidateUser 验证用户登录
+func ValidateUser(username, password string) (*User, error) {
+	user, err := authenticator.Authenticate(username, password)
+	if err != nil {
+		return nil, err
+	}
+
+	if user.IsPending() {
+		return nil, ErrEmailNotVerified
+	}
+	if !user.IsActive() {
+		return nil, ErrUserDisabled
+	}
+
+	return user, nil
+}
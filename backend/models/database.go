@@ -17,15 +17,34 @@ func InitDB() {
 		log.Fatal("Failed to connect to database:", err)
 	}
 
-	// 自动迁移 User 和 ImageStats 表
-	err = DB.AutoMigrate(&User{}, &ImageStats{})
+	// 自动迁移用户、会话、两步验证、系统设置、邀请码、登录限制、审计日志及图片相关的表
+	err = DB.AutoMigrate(&User{}, &ImageStats{}, &ImageVariant{}, &TusUpload{}, &APIToken{}, &Session{},
+		&RecoveryCode{}, &Setting{}, &InviteCode{}, &LoginThrottle{}, &AuditLog{}, &Tag{})
 	if err != nil {
 		log.Fatal("Failed to migrate database:", err)
 	}
 
+	// 图片与标签的关联表使用 ImageTag，需要在迁移图片表之前设置
+	if err := DB.SetupJoinTable(&Image{}, "Tags", &ImageTag{}); err != nil {
+		log.Fatal("Failed to setup image tags join table:", err)
+	}
+
 	// 手动处理 Image 表的迁移
 	migrateImageTable()
 
+	// 相册、分享链接和标签关联引用图片，在图片表之后迁移
+	if err := DB.AutoMigrate(&Album{}, &AlbumImage{}, &ShareLink{}, &ShareLinkImage{}, &ImageTag{}); err != nil {
+		log.Fatal("Failed to migrate albums, share links and image tags tables:", err)
+	}
+
+	// 旧版本的标签保存在图片表的 tags 列中
+	if err := migrateLegacyTags(); err != nil {
+		log.Fatal("Failed to migrate image tags:", err)
+	}
+
+	// 全文索引依赖图片和标签表，SQLite 不支持 FTS5 时退回 LIKE 匹配
+	initSearchIndex()
+
 	log.Println("Database initialized successfully")
 }
 
@@ -61,6 +80,11 @@ func migrateImageTable() {
 		}
 		log.Println("Created unique index on uuid column")
 	}
+
+	// uuid 处理完成后，其余新增字段交给 AutoMigrate
+	if err := DB.AutoMigrate(&Image{}); err != nil {
+		log.Fatal("Failed to migrate images table:", err)
+	}
 }
 
 // migrateExistingImages 为现有图片生成 UUID
@@ -8,27 +8,47 @@ import (
 )
 
 type Image struct {
-	ID           uint           `gorm:"primarykey" json:"id"`
-	UUID         string         `gorm:"uniqueIndex" json:"uuid"` // 不使用 not null,由代码保证
-	CreatedAt    time.Time      `json:"created_at"`
-	UpdatedAt    time.Time      `json:"updated_at"`
-	DeletedAt    gorm.DeletedAt `gorm:"index" json:"-"`
-	UserID       uint           `gorm:"not null;index" json:"user_id"`
-	FileName     string         `gorm:"not null" json:"file_name"`
-	OriginalName string         `gorm:"not null" json:"original_name"`
-	FilePath     string         `gorm:"not null" json:"file_path"`
-	FileSize     int64          `json:"file_size"`
-	MimeType     string         `json:"mime_type"`
-	Width        int            `json:"width"`
-	Height       int            `json:"height"`
-	Hash         string         `gorm:"index" json:"hash"`
-	Description  string         `json:"description"`
-	Tags         string         `json:"tags"` // 逗号分隔的标签
-	IsPublic     bool           `gorm:"default:true" json:"is_public"`
-	User         User           `gorm:"foreignKey:UserID" json:"user,omitempty"`
-	Stats        *ImageStats    `gorm:"foreignKey:ImageID" json:"stats,omitempty"`
+	ID           uint              `gorm:"primarykey" json:"id"`
+	UUID         string            `gorm:"uniqueIndex" json:"uuid"` // 不使用 not null,由代码保证
+	CreatedAt    time.Time         `json:"created_at"`
+	UpdatedAt    time.Time         `json:"updated_at"`
+	DeletedAt    gorm.DeletedAt    `gorm:"index" json:"-"`
+	UserID       uint              `gorm:"not null;index" json:"user_id"`
+	FileName     string            `gorm:"not null" json:"file_name"`
+	OriginalName string            `gorm:"not null" json:"original_name"`
+	FilePath     string            `gorm:"not null" json:"file_path"`
+	FileSize     int64             `json:"file_size"`
+	MimeType     string            `json:"mime_type"`
+	Width        int               `json:"width"`
+	Height       int               `json:"height"`
+	Hash         string            `gorm:"index" json:"hash"`
+	OriginalHash string            `gorm:"index" json:"-"`          // 处理（压缩等）前原始文件的哈希
+	OriginalPath string            `json:"-"`                       // 未加水印的原图存储路径，仅所有者可访问
+	OriginalSize int64             `json:"original_size,omitempty"` // 原图大小，计入存储配额
+	Description  string            `json:"description"`
+	IsPublic     bool              `gorm:"default:true" json:"is_public"`
+	ReviewStatus string            `gorm:"size:16;default:'approved';index" json:"review_status"` // approved, pending, rejected
+	ReviewerID   *uint             `json:"reviewer_id,omitempty"`                                 // 审核的管理员
+	ReviewReason string            `json:"review_reason,omitempty"`                               // 拒绝原因
+	ReviewedAt   *time.Time        `json:"reviewed_at,omitempty"`
+	User         User              `gorm:"foreignKey:UserID" json:"user,omitempty"`
+	Stats        *ImageStats       `gorm:"foreignKey:ImageID" json:"stats,omitempty"`
+	Variants     []ImageVariant    `gorm:"foreignKey:ImageID" json:"variants"`
+	Tags         []Tag             `gorm:"many2many:image_tags" json:"tags"`
+	Exif         map[string]string `gorm:"serializer:json" json:"exif,omitempty"` // 上传时从原图读取的 EXIF 文本字段
 }
 
+// 图片审核状态，开启图片审核的用户上传的图片为待审核，通过前不能公开访问
+const (
+	ReviewApproved = "approved"
+	ReviewPending  = "pending"
+	ReviewRejected = "rejected"
+)
+
+// ReviewKeyPrefix 未通过审核的图片及其衍生图在存储中的路径前缀，
+// /uploads 静态路由不提供该前缀下的文件，只能通过 /i/:uuid 访问
+const ReviewKeyPrefix = "review/"
+
 // BeforeCreate hook to generate UUID
 func (img *Image) BeforeCreate(tx *gorm.DB) error {
 	if img.UUID == "" {
@@ -37,6 +57,11 @@ func (img *Image) BeforeCreate(tx *gorm.DB) error {
 	return nil
 }
 
+// IsApproved 图片是否已通过审核
+func (img *Image) IsApproved() bool {
+	return img.ReviewStatus == "" || img.ReviewStatus == ReviewApproved
+}
+
 type ImageStats struct {
 	ID        uint      `gorm:"primarykey" json:"id"`
 	ImageID   uint      `gorm:"uniqueIndex;not null" json:"image_id"`
@@ -44,15 +69,20 @@ type ImageStats struct {
 	UpdatedAt time.Time `json:"updated_at"`
 }
 
-// CreateImage 创建图片记录
+// CreateImage 创建图片记录并加入全文索引
 func CreateImage(image *Image) error {
-	return DB.Create(image).Error
+	return DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(image).Error; err != nil {
+			return err
+		}
+		return indexImage(tx, image)
+	})
 }
 
 // GetImageByID 根据ID获取图片
 func GetImageByID(id uint) (*Image, error) {
 	var image Image
-	if err := DB.Preload("User").Preload("Stats").First(&image, id).Error; err != nil {
+	if err := DB.Preload("User").Preload("Stats").Preload("Variants").Preload("Tags").First(&image, id).Error; err != nil {
 		return nil, err
 	}
 	return &image, nil
@@ -61,25 +91,49 @@ func GetImageByID(id uint) (*Image, error) {
 // GetImageByUUID 根据UUID获取图片
 func GetImageByUUID(uuid string) (*Image, error) {
 	var image Image
-	if err := DB.Preload("User").Preload("Stats").Where("uuid = ?", uuid).First(&image).Error; err != nil {
+	if err := DB.Preload("User").Preload("Stats").Preload("Variants").Preload("Tags").Where("uuid = ?", uuid).First(&image).Error; err != nil {
 		return nil, err
 	}
 	return &image, nil
 }
 
-// GetImagesByUserID 获取用户的所有图片
-func GetImagesByUserID(userID uint, page, pageSize int) ([]Image, int64, error) {
+// ImageFilter 用户图片列表的筛选条件
+type ImageFilter struct {
+	UserID  uint
+	Keyword string   // 匹配文件名、描述、标签和 EXIF，语法同 SearchFilter.Query
+	AlbumID uint     // 非 0 时只返回该相册中的图片，按相册内的顺序排列
+	Tags    []string // 精确匹配的标签，需先经过 NormalizeTags 处理
+	AnyTag  bool     // 为 true 时包含任意一个标签即可，否则需要包含全部标签
+
+	PublicOnly bool // 只返回公开且已通过审核的图片
+}
+
+// GetImages 按条件分页获取用户的图片
+func GetImages(filter ImageFilter, page, pageSize int) ([]Image, int64, error) {
 	var images []Image
 	var total int64
 
-	query := DB.Model(&Image{}).Where("user_id = ?", userID)
+	query := DB.Model(&Image{}).Where("images.user_id = ?", filter.UserID)
+	order := "images.created_at DESC"
+
+	query = matchKeywords(query, filter.Keyword)
+	if len(filter.Tags) > 0 {
+		query = query.Where("images.id IN (?)", ImageIDsWithTags(filter.Tags, !filter.AnyTag))
+	}
+	if filter.PublicOnly {
+		query = query.Where("images.is_public = ? AND images.review_status = ?", true, ReviewApproved)
+	}
+	if filter.AlbumID != 0 {
+		query = query.Joins("JOIN album_images ON album_images.image_id = images.id AND album_images.album_id = ?", filter.AlbumID)
+		order = "album_images.position, album_images.created_at"
+	}
 
 	if err := query.Count(&total).Error; err != nil {
 		return nil, 0, err
 	}
 
 	offset := (page - 1) * pageSize
-	if err := query.Preload("Stats").Order("created_at DESC").Offset(offset).Limit(pageSize).Find(&images).Error; err != nil {
+	if err := query.Preload("Stats").Preload("Variants").Preload("Tags").Order(order).Offset(offset).Limit(pageSize).Find(&images).Error; err != nil {
 		return nil, 0, err
 	}
 
@@ -96,47 +150,93 @@ func GetAllImages(page, pageSize int) ([]Image, int64, error) {
 	}
 
 	offset := (page - 1) * pageSize
-	if err := DB.Preload("User").Preload("Stats").Order("created_at DESC").Offset(offset).Limit(pageSize).Find(&images).Error; err != nil {
+	if err := DB.Preload("User").Preload("Stats").Preload("Variants").Preload("Tags").Order("created_at DESC").Offset(offset).Limit(pageSize).Find(&images).Error; err != nil {
 		return nil, 0, err
 	}
 
 	return images, total, nil
 }
 
-// UpdateImage 更新图片信息
-func (i *Image) Update() error {
-	return DB.Save(i).Error
-}
-
-// DeleteImage 删除图片
-func (i *Image) Delete() error {
-	return DB.Delete(i).Error
-}
-
-// SearchImages 搜索图片
-func SearchImages(userID uint, keyword string, page, pageSize int) ([]Image, int64, error) {
+// GetImagesByReviewStatus 按审核状态分页获取图片（管理员用），待审核的按上传时间先后排列
+func GetImagesByReviewStatus(status string, page, pageSize int) ([]Image, int64, error) {
 	var images []Image
 	var total int64
 
-	query := DB.Model(&Image{}).Where("user_id = ?", userID)
-
-	if keyword != "" {
-		query = query.Where("original_name LIKE ? OR description LIKE ? OR tags LIKE ?",
-			"%"+keyword+"%", "%"+keyword+"%", "%"+keyword+"%")
-	}
-
+	query := DB.Model(&Image{}).Where("review_status = ?", status)
 	if err := query.Count(&total).Error; err != nil {
 		return nil, 0, err
 	}
 
+	order := "reviewed_at DESC"
+	if status == ReviewPending {
+		order = "created_at ASC"
+	}
 	offset := (page - 1) * pageSize
-	if err := query.Preload("Stats").Order("created_at DESC").Offset(offset).Limit(pageSize).Find(&images).Error; err != nil {
+	if err := query.Preload("User").Preload("Variants").Preload("Tags").Order(order).Offset(offset).Limit(pageSize).Find(&images).Error; err != nil {
 		return nil, 0, err
 	}
 
 	return images, total, nil
 }
 
+// GetImagesByIDs 获取指定 ID 的图片及其衍生图
+func GetImagesByIDs(ids []uint) ([]Image, error) {
+	var images []Image
+	err := DB.Preload("Variants").Where("id IN ?", ids).Find(&images).Error
+	return images, err
+}
+
+// Review 设置图片的审核结果，同时保存调用方移动后的图片和衍生图存储路径
+func (i *Image) Review(status string, reviewerID uint, reason string) error {
+	now := time.Now()
+	return DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(i).Updates(map[string]interface{}{
+			"file_path":     i.FilePath,
+			"review_status": status,
+			"reviewer_id":   reviewerID,
+			"review_reason": reason,
+			"reviewed_at":   &now,
+		}).Error; err != nil {
+			return err
+		}
+		for _, variant := range i.Variants {
+			if err := tx.Model(&ImageVariant{}).Where("id = ?", variant.ID).Update("file_path", variant.FilePath).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// UpdateImage 更新图片信息并同步全文索引，需要同时修改标签时使用 UpdateWithTags
+func (i *Image) Update() error {
+	return DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Omit("Tags").Save(i).Error; err != nil {
+			return err
+		}
+		return indexImage(tx, i)
+	})
+}
+
+// DeleteImage 删除图片，同时将其移出所有相册和分享链接，并移除标签和全文索引
+func (i *Image) Delete() error {
+	return DB.Transaction(func(tx *gorm.DB) error {
+		if err := removeImageTags(tx, i.ID); err != nil {
+			return err
+		}
+		if err := unindexImage(tx, i.ID); err != nil {
+			return err
+		}
+		if err := removeImageFromAlbums(tx, i.ID); err != nil {
+			return err
+		}
+		if err := removeImageFromShareLinks(tx, i.ID); err != nil {
+			return err
+		}
+		return tx.Delete(i).Error
+	})
+}
+
 // IncrementViewCount 增加访问次数
 func IncrementViewCount(imageID uint) error {
 	var stats ImageStats
@@ -162,14 +262,14 @@ func IncrementViewCount(imageID uint) error {
 // GetUserStorageUsed 获取用户已使用的存储空间
 func GetUserStorageUsed(userID uint) (int64, error) {
 	var total int64
-	err := DB.Model(&Image{}).Where("user_id = ?", userID).Select("COALESCE(SUM(file_size), 0)").Scan(&total).Error
+	err := DB.Model(&Image{}).Where("user_id = ?", userID).Select("COALESCE(SUM(file_size + COALESCE(original_size, 0)), 0)").Scan(&total).Error
 	return total, err
 }
 
-// GetImageByHash 根据哈希值查找图片（用于去重）
+// GetImageByHash 根据哈希值查找图片（用于去重），同时匹配处理后和原始文件的哈希
 func GetImageByHash(hash string, userID uint) (*Image, error) {
 	var image Image
-	err := DB.Where("hash = ? AND user_id = ?", hash, userID).First(&image).Error
+	err := DB.Where("(hash = ? OR original_hash = ?) AND user_id = ?", hash, hash, userID).First(&image).Error
 	if err != nil {
 		return nil, err
 	}
@@ -0,0 +1,104 @@
+package models
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// 注册模式，保存在系统设置 SettingRegistrationMode 中
+const (
+	RegistrationOpen   = "open"   // 任何人都可以注册
+	RegistrationInvite = "invite" // 必须使用邀请码
+	RegistrationDomain = "domain" // 邮箱域名在白名单中，或使用邀请码
+	RegistrationClosed = "closed" // 关闭注册
+)
+
+// inviteCodeAlphabet 邀请码字符集，去掉了容易混淆的 0/O、1/I/L
+const inviteCodeAlphabet = "ABCDEFGHJKMNPQRSTUVWXYZ23456789"
+
+var ErrInviteCodeInvalid = errors.New("邀请码无效、已过期或已用完")
+
+// InviteCode 管理员生成的注册邀请码，可以预设新用户的角色和存储配额
+type InviteCode struct {
+	ID           uint       `gorm:"primarykey" json:"id"`
+	CreatedAt    time.Time  `json:"created_at"`
+	UpdatedAt    time.Time  `json:"updated_at"`
+	Code         string     `gorm:"size:32;not null;uniqueIndex" json:"code"`
+	Note         string     `json:"note"`
+	CreatedBy    uint       `json:"created_by"`
+	MaxUses      int        `json:"max_uses"` // 0 表示不限次数
+	UsedCount    int        `gorm:"default:0" json:"used_count"`
+	ExpiresAt    *time.Time `json:"expires_at"` // 为空表示永不过期
+	Role         string     `gorm:"default:'user'" json:"role"`
+	StorageQuota *int64     `json:"storage_quota"` // 为空使用默认配额，0 表示无限制
+}
+
+// CreateInviteCode 保存邀请码，code 为空时随机生成
+func CreateInviteCode(invite *InviteCode) error {
+	if invite.Code == "" {
+		code, err := randomCode(inviteCodeAlphabet, 12)
+		if err != nil {
+			return err
+		}
+		invite.Code = code
+	}
+	invite.Code = NormalizeInviteCode(invite.Code)
+	return DB.Create(invite).Error
+}
+
+// GetInviteCodes 分页获取所有邀请码
+func GetInviteCodes(page, pageSize int) ([]InviteCode, int64, error) {
+	var invites []InviteCode
+	var total int64
+
+	if err := DB.Model(&InviteCode{}).Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	offset := (page - 1) * pageSize
+	err := DB.Order("created_at DESC").Offset(offset).Limit(pageSize).Find(&invites).Error
+	return invites, total, err
+}
+
+// DeleteInviteCode 删除邀请码，已用它注册的用户不受影响
+func DeleteInviteCode(id uint) error {
+	result := DB.Delete(&InviteCode{}, id)
+	if result.Error == nil && result.RowsAffected == 0 {
+		return errors.New("邀请码不存在")
+	}
+	return result.Error
+}
+
+// UseInviteCode 占用邀请码的一次使用次数，次数检查和递增在同一条语句中完成，并发注册不会超用
+func UseInviteCode(code string) (*InviteCode, error) {
+	code = NormalizeInviteCode(code)
+	result := DB.Model(&InviteCode{}).
+		Where("code = ? AND (max_uses = 0 OR used_count < max_uses) AND (expires_at IS NULL OR expires_at > ?)", code, time.Now()).
+		Update("used_count", gorm.Expr("used_count + ?", 1))
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil, ErrInviteCodeInvalid
+	}
+
+	var invite InviteCode
+	if err := DB.Where("code = ?", code).First(&invite).Error; err != nil {
+		return nil, err
+	}
+	return &invite, nil
+}
+
+// Release 注册失败时归还占用的使用次数
+func (i *InviteCode) Release() error {
+	return DB.Model(&InviteCode{}).Where("id = ? AND used_count > 0", i.ID).
+		Update("used_count", gorm.Expr("used_count - ?", 1)).Error
+}
+
+// NormalizeInviteCode 邀请码不区分大小写，忽略首尾空白
+func NormalizeInviteCode(code string) string {
+	return strings.ToUpper(strings.TrimSpace(code))
+}
@@ -0,0 +1,44 @@
+package models
+
+import "time"
+
+// LoginThrottle 一个用户名或 IP 的登录失败记录，Key 形如 user:alice 或 ip:203.0.113.7
+type LoginThrottle struct {
+	Key           string     `gorm:"primarykey;size:191" json:"key"`
+	Failures      int        `json:"failures"`
+	LastFailureAt time.Time  `json:"last_failure_at"`
+	LockedUntil   *time.Time `gorm:"index" json:"locked_until"`
+	UpdatedAt     time.Time  `json:"updated_at"`
+}
+
+// GetLoginThrottle 获取失败记录
+func GetLoginThrottle(key string) (*LoginThrottle, error) {
+	var throttle LoginThrottle
+	if err := DB.Where("key = ?", key).First(&throttle).Error; err != nil {
+		return nil, err
+	}
+	return &throttle, nil
+}
+
+// SaveLoginThrottle 保存失败记录
+func SaveLoginThrottle(throttle *LoginThrottle) error {
+	return DB.Save(throttle).Error
+}
+
+// DeleteLoginThrottle 删除失败记录（登录成功或解除锁定）
+func DeleteLoginThrottle(key string) error {
+	return DB.Where("key = ?", key).Delete(&LoginThrottle{}).Error
+}
+
+// GetLockedLoginThrottles 获取当前处于锁定状态的记录
+func GetLockedLoginThrottles() ([]LoginThrottle, error) {
+	var throttles []LoginThrottle
+	err := DB.Where("locked_until > ?", time.Now()).Order("locked_until DESC").Find(&throttles).Error
+	return throttles, err
+}
+
+// DeleteStaleLoginThrottles 删除 before 之后没有再失败且未锁定的记录
+func DeleteStaleLoginThrottles(before time.Time) error {
+	return DB.Where("last_failure_at < ? AND (locked_until IS NULL OR locked_until < ?)", before, time.Now()).
+		Delete(&LoginThrottle{}).Error
+}
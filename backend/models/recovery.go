@@ -0,0 +1,101 @@
+package models
+
+import (
+	"crypto/rand"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// recoveryCodeCount 每次生成的恢复码数量
+const recoveryCodeCount = 10
+
+// recoveryCodeAlphabet 恢复码字符集，去掉了容易混淆的 0/o、1/l/i
+const recoveryCodeAlphabet = "abcdefghjkmnpqrstuvwxyz23456789"
+
+// RecoveryCode 两步验证的一次性恢复码，只保存哈希
+type RecoveryCode struct {
+	ID        uint `gorm:"primarykey"`
+	CreatedAt time.Time
+	UserID    uint   `gorm:"not null;index"`
+	CodeHash  string `gorm:"not null;index"`
+	UsedAt    *time.Time
+}
+
+// GenerateRecoveryCodes 生成一组新的恢复码并替换旧的，返回明文（形如 abcde-fghjk）
+func GenerateRecoveryCodes(userID uint) ([]string, error) {
+	codes := make([]string, recoveryCodeCount)
+	records := make([]RecoveryCode, recoveryCodeCount)
+	for i := range codes {
+		code, err := randomRecoveryCode()
+		if err != nil {
+			return nil, err
+		}
+		codes[i] = code
+		records[i] = RecoveryCode{UserID: userID, CodeHash: hashAPIToken(normalizeRecoveryCode(code))}
+	}
+
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("user_id = ?", userID).Delete(&RecoveryCode{}).Error; err != nil {
+			return err
+		}
+		return tx.Create(&records).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// UseRecoveryCode 使用恢复码，成功返回 true，每个恢复码只能使用一次
+func UseRecoveryCode(userID uint, code string) bool {
+	hash := hashAPIToken(normalizeRecoveryCode(code))
+	result := DB.Model(&RecoveryCode{}).
+		Where("user_id = ? AND code_hash = ? AND used_at IS NULL", userID, hash).
+		Update("used_at", time.Now())
+	return result.Error == nil && result.RowsAffected > 0
+}
+
+// CountRecoveryCodes 获取剩余可用的恢复码数量
+func CountRecoveryCodes(userID uint) int64 {
+	var count int64
+	DB.Model(&RecoveryCode{}).Where("user_id = ? AND used_at IS NULL", userID).Count(&count)
+	return count
+}
+
+// DeleteRecoveryCodes 删除用户的所有恢复码
+func DeleteRecoveryCodes(userID uint) error {
+	return DB.Where("user_id = ?", userID).Delete(&RecoveryCode{}).Error
+}
+
+func randomRecoveryCode() (string, error) {
+	code, err := randomCode(recoveryCodeAlphabet, 10)
+	if err != nil {
+		return "", err
+	}
+	return code[:5] + "-" + code[5:], nil
+}
+
+// randomCode 从字符集中均匀随机取 n 个字符
+func randomCode(alphabet string, n int) (string, error) {
+	// 丢弃超出字符集整数倍的字节，避免取模带来的偏差
+	limit := byte(256 - 256%len(alphabet))
+	code := make([]byte, 0, n)
+	buf := make([]byte, 16)
+	for len(code) < cap(code) {
+		if _, err := rand.Read(buf); err != nil {
+			return "", err
+		}
+		for _, b := range buf {
+			if b < limit && len(code) < cap(code) {
+				code = append(code, alphabet[int(b)%len(alphabet)])
+			}
+		}
+	}
+	return string(code), nil
+}
+
+func normalizeRecoveryCode(code string) string {
+	return strings.ToLower(strings.NewReplacer("-", "", " ", "").Replace(code))
+}
@@ -0,0 +1,357 @@
+package models
+
+import (
+	"html"
+	"log"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// 全文索引 images_fts 是 FTS5 虚拟表，rowid 为图片ID。
+// mattn/go-sqlite3 默认不包含 FTS5，需要使用 -tags sqlite_fts5 编译，否则搜索退回 LIKE 匹配
+const createSearchTableSQL = "CREATE VIRTUAL TABLE IF NOT EXISTS images_fts USING fts5(original_name, description, tags, exif, tokenize = 'unicode61 remove_diacritics 2')"
+
+// searchRank 各列的权重依次为文件名、描述、标签、EXIF
+const searchRank = "bm25(images_fts, 10.0, 5.0, 8.0, 2.0)"
+
+// 摘要中匹配内容的标记，输出前替换为 <mark>
+const (
+	snippetOpen  = "\x02"
+	snippetClose = "\x03"
+)
+
+// searchEnabled 当前的 SQLite 是否支持 FTS5，在 InitDB 中检测
+var searchEnabled bool
+
+// SearchFilter 图片搜索条件，零值表示不限制
+type SearchFilter struct {
+	UserID    uint
+	Query     string   // 空格分隔的关键词需全部匹配，"..." 为短语，词尾 * 为前缀匹配
+	Tags      []string // 精确匹配的标签，需先经过 NormalizeTags 处理
+	AnyTag    bool
+	From      *time.Time // 上传时间范围，包含 From，不包含 To
+	To        *time.Time
+	MimeTypes []string
+	MinSize   int64
+	MaxSize   int64
+	MinWidth  int
+	MaxWidth  int
+	MinHeight int
+	MaxHeight int
+}
+
+// SearchResult 搜索结果，Snippet 为匹配内容的摘要，匹配部分用 <mark> 标出，其余内容已转义
+type SearchResult struct {
+	Image
+	Snippet string `json:"snippet,omitempty"`
+}
+
+// searchTerm 搜索关键词或短语
+type searchTerm struct {
+	Text   string
+	Prefix bool
+}
+
+// SearchEnabled 是否使用 FTS5 全文搜索
+func SearchEnabled() bool {
+	return searchEnabled
+}
+
+// SearchImages 搜索用户的图片。支持 FTS5 时按相关度排序并返回摘要，否则按上传时间排序
+func SearchImages(filter SearchFilter, page, pageSize int) ([]SearchResult, int64, error) {
+	query := DB.Table("images").Where("images.user_id = ? AND images.deleted_at IS NULL", filter.UserID)
+	query = applySearchFilter(query, filter)
+
+	terms := parseSearchTerms(filter.Query)
+	useFTS := searchEnabled && len(terms) > 0
+	if useFTS {
+		query = query.Joins("JOIN images_fts ON images_fts.rowid = images.id").Where("images_fts MATCH ?", buildMatchQuery(terms))
+	} else {
+		query = likeKeywords(query, terms)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	var hits []struct {
+		ID      uint
+		Snippet string
+	}
+	offset := (page - 1) * pageSize
+	if useFTS {
+		query = query.Select("images.id, snippet(images_fts, -1, ?, ?, '…', 16) AS snippet", snippetOpen, snippetClose).
+			Order(searchRank + ", images.created_at DESC")
+	} else {
+		query = query.Select("images.id").Order("images.created_at DESC")
+	}
+	if err := query.Offset(offset).Limit(pageSize).Scan(&hits).Error; err != nil {
+		return nil, 0, err
+	}
+
+	ids := make([]uint, len(hits))
+	for i, hit := range hits {
+		ids[i] = hit.ID
+	}
+	var images []Image
+	if err := DB.Preload("Stats").Preload("Variants").Preload("Tags").Where("id IN ?", ids).Find(&images).Error; err != nil {
+		return nil, 0, err
+	}
+	byID := make(map[uint]Image, len(images))
+	for _, image := range images {
+		byID[image.ID] = image
+	}
+
+	results := make([]SearchResult, 0, len(hits))
+	for _, hit := range hits {
+		if image, ok := byID[hit.ID]; ok {
+			results = append(results, SearchResult{Image: image, Snippet: formatSnippet(hit.Snippet)})
+		}
+	}
+	return results, total, nil
+}
+
+// matchKeywords 筛选匹配关键词的图片，不改变排序。支持 FTS5 时使用全文索引，否则使用 LIKE 匹配
+func matchKeywords(query *gorm.DB, q string) *gorm.DB {
+	terms := parseSearchTerms(q)
+	if len(terms) == 0 {
+		return query
+	}
+	if !searchEnabled {
+		return likeKeywords(query, terms)
+	}
+	matched := DB.Table("images_fts").Select("rowid").Where("images_fts MATCH ?", buildMatchQuery(terms))
+	return query.Where("images.id IN (?)", matched)
+}
+
+// likeKeywords 不支持 FTS5 时的匹配方式，每个关键词都需要出现在文件名、描述、EXIF 或标签中
+func likeKeywords(query *gorm.DB, terms []searchTerm) *gorm.DB {
+	for _, term := range terms {
+		like := "%" + escapeLike(term.Text) + "%"
+		tagged := DB.Table("image_tags").Joins("JOIN tags ON tags.id = image_tags.tag_id").
+			Where("tags.name LIKE ? ESCAPE '\\'", like).Select("image_tags.image_id")
+		query = query.Where("(images.original_name LIKE ? ESCAPE '\\' OR images.description LIKE ? ESCAPE '\\' OR images.exif LIKE ? ESCAPE '\\' OR images.id IN (?))",
+			like, like, like, tagged)
+	}
+	return query
+}
+
+// applySearchFilter 添加标签、时间、类型、大小和尺寸条件
+func applySearchFilter(query *gorm.DB, filter SearchFilter) *gorm.DB {
+	if len(filter.Tags) > 0 {
+		query = query.Where("images.id IN (?)", ImageIDsWithTags(filter.Tags, !filter.AnyTag))
+	}
+	if filter.From != nil {
+		query = query.Where("images.created_at >= ?", *filter.From)
+	}
+	if filter.To != nil {
+		query = query.Where("images.created_at < ?", *filter.To)
+	}
+	if len(filter.MimeTypes) > 0 {
+		query = query.Where("images.mime_type IN ?", filter.MimeTypes)
+	}
+	if filter.MinSize > 0 {
+		query = query.Where("images.file_size >= ?", filter.MinSize)
+	}
+	if filter.MaxSize > 0 {
+		query = query.Where("images.file_size <= ?", filter.MaxSize)
+	}
+	if filter.MinWidth > 0 {
+		query = query.Where("images.width >= ?", filter.MinWidth)
+	}
+	if filter.MaxWidth > 0 {
+		query = query.Where("images.width <= ?", filter.MaxWidth)
+	}
+	if filter.MinHeight > 0 {
+		query = query.Where("images.height >= ?", filter.MinHeight)
+	}
+	if filter.MaxHeight > 0 {
+		query = query.Where("images.height <= ?", filter.MaxHeight)
+	}
+	return query
+}
+
+// parseSearchTerms 拆分搜索字符串，"..." 中的内容作为一个短语，词尾的 * 表示前缀匹配
+func parseSearchTerms(q string) []searchTerm {
+	var terms []searchTerm
+	add := func(text string, phrase bool) {
+		prefix := false
+		if !phrase {
+			prefix = strings.HasSuffix(text, "*")
+			text = strings.TrimRight(text, "*")
+		}
+		text = strings.TrimSpace(strings.ReplaceAll(text, "\"", ""))
+		if text != "" {
+			terms = append(terms, searchTerm{Text: text, Prefix: prefix})
+		}
+	}
+
+	for q = strings.TrimSpace(q); q != ""; q = strings.TrimSpace(q) {
+		if q[0] == '"' {
+			end := strings.IndexByte(q[1:], '"')
+			if end < 0 {
+				add(q[1:], true)
+				break
+			}
+			phrase := q[1 : end+1]
+			q = q[end+2:]
+			// 短语后紧跟 * 时对短语最后一个词做前缀匹配
+			if strings.HasPrefix(q, "*") {
+				phrase += "*"
+				q = q[1:]
+				add(phrase, false)
+			} else {
+				add(phrase, true)
+			}
+			continue
+		}
+		end := strings.IndexFunc(q, unicode.IsSpace)
+		if end < 0 {
+			end = len(q)
+		}
+		add(q[:end], false)
+		q = q[end:]
+	}
+	return terms
+}
+
+// buildMatchQuery 将关键词转为 FTS5 查询，每个关键词都作为带引号的短语，用户输入中的 FTS5 语法不会生效
+func buildMatchQuery(terms []searchTerm) string {
+	parts := make([]string, len(terms))
+	for i, term := range terms {
+		parts[i] = "\"" + strings.ReplaceAll(searchText(term.Text), "\"", "\"\"") + "\""
+		if term.Prefix {
+			parts[i] += "*"
+		}
+	}
+	return strings.Join(parts, " ")
+}
+
+// isCJK 中日韩文字没有空格分词，索引时按单字拆开
+func isCJK(r rune) bool {
+	return unicode.In(r, unicode.Han, unicode.Hiragana, unicode.Katakana, unicode.Hangul)
+}
+
+// cjkSeparator 分隔中日韩文字的零宽空格，unicode61 分词器将其视为分隔符，生成摘要时去掉
+const cjkSeparator = '\u200b'
+
+// searchText 在中日韩文字两侧插入分隔符，使 unicode61 分词器把每个字作为一个词，
+// 查询时连续的文字作为短语匹配
+func searchText(s string) string {
+	var b strings.Builder
+	prevCJK, prevSpace := false, true
+	for _, r := range s {
+		cjk := isCJK(r)
+		space := unicode.IsSpace(r)
+		if (cjk || prevCJK) && !prevSpace && !space {
+			b.WriteRune(cjkSeparator)
+		}
+		b.WriteRune(r)
+		prevCJK, prevSpace = cjk, space
+	}
+	return b.String()
+}
+
+// formatSnippet 去掉索引时插入的分隔符，转义 HTML 并把匹配标记换成 <mark>
+func formatSnippet(s string) string {
+	if s == "" {
+		return ""
+	}
+	s = html.EscapeString(strings.ReplaceAll(s, string(cjkSeparator), ""))
+	return strings.NewReplacer(snippetOpen, "<mark>", snippetClose, "</mark>").Replace(s)
+}
+
+// initSearchIndex 创建全文索引。SQLite 不支持 FTS5 时只记录日志，搜索使用 LIKE 匹配；
+// 此时已有的索引无法更新，记下来在下次支持 FTS5 启动时重建
+func initSearchIndex() {
+	existed := DB.Migrator().HasTable("images_fts")
+	// 不支持 FTS5 是正常情况，不需要 GORM 再输出错误日志
+	silent := DB.Session(&gorm.Session{Logger: logger.Default.LogMode(logger.Silent)})
+	// 表已存在时 CREATE ... IF NOT EXISTS 不会加载 FTS5 模块，需要再查询一次确认可用
+	err := silent.Exec(createSearchTableSQL).Error
+	if err == nil {
+		err = silent.Exec("SELECT rowid FROM images_fts LIMIT 0").Error
+	}
+	if err != nil {
+		log.Printf("全文搜索不可用，图片搜索将使用 LIKE 匹配（需要使用 -tags sqlite_fts5 编译）: %v", err)
+		if existed {
+			if err := SetSetting(SettingSearchIndexStale, "true"); err != nil {
+				log.Printf("记录全文索引状态失败: %v", err)
+			}
+		}
+		return
+	}
+	searchEnabled = true
+
+	if existed && !GetBoolSetting(SettingSearchIndexStale, false) {
+		return
+	}
+	if err := RebuildSearchIndex(); err != nil {
+		log.Fatal("Failed to build search index:", err)
+	}
+	if err := SetSetting(SettingSearchIndexStale, "false"); err != nil {
+		log.Printf("记录全文索引状态失败: %v", err)
+	}
+}
+
+// RebuildSearchIndex 按图片表重建全文索引
+func RebuildSearchIndex() error {
+	if err := DB.Exec("DELETE FROM images_fts").Error; err != nil {
+		return err
+	}
+
+	var images []Image
+	count := 0
+	result := DB.Preload("Tags").FindInBatches(&images, 200, func(tx *gorm.DB, batch int) error {
+		for i := range images {
+			if err := indexImage(DB, &images[i]); err != nil {
+				return err
+			}
+		}
+		count += len(images)
+		return nil
+	})
+	if result.Error != nil {
+		return result.Error
+	}
+	log.Printf("Search index built for %d images", count)
+	return nil
+}
+
+// indexImage 更新图片在全文索引中的内容，img.Tags 需为最新的标签
+func indexImage(tx *gorm.DB, img *Image) error {
+	if !searchEnabled {
+		return nil
+	}
+	if err := unindexImage(tx, img.ID); err != nil {
+		return err
+	}
+
+	tags := make([]string, len(img.Tags))
+	for i, tag := range img.Tags {
+		tags[i] = tag.Name
+	}
+	exif := make([]string, 0, len(img.Exif))
+	for _, value := range img.Exif {
+		exif = append(exif, value)
+	}
+	sort.Strings(exif)
+
+	return tx.Exec("INSERT INTO images_fts (rowid, original_name, description, tags, exif) VALUES (?, ?, ?, ?, ?)",
+		img.ID, searchText(img.OriginalName), searchText(img.Description),
+		searchText(strings.Join(tags, ", ")), searchText(strings.Join(exif, ", "))).Error
+}
+
+// unindexImage 从全文索引中移除图片
+func unindexImage(tx *gorm.DB, imageID uint) error {
+	if !searchEnabled {
+		return nil
+	}
+	return tx.Exec("DELETE FROM images_fts WHERE rowid = ?", imageID).Error
+}
@@ -0,0 +1,153 @@
+package models
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// ErrRefreshTokenReused 已轮换的刷新令牌被再次使用，可能已经泄露，对应会话会被吊销
+var ErrRefreshTokenReused = errors.New("刷新令牌已被使用")
+
+// Session 登录会话，每次登录创建一个。访问令牌（JWT）中携带会话 ID，
+// 刷新令牌只保存哈希，每次刷新都会轮换
+type Session struct {
+	ID           string     `gorm:"primarykey;size:36" json:"id"`
+	CreatedAt    time.Time  `json:"created_at"`
+	UpdatedAt    time.Time  `json:"updated_at"`
+	UserID       uint       `gorm:"not null;index" json:"user_id"`
+	RefreshHash  string     `gorm:"not null;uniqueIndex" json:"-"` // 当前刷新令牌的 SHA-256
+	PreviousHash string     `gorm:"index" json:"-"`                // 上一个刷新令牌，用于发现重复使用
+	UserAgent    string     `json:"user_agent"`
+	IP           string     `json:"ip"`
+	LastUsedAt   time.Time  `json:"last_used_at"`
+	ExpiresAt    time.Time  `gorm:"index" json:"expires_at"`
+	RevokedAt    *time.Time `json:"revoked_at,omitempty"`
+}
+
+// CreateSession 创建会话，返回刷新令牌明文
+func CreateSession(userID uint, userAgent, ip string, expiresAt time.Time) (*Session, string, error) {
+	secret, err := newRefreshToken()
+	if err != nil {
+		return nil, "", err
+	}
+
+	now := time.Now()
+	session := &Session{
+		ID:          uuid.New().String(),
+		UserID:      userID,
+		RefreshHash: hashAPIToken(secret),
+		UserAgent:   userAgent,
+		IP:          ip,
+		LastUsedAt:  now,
+		ExpiresAt:   expiresAt,
+	}
+	if err := DB.Create(session).Error; err != nil {
+		return nil, "", err
+	}
+	return session, secret, nil
+}
+
+// RotateSession 用刷新令牌换取新的刷新令牌，并顺延会话有效期。
+// 已轮换掉的令牌再次出现时吊销整个会话并返回 ErrRefreshTokenReused
+func RotateSession(secret, ip string, expiresAt time.Time) (*Session, string, error) {
+	hash := hashAPIToken(secret)
+
+	var session Session
+	err := DB.Where("refresh_hash = ? AND revoked_at IS NULL AND expires_at > ?", hash, time.Now()).First(&session).Error
+	if err != nil {
+		var reused Session
+		if DB.Where("previous_hash = ? AND revoked_at IS NULL", hash).First(&reused).Error == nil {
+			reused.Revoke()
+			return nil, "", ErrRefreshTokenReused
+		}
+		return nil, "", err
+	}
+
+	newSecret, err := newRefreshToken()
+	if err != nil {
+		return nil, "", err
+	}
+
+	// 以旧哈希为条件更新，并发使用同一个令牌时只有一个请求能成功
+	now := time.Now()
+	result := DB.Model(&Session{}).Where("id = ? AND refresh_hash = ?", session.ID, hash).Updates(map[string]interface{}{
+		"refresh_hash":  hashAPIToken(newSecret),
+		"previous_hash": hash,
+		"ip":            ip,
+		"last_used_at":  now,
+		"expires_at":    expiresAt,
+	})
+	if result.Error != nil {
+		return nil, "", result.Error
+	}
+	if result.RowsAffected == 0 {
+		session.Revoke()
+		return nil, "", ErrRefreshTokenReused
+	}
+
+	session.IP = ip
+	session.LastUsedAt = now
+	session.ExpiresAt = expiresAt
+	return &session, newSecret, nil
+}
+
+// GetSessionByRefreshToken 根据刷新令牌查找会话（不检查是否有效）
+func GetSessionByRefreshToken(secret string) (*Session, error) {
+	var session Session
+	if err := DB.Where("refresh_hash = ?", hashAPIToken(secret)).First(&session).Error; err != nil {
+		return nil, err
+	}
+	return &session, nil
+}
+
+// GetActiveSession 获取用户未过期且未吊销的会话
+func GetActiveSession(id string, userID uint) (*Session, error) {
+	var session Session
+	err := DB.Where("id = ? AND user_id = ? AND revoked_at IS NULL AND expires_at > ?", id, userID, time.Now()).
+		First(&session).Error
+	if err != nil {
+		return nil, err
+	}
+	return &session, nil
+}
+
+// GetActiveSessionsByUserID 获取用户所有有效会话
+func GetActiveSessionsByUserID(userID uint) ([]Session, error) {
+	var sessions []Session
+	err := DB.Where("user_id = ? AND revoked_at IS NULL AND expires_at > ?", userID, time.Now()).
+		Order("last_used_at DESC").Find(&sessions).Error
+	return sessions, err
+}
+
+// Revoke 吊销会话
+func (s *Session) Revoke() error {
+	now := time.Now()
+	s.RevokedAt = &now
+	return DB.Model(s).Update("revoked_at", now).Error
+}
+
+// RevokeUserSessions 吊销用户的所有会话，exceptID 不为空时保留该会话
+func RevokeUserSessions(userID uint, exceptID string) error {
+	query := DB.Model(&Session{}).Where("user_id = ? AND revoked_at IS NULL", userID)
+	if exceptID != "" {
+		query = query.Where("id <> ?", exceptID)
+	}
+	return query.Update("revoked_at", time.Now()).Error
+}
+
+// DeleteExpiredSessions 删除已过期的会话
+func DeleteExpiredSessions() error {
+	return DB.Where("expires_at <= ?", time.Now()).Delete(&Session{}).Error
+}
+
+func newRefreshToken() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf), nil
+}
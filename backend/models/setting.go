@@ -0,0 +1,45 @@
+package models
+
+import (
+	"strconv"
+	"time"
+)
+
+// 系统设置项，由管理员在运行时修改
+const (
+	SettingRequireAdmin2FA          = "require_admin_2fa"          // 管理员角色必须开启两步验证
+	SettingRequireEmailVerification = "require_email_verification" // 新注册用户验证邮箱后才能登录
+	SettingRegistrationMode         = "registration_mode"          // open, invite, domain, closed
+	SettingRegistrationDomains      = "registration_domains"       // domain 模式允许的邮箱域名，逗号分隔
+	SettingSearchIndexStale         = "search_index_stale"         // 全文索引未随图片更新，需要重建
+)
+
+// Setting 系统设置键值对
+type Setting struct {
+	Key       string    `gorm:"primarykey;size:64" json:"key"`
+	Value     string    `json:"value"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// GetSetting 获取设置值，不存在时返回默认值
+func GetSetting(key, defaultValue string) string {
+	var setting Setting
+	if err := DB.Where("key = ?", key).First(&setting).Error; err != nil {
+		return defaultValue
+	}
+	return setting.Value
+}
+
+// GetBoolSetting 获取布尔类型的设置值
+func GetBoolSetting(key string, defaultValue bool) bool {
+	value, err := strconv.ParseBool(GetSetting(key, ""))
+	if err != nil {
+		return defaultValue
+	}
+	return value
+}
+
+// SetSetting 保存设置值
+func SetSetting(key, value string) error {
+	return DB.Save(&Setting{Key: key, Value: value}).Error
+}
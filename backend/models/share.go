@@ -0,0 +1,218 @@
+package models
+
+import (
+	"errors"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+)
+
+// shareTokenAlphabet 分享链接标识的字符集
+const shareTokenAlphabet = "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789"
+
+// ErrShareImagesNotOwned 分享了不存在或不属于自己的图片
+var ErrShareImagesNotOwned = errors.New("只能分享自己的图片")
+
+// ShareLink 一组图片的分享链接，无需登录即可通过 Token 访问
+type ShareLink struct {
+	ID            uint       `gorm:"primarykey" json:"id"`
+	CreatedAt     time.Time  `json:"created_at"`
+	UpdatedAt     time.Time  `json:"updated_at"`
+	Token         string     `gorm:"size:32;uniqueIndex;not null" json:"token"`
+	UserID        uint       `gorm:"not null;index" json:"user_id"`
+	Title         string     `gorm:"size:100" json:"title"`
+	Description   string     `json:"description"`
+	PasswordHash  string     `json:"-"`
+	ExpiresAt     *time.Time `json:"expires_at"` // 为空表示永不过期
+	AllowDownload bool       `json:"allow_download"`
+	ViewCount     int64      `gorm:"not null;default:0" json:"view_count"`
+	LastViewedAt  *time.Time `json:"last_viewed_at"`
+	HasPassword   bool       `gorm:"-" json:"has_password"`
+	ImageCount    int64      `gorm:"->;-:migration" json:"image_count"` // 查询时统计
+	URL           string     `gorm:"-" json:"url,omitempty"`            // 分享页面地址，由接口填充
+}
+
+// ShareLinkImage 分享链接包含的图片，按 Position 排列
+type ShareLinkImage struct {
+	ShareLinkID uint `gorm:"primarykey;autoIncrement:false"`
+	ImageID     uint `gorm:"primarykey;autoIncrement:false;index"`
+	Position    int  `gorm:"not null;default:0"`
+}
+
+// AfterFind 标记是否设置了访问密码
+func (s *ShareLink) AfterFind(tx *gorm.DB) error {
+	s.HasPassword = s.PasswordHash != ""
+	return nil
+}
+
+// shareLinkWithCount 查询分享链接时附带图片数量
+func shareLinkWithCount() *gorm.DB {
+	return DB.Model(&ShareLink{}).
+		Select("share_links.*, (SELECT COUNT(*) FROM share_link_images WHERE share_link_images.share_link_id = share_links.id) AS image_count")
+}
+
+// CreateShareLink 创建分享链接，imageIDs 必须都是创建者自己的图片
+func CreateShareLink(link *ShareLink, imageIDs []uint) error {
+	token, err := randomCode(shareTokenAlphabet, 22)
+	if err != nil {
+		return err
+	}
+	link.Token = token
+
+	return DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(link).Error; err != nil {
+			return err
+		}
+		return setShareLinkImages(tx, link, imageIDs)
+	})
+}
+
+// GetShareLinkByID 根据ID获取分享链接
+func GetShareLinkByID(id uint) (*ShareLink, error) {
+	var link ShareLink
+	if err := shareLinkWithCount().Where("share_links.id = ?", id).First(&link).Error; err != nil {
+		return nil, err
+	}
+	return &link, nil
+}
+
+// GetShareLinkByToken 根据 Token 获取分享链接
+func GetShareLinkByToken(token string) (*ShareLink, error) {
+	var link ShareLink
+	if err := shareLinkWithCount().Where("share_links.token = ?", token).First(&link).Error; err != nil {
+		return nil, err
+	}
+	return &link, nil
+}
+
+// GetShareLinksByUserID 分页获取用户的分享链接，最新创建的在前
+func GetShareLinksByUserID(userID uint, page, pageSize int) ([]ShareLink, int64, error) {
+	var links []ShareLink
+	var total int64
+
+	if err := DB.Model(&ShareLink{}).Where("user_id = ?", userID).Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	offset := (page - 1) * pageSize
+	err := shareLinkWithCount().Where("share_links.user_id = ?", userID).Order("share_links.id DESC").Offset(offset).Limit(pageSize).Find(&links).Error
+	return links, total, err
+}
+
+// SetPassword 设置访问密码，为空时取消密码
+func (s *ShareLink) SetPassword(password string) error {
+	s.HasPassword = password != ""
+	if password == "" {
+		s.PasswordHash = ""
+		return nil
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return err
+	}
+	s.PasswordHash = string(hash)
+	return nil
+}
+
+// CheckPassword 校验访问密码，未设置密码时总是通过
+func (s *ShareLink) CheckPassword(password string) bool {
+	if s.PasswordHash == "" {
+		return true
+	}
+	return bcrypt.CompareHashAndPassword([]byte(s.PasswordHash), []byte(password)) == nil
+}
+
+// IsExpired 分享链接是否已过期
+func (s *ShareLink) IsExpired() bool {
+	return s.ExpiresAt != nil && time.Now().After(*s.ExpiresAt)
+}
+
+// Update 更新分享链接设置，imageIDs 不为 nil 时同时替换图片列表
+func (s *ShareLink) Update(imageIDs []uint) error {
+	return DB.Transaction(func(tx *gorm.DB) error {
+		err := tx.Model(s).Select("title", "description", "password_hash", "expires_at", "allow_download").Updates(s).Error
+		if err != nil || imageIDs == nil {
+			return err
+		}
+		return setShareLinkImages(tx, s, imageIDs)
+	})
+}
+
+// Delete 删除分享链接，图片不受影响
+func (s *ShareLink) Delete() error {
+	return DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("share_link_id = ?", s.ID).Delete(&ShareLinkImage{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(s).Error
+	})
+}
+
+// GetImages 按分享时的顺序获取分享的图片
+func (s *ShareLink) GetImages() ([]Image, error) {
+	var images []Image
+	err := DB.Joins("JOIN share_link_images ON share_link_images.image_id = images.id AND share_link_images.share_link_id = ?", s.ID).
+		Preload("Variants").Order("share_link_images.position").Find(&images).Error
+	return images, err
+}
+
+// HasImage 图片是否在分享链接中
+func (s *ShareLink) HasImage(imageID uint) bool {
+	var count int64
+	DB.Model(&ShareLinkImage{}).Where("share_link_id = ? AND image_id = ?", s.ID, imageID).Count(&count)
+	return count > 0
+}
+
+// RecordView 记录一次访问
+func (s *ShareLink) RecordView() error {
+	now := time.Now()
+	s.ViewCount++
+	s.LastViewedAt = &now
+	return DB.Model(&ShareLink{ID: s.ID}).UpdateColumns(map[string]interface{}{
+		"view_count":     gorm.Expr("view_count + ?", 1),
+		"last_viewed_at": now,
+	}).Error
+}
+
+// setShareLinkImages 替换分享链接的图片列表，重复的 ID 只保留第一次出现的位置
+func setShareLinkImages(tx *gorm.DB, link *ShareLink, imageIDs []uint) error {
+	ordered := make([]uint, 0, len(imageIDs))
+	seen := make(map[uint]bool, len(imageIDs))
+	for _, id := range imageIDs {
+		if !seen[id] {
+			seen[id] = true
+			ordered = append(ordered, id)
+		}
+	}
+
+	var owned int64
+	if err := tx.Model(&Image{}).Where("id IN ? AND user_id = ?", ordered, link.UserID).Count(&owned).Error; err != nil {
+		return err
+	}
+	if owned != int64(len(ordered)) {
+		return ErrShareImagesNotOwned
+	}
+
+	if err := tx.Where("share_link_id = ?", link.ID).Delete(&ShareLinkImage{}).Error; err != nil {
+		return err
+	}
+	if len(ordered) == 0 {
+		link.ImageCount = 0
+		return nil
+	}
+	rows := make([]ShareLinkImage, len(ordered))
+	for i, id := range ordered {
+		rows[i] = ShareLinkImage{ShareLinkID: link.ID, ImageID: id, Position: i + 1}
+	}
+	if err := tx.Create(&rows).Error; err != nil {
+		return err
+	}
+	link.ImageCount = int64(len(rows))
+	return nil
+}
+
+// removeImageFromShareLinks 图片删除时将其移出所有分享链接
+func removeImageFromShareLinks(tx *gorm.DB, imageID uint) error {
+	return tx.Where("image_id = ?", imageID).Delete(&ShareLinkImage{}).Error
+}
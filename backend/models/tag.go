@@ -0,0 +1,222 @@
+package models
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// 标签限制
+const (
+	MaxTagLength    = 50 // 单个标签的最大字符数
+	MaxTagsPerImage = 20 // 每张图片最多的标签数
+)
+
+var (
+	ErrTagTooLong  = fmt.Errorf("标签不能超过 %d 个字符", MaxTagLength)
+	ErrTooManyTags = fmt.Errorf("每张图片最多 %d 个标签", MaxTagsPerImage)
+)
+
+// Tag 标签，所有用户共用同一个标签名，名称统一为小写
+type Tag struct {
+	ID        uint `gorm:"primarykey"`
+	CreatedAt time.Time
+	Name      string `gorm:"size:50;uniqueIndex;not null"`
+}
+
+// ImageTag 图片与标签的关联
+type ImageTag struct {
+	ImageID uint `gorm:"primarykey;autoIncrement:false"`
+	TagID   uint `gorm:"primarykey;autoIncrement:false;index"`
+}
+
+// TagUsage 用户使用某个标签的图片数量
+type TagUsage struct {
+	Name  string `json:"name"`
+	Count int64  `json:"count"`
+}
+
+// MarshalJSON 标签在接口中直接以名称表示
+func (t Tag) MarshalJSON() ([]byte, error) {
+	return json.Marshal(t.Name)
+}
+
+// SplitTags 拆分逗号分隔的标签字符串，同时支持中文逗号
+func SplitTags(s string) []string {
+	return strings.FieldsFunc(s, func(r rune) bool {
+		return r == ',' || r == '，'
+	})
+}
+
+// NormalizeTags 去除空白、转为小写并去重，保持原有顺序
+func NormalizeTags(names []string) ([]string, error) {
+	result := make([]string, 0, len(names))
+	seen := make(map[string]bool, len(names))
+	for _, name := range names {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" || seen[name] {
+			continue
+		}
+		if utf8.RuneCountInString(name) > MaxTagLength {
+			return nil, ErrTagTooLong
+		}
+		seen[name] = true
+		result = append(result, name)
+	}
+	if len(result) > MaxTagsPerImage {
+		return nil, ErrTooManyTags
+	}
+	return result, nil
+}
+
+// UpdateWithTags 在同一事务中保存图片信息、替换标签并同步全文索引，
+// 任何一步失败都不会留下部分更新。names 需先经过 NormalizeTags 处理
+func (i *Image) UpdateWithTags(names []string) error {
+	return DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Omit("Tags").Save(i).Error; err != nil {
+			return err
+		}
+		if err := setImageTags(tx, i.ID, names); err != nil {
+			return err
+		}
+		if err := tx.Model(i).Association("Tags").Find(&i.Tags); err != nil {
+			return err
+		}
+		return indexImage(tx, i)
+	})
+}
+
+// ImageIDsWithTags 带有指定标签的图片ID子查询，matchAll 为 true 时要求包含全部标签，否则包含任意一个即可
+func ImageIDsWithTags(names []string, matchAll bool) *gorm.DB {
+	query := DB.Table("image_tags").
+		Joins("JOIN tags ON tags.id = image_tags.tag_id").
+		Where("tags.name IN ?", names).
+		Select("image_tags.image_id")
+	if matchAll {
+		query = query.Group("image_tags.image_id").Having("COUNT(*) = ?", len(names))
+	}
+	return query
+}
+
+// GetUserTags 分页获取用户使用过的标签及各自的图片数量，常用的在前
+func GetUserTags(userID uint, page, pageSize int) ([]TagUsage, int64, error) {
+	usages := []TagUsage{}
+	var total int64
+
+	if err := userTagsQuery(userID).Distinct("tags.id").Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	offset := (page - 1) * pageSize
+	err := userTagsQuery(userID).Select("tags.name, COUNT(*) AS count").Group("tags.id").
+		Order("count DESC, tags.name").Offset(offset).Limit(pageSize).Scan(&usages).Error
+	return usages, total, err
+}
+
+// SuggestTags 按前缀匹配用户使用过的标签，用于输入时自动补全
+func SuggestTags(userID uint, prefix string, limit int) ([]TagUsage, error) {
+	usages := []TagUsage{}
+	prefix = strings.ToLower(strings.TrimSpace(prefix))
+	err := userTagsQuery(userID).Where("tags.name LIKE ? ESCAPE '\\'", escapeLike(prefix)+"%").
+		Select("tags.name, COUNT(*) AS count").Group("tags.id").
+		Order("count DESC, tags.name").Limit(limit).Scan(&usages).Error
+	return usages, err
+}
+
+// userTagsQuery 用户未删除的图片上的标签
+func userTagsQuery(userID uint) *gorm.DB {
+	return DB.Table("image_tags").
+		Joins("JOIN tags ON tags.id = image_tags.tag_id").
+		Joins("JOIN images ON images.id = image_tags.image_id AND images.deleted_at IS NULL").
+		Where("images.user_id = ?", userID)
+}
+
+// setImageTags 替换图片的标签，不存在的标签会被创建
+func setImageTags(tx *gorm.DB, imageID uint, names []string) error {
+	if err := tx.Where("image_id = ?", imageID).Delete(&ImageTag{}).Error; err != nil {
+		return err
+	}
+	if len(names) == 0 {
+		return nil
+	}
+
+	tags := make([]Tag, len(names))
+	for i, name := range names {
+		tags[i] = Tag{Name: name}
+	}
+	if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&tags).Error; err != nil {
+		return err
+	}
+
+	// 已存在的标签不会返回ID，统一重新查询
+	var ids []uint
+	if err := tx.Model(&Tag{}).Where("name IN ?", names).Pluck("id", &ids).Error; err != nil {
+		return err
+	}
+	rows := make([]ImageTag, len(ids))
+	for i, id := range ids {
+		rows[i] = ImageTag{ImageID: imageID, TagID: id}
+	}
+	return tx.Create(&rows).Error
+}
+
+// removeImageTags 图片删除时移除其标签关联
+func removeImageTags(tx *gorm.DB, imageID uint) error {
+	return tx.Where("image_id = ?", imageID).Delete(&ImageTag{}).Error
+}
+
+// escapeLike 转义 LIKE 中的通配符
+func escapeLike(s string) string {
+	return strings.NewReplacer("\\", "\\\\", "%", "\\%", "_", "\\_").Replace(s)
+}
+
+// migrateLegacyTags 将旧版图片表中逗号分隔的 tags 列迁移到标签表，完成后删除该列
+func migrateLegacyTags() error {
+	if !DB.Migrator().HasColumn("images", "tags") {
+		return nil
+	}
+
+	var rows []struct {
+		ID   uint
+		Tags string
+	}
+	if err := DB.Table("images").Select("id, tags").Where("deleted_at IS NULL AND tags IS NOT NULL AND tags != ''").Scan(&rows).Error; err != nil {
+		return err
+	}
+
+	return DB.Transaction(func(tx *gorm.DB) error {
+		for _, row := range rows {
+			if err := setImageTags(tx, row.ID, normalizeLegacyTags(row.Tags)); err != nil {
+				return err
+			}
+		}
+		// 直接删除列，Migrator().DropColumn 在 SQLite 上会重建表并丢失索引
+		return tx.Exec("ALTER TABLE images DROP COLUMN tags").Error
+	})
+}
+
+// normalizeLegacyTags 处理旧数据中的标签字符串，超出限制时截断过长的标签、只保留前面的标签，而不是报错
+func normalizeLegacyTags(s string) []string {
+	result := make([]string, 0, MaxTagsPerImage)
+	seen := make(map[string]bool)
+	for _, name := range SplitTags(s) {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if r := []rune(name); len(r) > MaxTagLength {
+			name = strings.TrimSpace(string(r[:MaxTagLength]))
+		}
+		if name == "" || seen[name] {
+			continue
+		}
+		seen[name] = true
+		result = append(result, name)
+		if len(result) == MaxTagsPerImage {
+			break
+		}
+	}
+	return result
+}
@@ -0,0 +1,57 @@
+package models
+
+import "time"
+
+// TusUpload 进行中的 tus 断点续传上传，数据暂存在本地文件中，完成后转为 Image
+type TusUpload struct {
+	ID        string    `gorm:"primarykey;size:36" json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+	UserID    uint      `gorm:"not null;index" json:"user_id"`
+	FileName  string    `json:"file_name"`              // Upload-Metadata 中的 filename
+	Length    int64     `gorm:"not null" json:"length"` // Upload-Length
+	Offset    int64     `gorm:"not null;default:0" json:"offset"`
+	ExpiresAt time.Time `gorm:"index" json:"expires_at"`
+}
+
+// CreateTusUpload 创建上传记录
+func CreateTusUpload(upload *TusUpload) error {
+	return DB.Create(upload).Error
+}
+
+// GetTusUpload 获取用户未过期的上传记录
+func GetTusUpload(id string, userID uint) (*TusUpload, error) {
+	var upload TusUpload
+	err := DB.Where("id = ? AND user_id = ? AND expires_at > ?", id, userID, time.Now()).First(&upload).Error
+	if err != nil {
+		return nil, err
+	}
+	return &upload, nil
+}
+
+// UpdateOffset 更新已接收的字节数并顺延过期时间
+func (u *TusUpload) UpdateOffset(offset int64, expiresAt time.Time) error {
+	u.Offset = offset
+	u.ExpiresAt = expiresAt
+	return DB.Model(u).Updates(map[string]interface{}{"offset": offset, "expires_at": expiresAt}).Error
+}
+
+// DeleteTusUpload 删除上传记录
+func DeleteTusUpload(id string) error {
+	return DB.Delete(&TusUpload{}, "id = ?", id).Error
+}
+
+// GetUserTusUploadsLength 获取用户未过期的上传声明的总大小，这些上传完成后会占用存储配额
+func GetUserTusUploadsLength(userID uint) (int64, error) {
+	var total int64
+	err := DB.Model(&TusUpload{}).Where("user_id = ? AND expires_at > ?", userID, time.Now()).
+		Select("COALESCE(SUM(length), 0)").Scan(&total).Error
+	return total, err
+}
+
+// GetExpiredTusUploads 获取已过期的上传记录
+func GetExpiredTusUploads() ([]TusUpload, error) {
+	var uploads []TusUpload
+	err := DB.Where("expires_at <= ?", time.Now()).Find(&uploads).Error
+	return uploads, err
+}
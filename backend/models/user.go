@@ -1,10 +1,8 @@
-
 package models
 
-
-
 import (
-	"errors"
+	"crypto/rand"
+	"encoding/hex"
 	"time"
 
 	"golang.org/x/crypto/bcrypt"
@@ -21,22 +19,46 @@ type User struct {
 	Password  string         `gorm:"not null" json:"-"`
 	Role      string         `gorm:"default:'user'" json:"role"` // admin, user
 	Avatar    string         `json:"avatar"`
-	Status    string         `gorm:"default:'active'" json:"status"` // active, disabled
+	Status    string         `gorm:"default:'active'" json:"status"` // active, disabled, pending
+
+	EmailVerifiedAt *time.Time `json:"email_verified_at,omitempty"` // 通过验证邮件或重置密码邮件证明邮箱归属的时间，更换邮箱后清空
 
 	// 用户设置
-	CustomDomain      string `json:"custom_domain"`                                              // 自定义域名
-	DefaultLinkFormat string `gorm:"default:'url'" json:"default_link_format"`                   // url, markdown, html, bbcode
-	EnableWatermark   bool   `gorm:"default:false" json:"enable_watermark"`                      // 是否启用水印
-	WatermarkText     string `json:"watermark_text"`                                             // 水印文字
-	WatermarkPosition string `gorm:"default:'bottom-right'" json:"watermark_position"`           // 水印位置
+	CustomDomain      string `json:"custom_domain"`                                    // 自定义域名
+	DefaultLinkFormat string `gorm:"default:'url'" json:"default_link_format"`         // url, markdown, html, bbcode
+	EnableWatermark   bool   `gorm:"default:false" json:"enable_watermark"`            // 是否启用水印
+	WatermarkText     string `json:"watermark_text"`                                   // 水印文字
+	WatermarkPosition string `gorm:"default:'bottom-right'" json:"watermark_position"` // 水印位置
+	WatermarkOpacity  int    `gorm:"default:60" json:"watermark_opacity"`              // 水印不透明度 (0-100)
+
+	WatermarkImage         string `json:"watermark_image"`                                        // 水印图片（PNG Logo）存储路径
+	WatermarkImagePosition string `gorm:"default:'bottom-right'" json:"watermark_image_position"` // 水印图片位置
+	WatermarkImageScale    int    `gorm:"default:20" json:"watermark_image_scale"`                // 水印图片宽度占图片宽度的百分比 (1-100)
+	WatermarkImageMargin   int    `gorm:"default:16" json:"watermark_image_margin"`               // 水印图片边距 (像素)
+	WatermarkImageOpacity  int    `gorm:"default:80" json:"watermark_image_opacity"`              // 水印图片不透明度 (0-100)
+
 	CompressImage     bool   `gorm:"default:false" json:"compress_image"`                        // 是否压缩图片
 	CompressQuality   int    `gorm:"default:80" json:"compress_quality"`                         // 压缩质量 (1-100)
 	MaxImageSize      int64  `gorm:"default:10485760" json:"max_image_size"`                     // 最大图片大小 (字节)
 	AllowedImageTypes string `gorm:"default:'jpg,jpeg,png,gif,webp'" json:"allowed_image_types"` // 允许的图片类型
 	EnableImageReview bool   `gorm:"default:false" json:"enable_image_review"`                   // 图片审核
 	StorageQuota      int64  `gorm:"default:1073741824" json:"storage_quota"`                    // 存储配额 (字节，默认1GB)
-	UsedStorage       int64  `gorm:"default:0" json:"used_storage"`                              // 已使用存储
-	StorageUsed       int64  `gorm:"-" json:"storage_used"`                                      // 展示用：已使用存储（非数据库字段）
+
+	// 管理员为用户设置的上传上限，用户个人设置不能超过
+	LimitMaxImageSize int64  `gorm:"default:0" json:"limit_max_image_size"` // 单文件大小上限 (字节，0 表示只受全局限制)
+	LimitImageTypes   string `json:"limit_image_types"`                     // 允许的图片类型，为空表示只受全局限制
+
+	// 外部身份（单点登录），本地账户为空
+	AuthProvider string `gorm:"index:idx_users_external" json:"auth_provider,omitempty"` // oidc, ldap
+	ExternalID   string `gorm:"index:idx_users_external" json:"-"`                       // 身份提供方中的用户标识（sub）
+
+	// 两步验证（TOTP）
+	TOTPSecret      string `json:"-"`                                 // Base32 密钥，开启前为待验证的密钥
+	TOTPEnabled     bool   `gorm:"default:false" json:"totp_enabled"` // 是否已开启两步验证
+	TOTPLastCounter int64  `gorm:"default:0" json:"-"`                // 最近一次使用的时间步，防止验证码重放
+
+	UsedStorage int64 `gorm:"default:0" json:"used_storage"` // 已使用存储
+	StorageUsed int64 `gorm:"-" json:"storage_used"`         // 展示用：已使用存储（非数据库字段）
 
 	Images []Image `gorm:"foreignKey:UserID" json:"images,omitempty"`
 }
@@ -56,13 +78,13 @@ func (u *User) CheckPassword(password string) error {
 	return bcrypt.CompareHashAndPassword([]byte(u.Password), []byte(password))
 }
 
-// CreateUser 创建用户
-func CreateUser(username, email, password string) (*User, error) {
+// CreateUser 创建用户，status 为 active 或 pending（等待验证邮箱）
+func CreateUser(username, email, password, status string) (*User, error) {
 	user := &User{
 		Username: username,
 		Email:    email,
 		Role:     "user",
-		Status:   "active",
+		Status:   status,
 	}
 
 	if err := user.HashPassword(password); err != nil {
@@ -76,6 +98,68 @@ func CreateUser(username, email, password string) (*User, error) {
 	return user, nil
 }
 
+// CreateInvitedUser 使用邀请码注册的用户，按邀请码预设角色和存储配额。
+// 创建和设置在同一事务中完成，失败时不会留下未应用邀请码设置的用户
+func CreateInvitedUser(username, email, password, status string, invite *InviteCode) (*User, error) {
+	user := &User{
+		Username: username,
+		Email:    email,
+		Role:     "user",
+		Status:   status,
+	}
+
+	if err := user.HashPassword(password); err != nil {
+		return nil, err
+	}
+
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(user).Error; err != nil {
+			return err
+		}
+
+		// 配额为 0 表示无限制，创建时 0 会被默认值替代，需要在创建后再更新
+		user.Role = invite.Role
+		if invite.StorageQuota != nil {
+			user.StorageQuota = *invite.StorageQuota
+		}
+		if user.IsAdmin() {
+			user.StorageQuota = 0 // 管理员无限制
+		}
+		return tx.Save(user).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return user, nil
+}
+
+// CreateExternalUser 创建由外部身份（单点登录）登录的用户，本地密码为随机值，无法用于登录
+func CreateExternalUser(provider, externalID, username, email, role string) (*User, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return nil, err
+	}
+
+	user := &User{
+		Username:     username,
+		Email:        email,
+		Role:         role,
+		Status:       "active",
+		AuthProvider: provider,
+		ExternalID:   externalID,
+	}
+	if err := user.HashPassword(hex.EncodeToString(buf)); err != nil {
+		return nil, err
+	}
+
+	if err := DB.Create(user).Error; err != nil {
+		return nil, err
+	}
+
+	return user, nil
+}
+
 // GetUserByUsername 根据用户名获取用户
 func GetUserByUsername(username string) (*User, error) {
 	var user User
@@ -94,6 +178,15 @@ func GetUserByEmail(email string) (*User, error) {
 	return &user, nil
 }
 
+// GetUserByExternalID 根据外部身份获取用户
+func GetUserByExternalID(provider, externalID string) (*User, error) {
+	var user User
+	if err := DB.Where("auth_provider = ? AND external_id = ?", provider, externalID).First(&user).Error; err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
 // GetUserByID 根据ID获取用户
 func GetUserByID(id uint) (*User, error) {
 	var user User
@@ -143,10 +236,10 @@ func CreateDefaultAdmin() {
 
 	if count == 0 {
 		admin := &User{
-			Username: "admin",
-			Email:    "admin@gotux.com",
-			Role:     "admin",
-			Status:   "active",
+			Username:     "admin",
+			Email:        "admin@gotux.com",
+			Role:         "admin",
+			Status:       "active",
 			StorageQuota: 0, // 管理员无限制
 		}
 
@@ -165,29 +258,106 @@ func (u *User) IsAdmin() bool {
 	return u.Role == "admin"
 }
 
+// UseTOTPCounter 记录已使用的验证码时间步，时间步不大于上次记录时返回 false（验证码被重放）
+func (u *User) UseTOTPCounter(counter int64) bool {
+	result := DB.Model(&User{}).Where("id = ? AND totp_last_counter < ?", u.ID, counter).
+		Update("totp_last_counter", counter)
+	if result.Error != nil || result.RowsAffected == 0 {
+		return false
+	}
+	u.TOTPLastCounter = counter
+	return true
+}
+
 // IsActive 检查用户是否激活
 func (u *User) IsActive() bool {
 	return u.Status == "active"
 }
 
-// ValidateUser 验证用户登录
-// FixAdminQuota 批量修正所有管理员配额为无限制（0）
-func FixAdminQuota() error {
-	return DB.Model(&User{}).Where("role = ?", "admin").Update("storage_quota", 0).Error
+// IsPending 检查用户是否在等待验证邮箱
+func (u *User) IsPending() bool {
+	return u.Status == "pending"
 }
-func ValidateUser(username, password string) (*User, error) {
-	user, err := GetUserByUsername(username)
-	if err != nil {
-	return nil, errors.New("用户名或密码错误")
+
+// ResetPassword 设置新密码，仅当密码仍为 oldHash 时才更新，保证重置链接只能使用一次。
+// 能收到重置邮件也证明了邮箱归属，等待验证的用户同时被激活
+func (u *User) ResetPassword(oldHash, password string) (bool, error) {
+	updated := *u
+	if err := updated.HashPassword(password); err != nil {
+		return false, err
+	}
+	status := u.Status
+	if u.IsPending() {
+		status = "active"
+	}
+	now := time.Now()
+
+	result := DB.Model(&User{}).Where("id = ? AND password = ?", u.ID, oldHash).
+		Updates(map[string]interface{}{"password": updated.Password, "status": status, "email_verified_at": now})
+	if result.Error != nil || result.RowsAffected == 0 {
+		return false, result.Error
+	}
+	u.Password, u.Status, u.EmailVerifiedAt = updated.Password, status, &now
+	return true, nil
 }
 
-	if !user.IsActive() {
-		return nil, errors.New("账户已被禁用")
+// VerifyEmail 邮箱验证通过：等待验证的用户同时激活，已激活但更换过邮箱的用户只记录验证时间。
+// 只对邮箱尚未验证的用户生效，因此验证链接只能使用一次
+func (u *User) VerifyEmail() (bool, error) {
+	status := u.Status
+	if u.IsPending() {
+		status = "active"
 	}
+	now := time.Now()
+	result := DB.Model(&User{}).Where("id = ? AND status = ? AND email_verified_at IS NULL", u.ID, u.Status).
+		Updates(map[string]interface{}{"status": status, "email_verified_at": now})
+	if result.Error != nil || result.RowsAffected == 0 {
+		return false, result.Error
+	}
+	u.Status, u.EmailVerifiedAt = status, &now
+	return true, nil
+}
 
-	if err := user.CheckPassword(password); err != nil {
-		return nil, errors.New("用户名或密码错误")
+// IsExternal 是否由外部身份（LDAP、OIDC）管理，这类账户没有可用的本地密码
+func (u *User) IsExternal() bool {
+	return u.AuthProvider != ""
+}
+
+// IsEmailVerified 邮箱是否已在本地验证过
+func (u *User) IsEmailVerified() bool {
+	return u.EmailVerifiedAt != nil
+}
+
+// LinkExternal 将本地账户关联到外部身份。之后只能通过身份提供方登录：本地密码换成随机值，
+// 已有的会话和 API Token 全部作废，避免关联前持有该账户的人继续访问
+func (u *User) LinkExternal(provider, externalID string) error {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return err
 	}
+	if err := u.HashPassword(hex.EncodeToString(buf)); err != nil {
+		return err
+	}
+	u.AuthProvider = provider
+	u.ExternalID = externalID
+
+	return DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&User{}).Where("id = ?", u.ID).Updates(map[string]interface{}{
+			"password":      u.Password,
+			"auth_provider": provider,
+			"external_id":   externalID,
+		}).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&Session{}).Where("user_id = ? AND revoked_at IS NULL", u.ID).
+			Update("revoked_at", time.Now()).Error; err != nil {
+			return err
+		}
+		return tx.Where("user_id = ?", u.ID).Delete(&APIToken{}).Error
+	})
+}
 
-	return user, nil
+// FixAdminQuota 批量修正所有管理员配额为无限制（0）
+func FixAdminQuota() error {
+	return DB.Model(&User{}).Where("role = ?", "admin").Update("storage_quota", 0).Error
 }
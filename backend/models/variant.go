@@ -0,0 +1,42 @@
+package models
+
+import "time"
+
+// ImageVariant 图片的衍生尺寸（缩略图等）
+type ImageVariant struct {
+	ID        uint      `gorm:"primarykey" json:"-"`
+	CreatedAt time.Time `json:"-"`
+	ImageID   uint      `gorm:"not null;uniqueIndex:idx_image_variants_image_name" json:"-"`
+	Name      string    `gorm:"not null;uniqueIndex:idx_image_variants_image_name" json:"name"`
+	FilePath  string    `gorm:"not null" json:"-"`
+	FileSize  int64     `json:"file_size"`
+	MimeType  string    `json:"mime_type"`
+	Width     int       `json:"width"`
+	Height    int       `json:"height"`
+}
+
+// CreateImageVariant 创建衍生图记录
+func CreateImageVariant(variant *ImageVariant) error {
+	return DB.Create(variant).Error
+}
+
+// GetImageVariant 获取图片指定名称的衍生图
+func GetImageVariant(imageID uint, name string) (*ImageVariant, error) {
+	var variant ImageVariant
+	if err := DB.Where("image_id = ? AND name = ?", imageID, name).First(&variant).Error; err != nil {
+		return nil, err
+	}
+	return &variant, nil
+}
+
+// GetImageVariants 获取图片的所有衍生图
+func GetImageVariants(imageID uint) ([]ImageVariant, error) {
+	var variants []ImageVariant
+	err := DB.Where("image_id = ?", imageID).Find(&variants).Error
+	return variants, err
+}
+
+// DeleteImageVariants 删除图片的所有衍生图记录
+func DeleteImageVariants(imageID uint) error {
+	return DB.Where("image_id = ?", imageID).Delete(&ImageVariant{}).Error
+}
@@ -0,0 +1,332 @@
+// Package oidc 实现 OpenID Connect 授权码 + PKCE 登录所需的客户端功能：
+// 服务发现、授权地址、令牌交换和基于 JWKS 的 ID Token 校验
+package oidc
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	discoveryTTL      = time.Hour
+	jwksRefreshPeriod = time.Minute // 遇到未知 kid 时重新获取 JWKS 的最短间隔
+	maxResponseSize   = 1 << 20
+)
+
+var (
+	ErrInvalidIDToken = errors.New("无效的 ID Token")
+	ErrNonceMismatch  = errors.New("ID Token 的 nonce 不匹配")
+)
+
+// Discovery /.well-known/openid-configuration 中用到的字段
+type Discovery struct {
+	Issuer                string   `json:"issuer"`
+	AuthorizationEndpoint string   `json:"authorization_endpoint"`
+	TokenEndpoint         string   `json:"token_endpoint"`
+	JWKSURI               string   `json:"jwks_uri"`
+	TokenAuthMethods      []string `json:"token_endpoint_auth_methods_supported"`
+}
+
+// Provider 一个 OIDC 身份提供方，发现文档和签名公钥会被缓存
+type Provider struct {
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	Scopes       []string
+
+	client *http.Client
+
+	mu          sync.Mutex
+	discovery   *Discovery
+	discoveryAt time.Time
+	keys        map[string]interface{}
+	keysAt      time.Time
+}
+
+// NewProvider 创建身份提供方
+func NewProvider(issuer, clientID, clientSecret string, scopes []string) *Provider {
+	return &Provider{
+		Issuer:       strings.TrimSuffix(issuer, "/"),
+		ClientID:     clientID,
+		ClientSecret: clientSecret,
+		Scopes:       scopes,
+		client:       &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// AuthRequest 一次登录请求的随机参数，需要保存到回调时使用
+type AuthRequest struct {
+	State        string
+	Nonce        string
+	CodeVerifier string
+	RedirectURL  string // 回调地址，授权和换取令牌时必须一致
+}
+
+// NewAuthRequest 生成 state、nonce 和 PKCE code_verifier
+func NewAuthRequest(redirectURL string) (*AuthRequest, error) {
+	var values [3]string
+	for i := range values {
+		buf := make([]byte, 32)
+		if _, err := rand.Read(buf); err != nil {
+			return nil, err
+		}
+		values[i] = base64.RawURLEncoding.EncodeToString(buf)
+	}
+	return &AuthRequest{State: values[0], Nonce: values[1], CodeVerifier: values[2], RedirectURL: redirectURL}, nil
+}
+
+// AuthCodeURL 返回跳转到身份提供方的授权地址（S256 PKCE）
+func (p *Provider) AuthCodeURL(ctx context.Context, req *AuthRequest) (string, error) {
+	discovery, err := p.Discover(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	challenge := sha256.Sum256([]byte(req.CodeVerifier))
+	params := url.Values{}
+	params.Set("response_type", "code")
+	params.Set("client_id", p.ClientID)
+	params.Set("redirect_uri", req.RedirectURL)
+	params.Set("scope", strings.Join(p.Scopes, " "))
+	params.Set("state", req.State)
+	params.Set("nonce", req.Nonce)
+	params.Set("code_challenge", base64.RawURLEncoding.EncodeToString(challenge[:]))
+	params.Set("code_challenge_method", "S256")
+
+	sep := "?"
+	if strings.Contains(discovery.AuthorizationEndpoint, "?") {
+		sep = "&"
+	}
+	return discovery.AuthorizationEndpoint + sep + params.Encode(), nil
+}
+
+// Exchange 用授权码换取令牌并校验 ID Token，返回 ID Token 中的声明
+func (p *Provider) Exchange(ctx context.Context, code string, req *AuthRequest) (jwt.MapClaims, error) {
+	discovery, err := p.Discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	form := url.Values{}
+	form.Set("grant_type", "authorization_code")
+	form.Set("code", code)
+	form.Set("redirect_uri", req.RedirectURL)
+	form.Set("code_verifier", req.CodeVerifier)
+
+	// 默认使用 client_secret_basic，提供方只声明支持 client_secret_post 时改用表单
+	useBasic := p.ClientSecret != "" && !(len(discovery.TokenAuthMethods) > 0 &&
+		!contains(discovery.TokenAuthMethods, "client_secret_basic") &&
+		contains(discovery.TokenAuthMethods, "client_secret_post"))
+	if !useBasic {
+		form.Set("client_id", p.ClientID)
+		if p.ClientSecret != "" {
+			form.Set("client_secret", p.ClientSecret)
+		}
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, discovery.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	httpReq.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	httpReq.Header.Set("Accept", "application/json")
+	if useBasic {
+		httpReq.SetBasicAuth(url.QueryEscape(p.ClientID), url.QueryEscape(p.ClientSecret))
+	}
+
+	var token struct {
+		IDToken          string `json:"id_token"`
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+	status, err := p.doJSON(httpReq, &token)
+	if err != nil {
+		return nil, fmt.Errorf("令牌交换失败: %w", err)
+	}
+	if status != http.StatusOK || token.IDToken == "" {
+		if token.Error != "" {
+			return nil, fmt.Errorf("令牌交换失败: %s %s", token.Error, token.ErrorDescription)
+		}
+		return nil, fmt.Errorf("令牌交换失败: HTTP %d", status)
+	}
+
+	return p.VerifyIDToken(ctx, token.IDToken, req.Nonce)
+}
+
+// VerifyIDToken 校验 ID Token 的签名、签发者、受众、有效期和 nonce
+func (p *Provider) VerifyIDToken(ctx context.Context, rawToken, nonce string) (jwt.MapClaims, error) {
+	discovery, err := p.Discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	claims := jwt.MapClaims{}
+	token, err := jwt.ParseWithClaims(rawToken, claims, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		return p.publicKey(ctx, discovery.JWKSURI, kid)
+	},
+		jwt.WithValidMethods([]string{"RS256", "RS384", "RS512", "PS256", "PS384", "PS512", "ES256", "ES384", "ES512"}),
+		jwt.WithIssuer(discovery.Issuer),
+		jwt.WithAudience(p.ClientID),
+		jwt.WithExpirationRequired(),
+		jwt.WithIssuedAt(),
+		jwt.WithLeeway(time.Minute),
+	)
+	if err != nil || !token.Valid {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidIDToken, err)
+	}
+
+	// 有多个受众时 azp 必须是本客户端
+	if aud, _ := claims.GetAudience(); len(aud) > 1 {
+		if azp, _ := claims["azp"].(string); azp != p.ClientID {
+			return nil, ErrInvalidIDToken
+		}
+	}
+	if got, _ := claims["nonce"].(string); got != nonce {
+		return nil, ErrNonceMismatch
+	}
+	if sub, _ := claims["sub"].(string); sub == "" {
+		return nil, ErrInvalidIDToken
+	}
+	return claims, nil
+}
+
+// Discover 获取并缓存发现文档，签发者必须与配置一致
+func (p *Provider) Discover(ctx context.Context) (*Discovery, error) {
+	p.mu.Lock()
+	if p.discovery != nil && time.Since(p.discoveryAt) < discoveryTTL {
+		discovery := p.discovery
+		p.mu.Unlock()
+		return discovery, nil
+	}
+	p.mu.Unlock()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, p.Issuer+"/.well-known/openid-configuration", nil)
+	if err != nil {
+		return nil, err
+	}
+	var discovery Discovery
+	status, err := p.doJSON(req, &discovery)
+	if err != nil || status != http.StatusOK {
+		return nil, fmt.Errorf("获取 OIDC 发现文档失败: HTTP %d %v", status, err)
+	}
+	if strings.TrimSuffix(discovery.Issuer, "/") != p.Issuer {
+		return nil, fmt.Errorf("OIDC 发现文档的 issuer 不匹配: %s", discovery.Issuer)
+	}
+	if discovery.AuthorizationEndpoint == "" || discovery.TokenEndpoint == "" || discovery.JWKSURI == "" {
+		return nil, errors.New("OIDC 发现文档缺少必要的端点")
+	}
+
+	p.mu.Lock()
+	p.discovery = &discovery
+	p.discoveryAt = time.Now()
+	p.mu.Unlock()
+	return &discovery, nil
+}
+
+// publicKey 按 kid 查找签名公钥，找不到时重新获取 JWKS（支持提供方轮换密钥）
+func (p *Provider) publicKey(ctx context.Context, jwksURI, kid string) (interface{}, error) {
+	p.mu.Lock()
+	keys, fetchedAt := p.keys, p.keysAt
+	p.mu.Unlock()
+
+	if key := findKey(keys, kid); key != nil {
+		return key, nil
+	}
+	if keys != nil && time.Since(fetchedAt) < jwksRefreshPeriod {
+		return nil, fmt.Errorf("未知的签名密钥 %q", kid)
+	}
+
+	keys, err := p.fetchJWKS(ctx, jwksURI)
+	if err != nil {
+		return nil, err
+	}
+	p.mu.Lock()
+	p.keys = keys
+	p.keysAt = time.Now()
+	p.mu.Unlock()
+
+	if key := findKey(keys, kid); key != nil {
+		return key, nil
+	}
+	return nil, fmt.Errorf("未知的签名密钥 %q", kid)
+}
+
+func (p *Provider) fetchJWKS(ctx context.Context, jwksURI string) (map[string]interface{}, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, jwksURI, nil)
+	if err != nil {
+		return nil, err
+	}
+	var set struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+	status, err := p.doJSON(req, &set)
+	if err != nil || status != http.StatusOK {
+		return nil, fmt.Errorf("获取 JWKS 失败: HTTP %d %v", status, err)
+	}
+
+	keys := make(map[string]interface{})
+	for _, jwk := range set.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+		key, err := jwk.publicKey()
+		if err != nil {
+			continue // 跳过不支持的密钥类型
+		}
+		keys[jwk.Kid] = key
+	}
+	return keys, nil
+}
+
+// findKey kid 为空且只有一个密钥时直接使用该密钥
+func findKey(keys map[string]interface{}, kid string) interface{} {
+	if key, ok := keys[kid]; ok {
+		return key
+	}
+	if kid == "" && len(keys) == 1 {
+		for _, key := range keys {
+			return key
+		}
+	}
+	return nil
+}
+
+func (p *Provider) doJSON(req *http.Request, v interface{}) (int, error) {
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxResponseSize))
+	if err != nil {
+		return resp.StatusCode, err
+	}
+	if err := json.Unmarshal(body, v); err != nil && resp.StatusCode == http.StatusOK {
+		return resp.StatusCode, err
+	}
+	return resp.StatusCode, nil
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -3,6 +3,7 @@ package routes
 import (
 	"gotux/controllers"
 	"gotux/middleware"
+	"gotux/models"
 
 	"github.com/gin-gonic/gin"
 )
@@ -15,59 +16,176 @@ func SetupRoutes(r *gin.Engine) {
 		auth := api.Group("/auth")
 		{
 			auth.POST("/register", controllers.Register)
+			auth.GET("/register/config", controllers.GetRegistrationConfig)
 			auth.POST("/login", controllers.Login)
+			auth.POST("/refresh", controllers.RefreshToken)
+			auth.POST("/logout", controllers.Logout)
+
+			// 找回密码与邮箱验证
+			auth.POST("/forgot-password", controllers.ForgotPassword)
+			auth.POST("/reset-password", controllers.ResetPassword)
+			auth.POST("/verify-email", controllers.VerifyEmail)
+			auth.POST("/resend-verification", controllers.ResendVerification)
+
+			// 两步验证登录，使用 Login 返回的挑战令牌
+			auth.POST("/2fa/verify", controllers.VerifyTwoFactorLogin)
+			auth.POST("/2fa/setup", controllers.BeginTwoFactorSetup)
+			auth.POST("/2fa/setup/verify", controllers.CompleteTwoFactorSetup)
+
+			// OpenID Connect 单点登录
+			auth.GET("/oidc/config", controllers.GetOIDCConfig)
+			auth.GET("/oidc/login", controllers.OIDCLogin)
+			auth.GET("/oidc/callback", controllers.OIDCCallback)
 		}
 
-		// 公开访问图片信息(通过UUID)
-		api.GET("/i/:uuid", controllers.GetImageByUUID)
+		// 公开访问图片信息(通过UUID)，登录后所有者和管理员可以访问待审核的图片
+		api.GET("/i/:uuid", middleware.OptionalAuthMiddleware(), controllers.GetImageByUUID)
+
+		// 公开浏览相册
+		api.GET("/albums/:id/public", controllers.GetPublicAlbum)
+
+		// 分享链接，设置了密码时通过 X-Share-Password 请求头提供
+		api.GET("/s/:token", controllers.GetSharedImages)
+		api.GET("/s/:token/download", controllers.DownloadSharedImages)
 
 		// 随机图片 API
 		api.GET("/random", controllers.GetRandomImage)           // 返回JSON
 		api.GET("/random/image", controllers.ServeRandomImage)   // 直接返回图片
 		api.GET("/random/redirect", controllers.RedirectRandomImage) // 重定向到图片
 
-		// 需要认证的路由
+		// tus 断点续传的能力查询，不需要认证
+		api.OPTIONS("/images/tus", controllers.TusOptions)
+
+		// PicGo、Typora、ShareX 等上传工具的兼容接口，可通过 X-API-Key 或 ?key= 认证
+		compat := api.Group("/compat")
+		compat.Use(middleware.APIKeyMiddleware())
+		{
+			compat.POST("/upload", middleware.RequireScope(models.ScopeUpload), controllers.CompatUpload)
+		}
+
+		// 需要认证的路由，同时接受 JWT 和个人 API Token；
+		// 新增接口时需声明 RequireScope（API Token 需要的权限）或 SessionOnly（只允许登录会话）
 		authorized := api.Group("")
 		authorized.Use(middleware.AuthMiddleware())
 		{
+			read := middleware.RequireScope(models.ScopeRead)
+			upload := middleware.RequireScope(models.ScopeUpload)
+			remove := middleware.RequireScope(models.ScopeDelete)
+			sessionOnly := middleware.SessionOnly()
+
 			// 用户相关
 			user := authorized.Group("/user")
 			{
-				user.GET("/profile", controllers.GetProfile)
-				user.PUT("/profile", controllers.UpdateProfile)
-				user.POST("/change-password", controllers.ChangePassword)
-				user.GET("/stats", controllers.GetStats)
-				user.GET("/settings", controllers.GetSettings)
-				user.PUT("/settings", controllers.UpdateSettings)
+				user.GET("/profile", read, controllers.GetProfile)
+				user.PUT("/profile", sessionOnly, controllers.UpdateProfile)
+				user.POST("/change-password", sessionOnly, controllers.ChangePassword)
+				user.GET("/stats", read, controllers.GetStats)
+				user.GET("/settings", read, controllers.GetSettings)
+				user.PUT("/settings", sessionOnly, controllers.UpdateSettings)
+				user.GET("/watermark-image", read, controllers.GetWatermarkImage)
+				user.POST("/watermark-image", sessionOnly, controllers.UploadWatermarkImage)
+				user.DELETE("/watermark-image", sessionOnly, controllers.DeleteWatermarkImage)
+
+				// 个人 API Token
+				user.GET("/tokens", sessionOnly, controllers.GetAPITokens)
+				user.POST("/tokens", sessionOnly, controllers.CreateAPIToken)
+				user.PUT("/tokens/:id", sessionOnly, controllers.UpdateAPIToken)
+				user.DELETE("/tokens/:id", sessionOnly, controllers.DeleteAPIToken)
+				user.GET("/sharex-config", sessionOnly, controllers.GetShareXConfig)
+
+				// 登录会话
+				user.GET("/sessions", sessionOnly, controllers.GetSessions)
+				user.DELETE("/sessions", sessionOnly, controllers.RevokeOtherSessions)
+				user.DELETE("/sessions/:id", sessionOnly, controllers.RevokeSession)
+
+				// 两步验证
+				user.GET("/2fa", sessionOnly, controllers.GetTwoFactorStatus)
+				user.POST("/2fa/enroll", sessionOnly, controllers.EnrollTwoFactor)
+				user.POST("/2fa/enable", sessionOnly, controllers.EnableTwoFactor)
+				user.POST("/2fa/disable", sessionOnly, controllers.DisableTwoFactor)
+				user.POST("/2fa/recovery-codes", sessionOnly, controllers.RegenerateRecoveryCodes)
 			}
 
 			// 图片相关
 			image := authorized.Group("/images")
 			{
-				image.POST("/upload", controllers.UploadImage)
-				image.GET("", controllers.GetImages)
-				image.GET("/:id", controllers.GetImageDetail)
-				image.PUT("/:id", controllers.UpdateImage)
-				image.DELETE("/:id", controllers.DeleteImage)
-				image.POST("/batch-delete", controllers.BatchDeleteImages)
-				image.GET("/:id/links", controllers.GetImageLinks)
+				image.POST("/upload", upload, controllers.UploadImage)
+				image.POST("/upload-url", upload, controllers.UploadImageFromURL)
+				image.GET("", read, controllers.GetImages)
+				image.GET("/search", read, controllers.SearchImages)
+				image.GET("/:id", read, controllers.GetImageDetail)
+				image.PUT("/:id", upload, controllers.UpdateImage)
+				image.DELETE("/:id", remove, controllers.DeleteImage)
+				image.POST("/batch-delete", remove, controllers.BatchDeleteImages)
+				image.GET("/:id/links", read, controllers.GetImageLinks)
+				image.GET("/:id/original", read, controllers.DownloadOriginalImage)
+
+				// tus 断点续传
+				image.POST("/tus", upload, controllers.CreateTusUpload)
+				image.HEAD("/tus/:id", upload, controllers.GetTusUploadOffset)
+				image.PATCH("/tus/:id", upload, controllers.PatchTusUpload)
+				image.DELETE("/tus/:id", upload, controllers.DeleteTusUpload)
+			}
+
+			// 相册
+			album := authorized.Group("/albums")
+			{
+				album.GET("", read, controllers.GetAlbums)
+				album.POST("", upload, controllers.CreateAlbum)
+				album.GET("/:id", read, controllers.GetAlbum)
+				album.PUT("/:id", upload, controllers.UpdateAlbum)
+				album.DELETE("/:id", remove, controllers.DeleteAlbum)
+				album.POST("/:id/images", upload, controllers.AddAlbumImages)
+				album.POST("/:id/images/remove", upload, controllers.RemoveAlbumImages)
+				album.PUT("/:id/images/order", upload, controllers.ReorderAlbumImages)
+			}
+
+			// 标签
+			tag := authorized.Group("/tags")
+			{
+				tag.GET("", read, controllers.GetTags)
+				tag.GET("/suggest", read, controllers.SuggestTags)
+			}
+
+			// 分享链接
+			share := authorized.Group("/shares")
+			{
+				share.GET("", read, controllers.GetShareLinks)
+				share.POST("", upload, controllers.CreateShareLink)
+				share.GET("/:id", read, controllers.GetShareLink)
+				share.PUT("/:id", upload, controllers.UpdateShareLink)
+				share.DELETE("/:id", remove, controllers.DeleteShareLink)
 			}
 
 			// 管理员路由
 			admin := authorized.Group("/admin")
-			admin.Use(middleware.AdminMiddleware())
+			admin.Use(middleware.AdminMiddleware(), middleware.RequireScope(models.ScopeAdmin))
 			{
 				admin.GET("/users", controllers.GetAllUsers)
 				admin.PUT("/users/:id/status", controllers.UpdateUserStatus)
 				admin.PUT("/users/:id/quota", controllers.UpdateUserQuota)
+				admin.PUT("/users/:id/upload-limits", controllers.UpdateUserUploadLimits)
+				admin.PUT("/users/:id/review", controllers.UpdateUserReview)
+				admin.DELETE("/users/:id/2fa", controllers.ResetUserTwoFactor)
+				admin.GET("/settings", controllers.GetSystemSettings)
+				admin.PUT("/settings", controllers.UpdateSystemSettings)
+				admin.GET("/invites", controllers.GetInviteCodes)
+				admin.POST("/invites", controllers.CreateInviteCode)
+				admin.DELETE("/invites/:id", controllers.DeleteInviteCode)
+				admin.GET("/lockouts", controllers.GetLoginLockouts)
+				admin.DELETE("/lockouts", controllers.UnlockLogin)
+				admin.GET("/audit-logs", controllers.GetAuditLogs)
 				admin.GET("/images", controllers.GetAllImagesAdmin)
+				admin.GET("/reviews", controllers.GetReviewQueue)
+				admin.POST("/reviews/approve", controllers.ApproveImages)
+				admin.POST("/reviews/reject", controllers.RejectImages)
 				admin.GET("/stats", controllers.GetSystemStats)
 			}
 		}
 	}
 
-	// 直接提供图片文件(通过UUID)
-	r.GET("/i/:uuid", controllers.ServeImageByUUID)
+	// 直接提供图片文件(通过UUID)，登录后可以访问自己的私有图片和待审核的图片
+	r.GET("/i/:uuid", middleware.OptionalAuthMiddleware(), controllers.ServeImageByUUID)
 
 	// 健康检查
 	r.GET("/health", func(c *gin.Context) {
@@ -0,0 +1,544 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"gotux/config"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeS3 基于 httptest 的最小 S3 服务，只支持路径风格的请求和本文件测试用到的接口
+type fakeS3 struct {
+	bucket string
+
+	mu       sync.Mutex
+	objects  map[string]fakeObject
+	uploads  map[string]*fakeUpload
+	nextID   int
+	requests map[string]int // 按操作统计请求次数
+	pageSize int            // ListObjectsV2 每页返回的数量
+}
+
+type fakeObject struct {
+	data        []byte
+	contentType string
+	modTime     time.Time
+}
+
+// fakeUpload 进行中的分片上传，Content-Type 在创建时指定
+type fakeUpload struct {
+	contentType string
+	parts       map[int][]byte
+}
+
+func newFakeS3(t *testing.T) (*fakeS3, *httptest.Server) {
+	f := &fakeS3{
+		bucket:   "gotux",
+		objects:  make(map[string]fakeObject),
+		uploads:  make(map[string]*fakeUpload),
+		requests: make(map[string]int),
+		pageSize: 2,
+	}
+	srv := httptest.NewServer(f)
+	t.Cleanup(srv.Close)
+	return f, srv
+}
+
+func (f *fakeS3) count(op string) int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.requests[op]
+}
+
+func (f *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// 请求必须经过签名，且声明的负载哈希与实际内容一致
+	if !strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=") {
+		f.fail(w, http.StatusForbidden, "AccessDenied", "missing signature")
+		return
+	}
+	sum := sha256.Sum256(body)
+	if got := r.Header.Get("X-Amz-Content-Sha256"); got != hex.EncodeToString(sum[:]) {
+		f.fail(w, http.StatusBadRequest, "XAmzContentSHA256Mismatch", "payload hash mismatch")
+		return
+	}
+
+	path := strings.TrimPrefix(r.URL.Path, "/")
+	bucket, key, _ := strings.Cut(path, "/")
+	if bucket != f.bucket {
+		f.fail(w, http.StatusNotFound, "NoSuchBucket", "no such bucket")
+		return
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	query := r.URL.Query()
+	switch {
+	case key == "" && r.Method == http.MethodGet:
+		f.requests["list"]++
+		f.list(w, query)
+	case r.Method == http.MethodPost && query.Has("uploads"):
+		f.requests["create"]++
+		f.nextID++
+		id := strconv.Itoa(f.nextID)
+		f.uploads[id] = &fakeUpload{contentType: r.Header.Get("Content-Type"), parts: make(map[int][]byte)}
+		writeXML(w, struct {
+			XMLName  xml.Name `xml:"InitiateMultipartUploadResult"`
+			UploadID string   `xml:"UploadId"`
+		}{UploadID: id})
+	case r.Method == http.MethodPut && query.Has("partNumber"):
+		f.requests["part"]++
+		upload, ok := f.uploads[query.Get("uploadId")]
+		if !ok {
+			f.fail(w, http.StatusNotFound, "NoSuchUpload", "no such upload")
+			return
+		}
+		n, _ := strconv.Atoi(query.Get("partNumber"))
+		upload.parts[n] = body
+		w.Header().Set("ETag", fmt.Sprintf(`"etag-%d"`, n))
+	case r.Method == http.MethodPost && query.Has("uploadId"):
+		f.requests["complete"]++
+		f.complete(w, key, query.Get("uploadId"), body)
+	case r.Method == http.MethodDelete && query.Has("uploadId"):
+		f.requests["abort"]++
+		delete(f.uploads, query.Get("uploadId"))
+		w.WriteHeader(http.StatusNoContent)
+	case r.Method == http.MethodPut:
+		f.requests["put"]++
+		f.objects[key] = fakeObject{data: body, contentType: r.Header.Get("Content-Type"), modTime: time.Now()}
+		w.Header().Set("ETag", `"etag"`)
+	case r.Method == http.MethodGet || r.Method == http.MethodHead:
+		f.requests[strings.ToLower(r.Method)]++
+		f.get(w, r, key)
+	case r.Method == http.MethodDelete:
+		f.requests["delete"]++
+		delete(f.objects, key)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		f.fail(w, http.StatusMethodNotAllowed, "MethodNotAllowed", r.Method)
+	}
+}
+
+func (f *fakeS3) get(w http.ResponseWriter, r *http.Request, key string) {
+	obj, ok := f.objects[key]
+	if !ok {
+		f.fail(w, http.StatusNotFound, "NoSuchKey", "no such key")
+		return
+	}
+
+	w.Header().Set("Content-Type", obj.contentType)
+	w.Header().Set("Last-Modified", obj.modTime.UTC().Format(http.TimeFormat))
+
+	data, status := obj.data, http.StatusOK
+	if rng := r.Header.Get("Range"); rng != "" {
+		var start int
+		if _, err := fmt.Sscanf(rng, "bytes=%d-", &start); err != nil || start >= len(obj.data) {
+			f.fail(w, http.StatusRequestedRangeNotSatisfiable, "InvalidRange", rng)
+			return
+		}
+		data, status = obj.data[start:], http.StatusPartialContent
+		w.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", start, len(obj.data)-1, len(obj.data)))
+	}
+	w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+	w.WriteHeader(status)
+	if r.Method == http.MethodGet {
+		w.Write(data)
+	}
+}
+
+func (f *fakeS3) complete(w http.ResponseWriter, key, uploadID string, body []byte) {
+	upload, ok := f.uploads[uploadID]
+	if !ok {
+		f.fail(w, http.StatusNotFound, "NoSuchUpload", "no such upload")
+		return
+	}
+
+	var req struct {
+		Parts []s3CompletedPart `xml:"Part"`
+	}
+	if err := xml.Unmarshal(body, &req); err != nil || len(req.Parts) == 0 {
+		f.fail(w, http.StatusBadRequest, "MalformedXML", "bad complete request")
+		return
+	}
+
+	var data []byte
+	for i, part := range req.Parts {
+		if part.PartNumber != i+1 || part.ETag != fmt.Sprintf(`"etag-%d"`, part.PartNumber) {
+			f.fail(w, http.StatusBadRequest, "InvalidPart", "unexpected part")
+			return
+		}
+		// 与 S3 一致：除最后一个分片外每个分片不能小于 5MB
+		if i < len(req.Parts)-1 && len(upload.parts[part.PartNumber]) < s3MinPartSize {
+			f.fail(w, http.StatusBadRequest, "EntityTooSmall", "part too small")
+			return
+		}
+		data = append(data, upload.parts[part.PartNumber]...)
+	}
+
+	delete(f.uploads, uploadID)
+	f.objects[key] = fakeObject{data: data, contentType: upload.contentType, modTime: time.Now()}
+	writeXML(w, struct {
+		XMLName xml.Name `xml:"CompleteMultipartUploadResult"`
+		Key     string   `xml:"Key"`
+	}{Key: key})
+}
+
+func (f *fakeS3) list(w http.ResponseWriter, query url.Values) {
+	if query.Get("list-type") != "2" {
+		f.fail(w, http.StatusBadRequest, "InvalidArgument", "list-type")
+		return
+	}
+
+	var keys []string
+	for key := range f.objects {
+		if strings.HasPrefix(key, query.Get("prefix")) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	start := 0
+	if token := query.Get("continuation-token"); token != "" {
+		start, _ = strconv.Atoi(token)
+	}
+	end := start + f.pageSize
+	if end > len(keys) {
+		end = len(keys)
+	}
+
+	type content struct {
+		Key          string    `xml:"Key"`
+		Size         int64     `xml:"Size"`
+		LastModified time.Time `xml:"LastModified"`
+	}
+	result := struct {
+		XMLName               xml.Name  `xml:"ListBucketResult"`
+		IsTruncated           bool      `xml:"IsTruncated"`
+		NextContinuationToken string    `xml:"NextContinuationToken,omitempty"`
+		Contents              []content `xml:"Contents"`
+	}{}
+	for _, key := range keys[start:end] {
+		obj := f.objects[key]
+		result.Contents = append(result.Contents, content{Key: key, Size: int64(len(obj.data)), LastModified: obj.modTime.UTC()})
+	}
+	if end < len(keys) {
+		result.IsTruncated = true
+		result.NextContinuationToken = strconv.Itoa(end)
+	}
+	writeXML(w, result)
+}
+
+func (f *fakeS3) fail(w http.ResponseWriter, status int, code, message string) {
+	w.WriteHeader(status)
+	xml.NewEncoder(w).Encode(struct {
+		XMLName xml.Name `xml:"Error"`
+		Code    string   `xml:"Code"`
+		Message string   `xml:"Message"`
+	}{Code: code, Message: message})
+}
+
+func writeXML(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/xml")
+	xml.NewEncoder(w).Encode(v)
+}
+
+func newTestS3(t *testing.T) (*S3, *fakeS3) {
+	fake, srv := newFakeS3(t)
+	s, err := NewS3(config.S3Config{
+		Endpoint:     srv.URL,
+		Bucket:       fake.bucket,
+		Prefix:       "images",
+		AccessKey:    "test",
+		SecretKey:    "secret",
+		UsePathStyle: true,
+		PartSize:     s3MinPartSize,
+	})
+	if err != nil {
+		t.Fatalf("NewS3: %v", err)
+	}
+	return s, fake
+}
+
+func testData(size int) []byte {
+	data := make([]byte, size)
+	for i := range data {
+		data[i] = byte(i * 7)
+	}
+	return data
+}
+
+func TestS3PutSinglePart(t *testing.T) {
+	s, fake := newTestS3(t)
+	ctx := context.Background()
+
+	for _, size := range []int64{1024, -1} {
+		data := testData(1024)
+		if err := s.Put(ctx, "a/small.png", bytes.NewReader(data), size, "image/png"); err != nil {
+			t.Fatalf("Put(size=%d): %v", size, err)
+		}
+		obj := fake.objects["images/a/small.png"]
+		if !bytes.Equal(obj.data, data) || obj.contentType != "image/png" {
+			t.Fatalf("Put(size=%d) stored %d bytes of %q", size, len(obj.data), obj.contentType)
+		}
+	}
+
+	// 恰好一个分片大小时也应单次上传
+	data := testData(s3MinPartSize)
+	if err := s.Put(ctx, "a/exact.png", bytes.NewReader(data), int64(len(data)), "image/png"); err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+	if !bytes.Equal(fake.objects["images/a/exact.png"].data, data) {
+		t.Fatal("Put stored wrong content")
+	}
+
+	if n := fake.count("put"); n != 3 {
+		t.Errorf("put requests = %d, want 3", n)
+	}
+	if n := fake.count("create"); n != 0 {
+		t.Errorf("multipart uploads = %d, want 0", n)
+	}
+}
+
+func TestS3PutMultipart(t *testing.T) {
+	s, fake := newTestS3(t)
+	ctx := context.Background()
+
+	data := testData(2*s3MinPartSize + 1234)
+	for _, size := range []int64{int64(len(data)), -1} {
+		if err := s.Put(ctx, "big.jpg", bytes.NewReader(data), size, "image/jpeg"); err != nil {
+			t.Fatalf("Put(size=%d): %v", size, err)
+		}
+		obj := fake.objects["images/big.jpg"]
+		if !bytes.Equal(obj.data, data) || obj.contentType != "image/jpeg" {
+			t.Fatalf("Put(size=%d) stored %d bytes of %q", size, len(obj.data), obj.contentType)
+		}
+	}
+
+	if n := fake.count("create"); n != 2 {
+		t.Errorf("multipart uploads = %d, want 2", n)
+	}
+	if n := fake.count("part"); n != 6 {
+		t.Errorf("part uploads = %d, want 6", n)
+	}
+	if n := fake.count("put"); n != 0 {
+		t.Errorf("single put requests = %d, want 0", n)
+	}
+}
+
+func TestS3PutMultipartAbort(t *testing.T) {
+	s, fake := newTestS3(t)
+
+	// 读取第二个分片时出错，应放弃分片上传
+	readErr := errors.New("read failed")
+	r := io.MultiReader(bytes.NewReader(testData(s3MinPartSize+10)), &errReader{readErr})
+	if err := s.Put(context.Background(), "broken.jpg", r, -1, "image/jpeg"); !errors.Is(err, readErr) {
+		t.Fatalf("Put error = %v, want %v", err, readErr)
+	}
+	if n := fake.count("abort"); n != 1 {
+		t.Errorf("abort requests = %d, want 1", n)
+	}
+	if len(fake.uploads) != 0 {
+		t.Errorf("%d uploads left open", len(fake.uploads))
+	}
+	if _, ok := fake.objects["images/broken.jpg"]; ok {
+		t.Error("object created after failed upload")
+	}
+}
+
+func TestS3PutShortRead(t *testing.T) {
+	s, fake := newTestS3(t)
+	ctx := context.Background()
+
+	// 声明的大小大于实际数据时不能保存被截断的对象
+	for _, tc := range []struct {
+		key      string
+		size     int64
+		dataSize int
+	}{
+		{"short.png", 1024, 1000},
+		{"empty.png", 1024, 0},
+		{"short-first-part.jpg", s3MinPartSize + 10, s3MinPartSize - 10},
+		{"short-multipart.jpg", 2*s3MinPartSize + 1234, 2 * s3MinPartSize},
+	} {
+		err := s.Put(ctx, tc.key, bytes.NewReader(testData(tc.dataSize)), tc.size, "image/png")
+		if !errors.Is(err, io.ErrUnexpectedEOF) {
+			t.Errorf("Put(%s) error = %v, want short read", tc.key, err)
+		}
+		if _, ok := fake.objects["images/"+tc.key]; ok {
+			t.Errorf("Put(%s) stored a truncated object", tc.key)
+		}
+	}
+
+	if n := fake.count("put"); n != 0 {
+		t.Errorf("put requests = %d, want 0", n)
+	}
+	if n, aborted := fake.count("create"), fake.count("abort"); n != aborted {
+		t.Errorf("multipart uploads = %d, aborted = %d", n, aborted)
+	}
+	if len(fake.uploads) != 0 {
+		t.Errorf("%d uploads left open", len(fake.uploads))
+	}
+
+	// 数据多于声明的大小时只保存 size 字节
+	data := testData(2*s3MinPartSize + 100)
+	for _, size := range []int64{1000, s3MinPartSize + 10} {
+		if err := s.Put(ctx, "long.jpg", bytes.NewReader(data), size, "image/jpeg"); err != nil {
+			t.Fatalf("Put(size=%d): %v", size, err)
+		}
+		if obj := fake.objects["images/long.jpg"]; !bytes.Equal(obj.data, data[:size]) {
+			t.Fatalf("Put(size=%d) stored %d bytes", size, len(obj.data))
+		}
+	}
+}
+
+type errReader struct{ err error }
+
+func (r *errReader) Read([]byte) (int, error) { return 0, r.err }
+
+func TestS3GetRange(t *testing.T) {
+	s, fake := newTestS3(t)
+	ctx := context.Background()
+
+	data := testData(100000)
+	if err := s.Put(ctx, "photo.png", bytes.NewReader(data), int64(len(data)), "image/png"); err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+
+	rc, info, err := s.Get(ctx, "photo.png")
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	defer rc.Close()
+	if info.Size != int64(len(data)) || info.ContentType != "image/png" || info.ModTime.IsZero() {
+		t.Errorf("Get info = %+v", info)
+	}
+
+	rs, ok := rc.(io.ReadSeeker)
+	if !ok {
+		t.Fatal("Get should return an io.ReadSeeker")
+	}
+
+	head := make([]byte, 10)
+	if _, err := io.ReadFull(rs, head); err != nil || !bytes.Equal(head, data[:10]) {
+		t.Fatalf("read head: %v", err)
+	}
+	if _, err := rs.Seek(50000, io.SeekStart); err != nil {
+		t.Fatalf("Seek: %v", err)
+	}
+	mid := make([]byte, 100)
+	if _, err := io.ReadFull(rs, mid); err != nil || !bytes.Equal(mid, data[50000:50100]) {
+		t.Fatalf("read after seek: %v", err)
+	}
+	if n := fake.count("get"); n != 2 {
+		t.Errorf("get requests = %d, want 2", n)
+	}
+
+	// http.ServeContent 通过 Seek 处理 Range 请求
+	req := httptest.NewRequest(http.MethodGet, "/i/photo.png", nil)
+	req.Header.Set("Range", "bytes=99990-")
+	rec := httptest.NewRecorder()
+	rc2, info, err := s.Get(ctx, "photo.png")
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	defer rc2.Close()
+	http.ServeContent(rec, req, "photo.png", info.ModTime, rc2.(io.ReadSeeker))
+	if rec.Code != http.StatusPartialContent || !bytes.Equal(rec.Body.Bytes(), data[99990:]) {
+		t.Errorf("ServeContent = %d with %d bytes", rec.Code, rec.Body.Len())
+	}
+
+	if _, _, err := s.Get(ctx, "missing.png"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Get missing = %v, want ErrNotFound", err)
+	}
+}
+
+func TestS3Stat(t *testing.T) {
+	s, _ := newTestS3(t)
+	ctx := context.Background()
+
+	if err := s.Put(ctx, "stat.webp", bytes.NewReader(testData(321)), 321, "image/webp"); err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+
+	info, err := s.Stat(ctx, "stat.webp")
+	if err != nil {
+		t.Fatalf("Stat: %v", err)
+	}
+	if info.Key != "stat.webp" || info.Size != 321 || info.ContentType != "image/webp" || info.ModTime.IsZero() {
+		t.Errorf("Stat = %+v", info)
+	}
+
+	if _, err := s.Stat(ctx, "missing.webp"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Stat missing = %v, want ErrNotFound", err)
+	}
+}
+
+func TestS3Delete(t *testing.T) {
+	s, fake := newTestS3(t)
+	ctx := context.Background()
+
+	if err := s.Put(ctx, "gone.gif", bytes.NewReader(testData(10)), 10, "image/gif"); err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+	if err := s.Delete(ctx, "gone.gif"); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if _, ok := fake.objects["images/gone.gif"]; ok {
+		t.Error("object still exists after Delete")
+	}
+	// 删除不存在的对象不返回错误
+	if err := s.Delete(ctx, "gone.gif"); err != nil {
+		t.Errorf("Delete missing: %v", err)
+	}
+}
+
+func TestS3List(t *testing.T) {
+	s, fake := newTestS3(t)
+	ctx := context.Background()
+
+	keys := []string{"2024/01/a.png", "2024/01/b.png", "2024/02/c.png", "2024/02/d.png", "2024/03/e.png", "other/f.png"}
+	for _, key := range keys {
+		if err := s.Put(ctx, key, bytes.NewReader(testData(len(key))), int64(len(key)), "image/png"); err != nil {
+			t.Fatalf("Put %s: %v", key, err)
+		}
+	}
+
+	objects, err := s.List(ctx, "2024/")
+	if err != nil {
+		t.Fatalf("List: %v", err)
+	}
+	var got []string
+	for _, obj := range objects {
+		if obj.Size != int64(len(obj.Key)) || obj.ModTime.IsZero() {
+			t.Errorf("List object = %+v", obj)
+		}
+		got = append(got, obj.Key)
+	}
+	if want := keys[:5]; strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("List = %v, want %v", got, want)
+	}
+	// 每页 2 个，5 个对象需要 3 次请求
+	if n := fake.count("list"); n != 3 {
+		t.Errorf("list requests = %d, want 3", n)
+	}
+}
@@ -0,0 +1,64 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"gotux/config"
+	"io"
+	"log"
+	"time"
+)
+
+// ErrNotFound 对象不存在
+var ErrNotFound = errors.New("storage: object not found")
+
+// ObjectInfo 存储对象的元信息
+type ObjectInfo struct {
+	Key         string
+	Size        int64
+	ContentType string
+	ModTime     time.Time
+}
+
+// Driver 存储后端接口
+//
+// key 均为相对于存储根的路径（如 2006/01/02/xxx.jpg），与 Image.FilePath 一致。
+type Driver interface {
+	// Put 写入对象，size 未知时传 -1
+	Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) error
+	// Get 读取对象，调用方负责关闭返回的 ReadCloser
+	Get(ctx context.Context, key string) (io.ReadCloser, *ObjectInfo, error)
+	// Stat 获取对象信息
+	Stat(ctx context.Context, key string) (*ObjectInfo, error)
+	// Delete 删除对象，对象不存在时不返回错误
+	Delete(ctx context.Context, key string) error
+	// List 列出指定前缀下的所有对象
+	List(ctx context.Context, prefix string) ([]ObjectInfo, error)
+	// URL 返回对象的直接访问地址，不支持直链时返回空字符串
+	URL(key string) string
+}
+
+// Default 当前使用的存储后端
+var Default Driver
+
+// InitStorage 根据配置初始化存储后端
+func InitStorage() {
+	driver, err := New(config.AppConfig.Upload)
+	if err != nil {
+		log.Fatal("Failed to initialize storage:", err)
+	}
+	Default = driver
+}
+
+// New 根据上传配置创建存储后端
+func New(cfg config.UploadConfig) (Driver, error) {
+	switch cfg.Driver {
+	case "", "local":
+		return NewLocal(cfg.StoragePath, cfg.PublicPath)
+	case "s3":
+		return NewS3(cfg.S3)
+	default:
+		return nil, fmt.Errorf("storage: unknown driver %q", cfg.Driver)
+	}
+}
@@ -12,10 +12,26 @@ export function updateUserQuota(id, storageQuota) {
   return request.put(`/admin/users/${id}/quota`, { storage_quota: storageQuota })
 }
 
+export function updateUserReview(id, enableImageReview) {
+  return request.put(`/admin/users/${id}/review`, { enable_image_review: enableImageReview })
+}
+
 export function getAllImages(params) {
   return request.get('/admin/images', { params })
 }
 
+export function getReviewQueue(params) {
+  return request.get('/admin/reviews', { params })
+}
+
+export function approveImages(imageIds) {
+  return request.post('/admin/reviews/approve', { image_ids: imageIds })
+}
+
+export function rejectImages(imageIds, reason) {
+  return request.post('/admin/reviews/reject', { image_ids: imageIds, reason })
+}
+
 export function getSystemStats() {
   return request.get('/admin/stats')
 }
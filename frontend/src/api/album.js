@@ -0,0 +1,29 @@
+import request from '@/utils/request'
+
+export function getAlbums(params) {
+  return request.get('/albums', { params })
+}
+
+export function createAlbum(data) {
+  return request.post('/albums', data)
+}
+
+export function updateAlbum(id, data) {
+  return request.put(`/albums/${id}`, data)
+}
+
+export function deleteAlbum(id) {
+  return request.delete(`/albums/${id}`)
+}
+
+export function addAlbumImages(id, imageIds) {
+  return request.post(`/albums/${id}/images`, { image_ids: imageIds })
+}
+
+export function removeAlbumImages(id, imageIds) {
+  return request.post(`/albums/${id}/images/remove`, { image_ids: imageIds })
+}
+
+export function reorderAlbumImages(id, imageIds) {
+  return request.put(`/albums/${id}/images/order`, { image_ids: imageIds })
+}
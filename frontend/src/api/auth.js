@@ -4,8 +4,48 @@ export function login(username, password) {
   return request.post('/auth/login', { username, password })
 }
 
-export function register(username, email, password) {
-  return request.post('/auth/register', { username, email, password })
+export function verifyTwoFactor(challengeToken, data) {
+  return request.post('/auth/2fa/verify', { challenge_token: challengeToken, ...data })
+}
+
+export function beginTwoFactorSetup(challengeToken) {
+  return request.post('/auth/2fa/setup', { challenge_token: challengeToken })
+}
+
+export function completeTwoFactorSetup(challengeToken, code) {
+  return request.post('/auth/2fa/setup/verify', { challenge_token: challengeToken, code })
+}
+
+export function logout(refreshToken) {
+  return request.post('/auth/logout', { refresh_token: refreshToken })
+}
+
+export function getOIDCConfig() {
+  return request.get('/auth/oidc/config')
+}
+
+export function register(username, email, password, inviteCode) {
+  return request.post('/auth/register', { username, email, password, invite_code: inviteCode })
+}
+
+export function getRegistrationConfig() {
+  return request.get('/auth/register/config')
+}
+
+export function forgotPassword(email) {
+  return request.post('/auth/forgot-password', { email })
+}
+
+export function resetPassword(token, password) {
+  return request.post('/auth/reset-password', { token, password })
+}
+
+export function verifyEmail(token) {
+  return request.post('/auth/verify-email', { token })
+}
+
+export function resendVerification(email) {
+  return request.post('/auth/resend-verification', { email })
 }
 
 export function getProfile() {
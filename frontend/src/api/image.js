@@ -10,6 +10,11 @@ export function getImages(params) {
   return request.get('/images', { params })
 }
 
+// 全文搜索，结果按相关度排序，snippet 中的匹配内容用 <mark> 标出
+export function searchImages(params) {
+  return request.get('/images/search', { params })
+}
+
 export function getImageDetail(id) {
   return request.get(`/images/${id}`)
 }
@@ -30,6 +35,15 @@ export function getImageLinks(id) {
   return request.get(`/images/${id}/links`)
 }
 
+// 未通过审核的图片不能公开访问，需要带上登录令牌读取，返回 Blob
+export function getImageBlob(uuid, variant) {
+  return request.get(`/i/${uuid}`, {
+    baseURL: '/',
+    params: variant ? { variant } : {},
+    responseType: 'blob'
+  })
+}
+
 // 随机图片 API (不需要认证)
 export function getRandomImage(params) {
   // 直接使用 fetch 避免添加 Authorization 头
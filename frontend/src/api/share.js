@@ -0,0 +1,28 @@
+import axios from 'axios'
+import request from '@/utils/request'
+
+export function getShares(params) {
+  return request.get('/shares', { params })
+}
+
+export function getShare(id) {
+  return request.get(`/shares/${id}`)
+}
+
+export function createShare(data) {
+  return request.post('/shares', data)
+}
+
+export function updateShare(id, data) {
+  return request.put(`/shares/${id}`, data)
+}
+
+export function deleteShare(id) {
+  return request.delete(`/shares/${id}`)
+}
+
+// 公开分享页面无需登录，密码错误时的 401 由页面自行处理，不走登录过期逻辑
+export function getSharedImages(token, password) {
+  const headers = password ? { 'X-Share-Password': password } : {}
+  return axios.get(`/api/s/${token}`, { headers }).then(({ data }) => data)
+}
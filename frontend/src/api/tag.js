@@ -0,0 +1,9 @@
+import request from '@/utils/request'
+
+export function getTags(params) {
+  return request.get('/tags', { params })
+}
+
+export function suggestTags(q, limit = 10) {
+  return request.get('/tags/suggest', { params: { q, limit } })
+}
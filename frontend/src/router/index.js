@@ -15,6 +15,30 @@ const routes = [
     component: () => import('@/views/Register.vue'),
     meta: { requiresAuth: false }
   },
+  {
+    path: '/forgot-password',
+    name: 'ForgotPassword',
+    component: () => import('@/views/ResetPassword.vue'),
+    meta: { requiresAuth: false }
+  },
+  {
+    path: '/reset-password',
+    name: 'ResetPassword',
+    component: () => import('@/views/ResetPassword.vue'),
+    meta: { requiresAuth: false }
+  },
+  {
+    path: '/verify-email',
+    name: 'VerifyEmail',
+    component: () => import('@/views/VerifyEmail.vue'),
+    meta: { requiresAuth: false }
+  },
+  {
+    path: '/s/:token',
+    name: 'ShareView',
+    component: () => import('@/views/ShareView.vue'),
+    meta: { requiresAuth: false }
+  },
   {
     path: '/',
     component: Layout,
@@ -39,6 +63,18 @@ const routes = [
         component: () => import('@/views/Upload.vue'),
         meta: { title: '上传图片' }
       },
+      {
+        path: 'albums',
+        name: 'Albums',
+        component: () => import('@/views/Albums.vue'),
+        meta: { title: '相册' }
+      },
+      {
+        path: 'shares',
+        name: 'Shares',
+        component: () => import('@/views/Shares.vue'),
+        meta: { title: '我的分享' }
+      },
       {
         path: 'profile',
         name: 'Profile',
@@ -56,6 +92,12 @@ const routes = [
         name: 'AdminImages',
         component: () => import('@/views/admin/Images.vue'),
         meta: { title: '图片管理', requiresAdmin: true }
+      },
+      {
+        path: 'admin/reviews',
+        name: 'AdminReviews',
+        component: () => import('@/views/admin/Reviews.vue'),
+        meta: { title: '图片审核', requiresAdmin: true }
       }
     ]
   }
@@ -4,14 +4,19 @@ import * as authApi from '@/api/auth'
 
 export const useUserStore = defineStore('user', () => {
   const token = ref(localStorage.getItem('token') || '')
+  const refreshToken = ref(localStorage.getItem('refreshToken') || '')
   const userInfo = ref(JSON.parse(localStorage.getItem('userInfo') || 'null'))
 
   const isLoggedIn = computed(() => !!token.value)
   const isAdmin = computed(() => userInfo.value?.role === 'admin')
 
-  function setToken(newToken) {
+  function setToken(newToken, newRefreshToken) {
     token.value = newToken
     localStorage.setItem('token', newToken)
+    if (newRefreshToken) {
+      refreshToken.value = newRefreshToken
+      localStorage.setItem('refreshToken', newRefreshToken)
+    }
   }
 
   function setUserInfo(info) {
@@ -19,15 +24,33 @@ export const useUserStore = defineStore('user', () => {
     localStorage.setItem('userInfo', JSON.stringify(info))
   }
 
+  // 开启了两步验证时返回挑战令牌，需再调用 verifyTwoFactor 或 completeTwoFactorSetup
   async function login(username, password) {
     const data = await authApi.login(username, password)
-    setToken(data.token)
+    if (data.challenge_token) {
+      return data
+    }
+    setToken(data.token, data.refresh_token)
     setUserInfo(data.user)
     return data
   }
 
-  async function register(username, email, password) {
-    return await authApi.register(username, email, password)
+  async function verifyTwoFactor(challengeToken, payload) {
+    const data = await authApi.verifyTwoFactor(challengeToken, payload)
+    setToken(data.token, data.refresh_token)
+    setUserInfo(data.user)
+    return data
+  }
+
+  async function completeTwoFactorSetup(challengeToken, code) {
+    const data = await authApi.completeTwoFactorSetup(challengeToken, code)
+    setToken(data.token, data.refresh_token)
+    setUserInfo(data.user)
+    return data
+  }
+
+  async function register(username, email, password, inviteCode) {
+    return await authApi.register(username, email, password, inviteCode)
   }
 
   async function fetchProfile() {
@@ -36,22 +59,41 @@ export const useUserStore = defineStore('user', () => {
     return data
   }
 
-  function logout() {
+  // 退出登录：通知服务端吊销会话，失败时也清除本地状态
+  async function logout() {
+    if (refreshToken.value) {
+      try {
+        await authApi.logout(refreshToken.value)
+      } catch (error) {
+        console.error('Logout error:', error)
+      }
+    }
+    clearSession()
+  }
+
+  function clearSession() {
     token.value = ''
+    refreshToken.value = ''
     userInfo.value = null
     localStorage.removeItem('token')
+    localStorage.removeItem('refreshToken')
     localStorage.removeItem('userInfo')
   }
 
   return {
     token,
+    refreshToken,
     userInfo,
     isLoggedIn,
     isAdmin,
     login,
+    verifyTwoFactor,
+    completeTwoFactorSetup,
     register,
     fetchProfile,
     logout,
+    clearSession,
+    setToken,
     setUserInfo
   }
 })
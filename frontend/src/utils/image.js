@@ -0,0 +1,48 @@
+import { reactive } from 'vue'
+import { getImageBlob } from '@/api/image'
+
+// 未通过审核的图片不在 /uploads 下公开，带上登录令牌读取后以 Blob 地址显示
+const blobUrls = reactive({})
+const requested = new Set()
+
+function isApproved(image) {
+  return !image.review_status || image.review_status === 'approved'
+}
+
+function blobUrl(image, variant) {
+  const key = variant ? `${image.uuid}:${variant}` : image.uuid
+  if (!requested.has(key)) {
+    requested.add(key)
+    getImageBlob(image.uuid, variant)
+      .then(blob => { blobUrls[key] = URL.createObjectURL(blob) })
+      .catch(error => {
+        requested.delete(key)
+        console.error('Load image error:', error)
+      })
+  }
+  return blobUrls[key] || ''
+}
+
+function hasThumb(image) {
+  return image.variants?.some(v => v.name === 'thumb')
+}
+
+// 图片原图地址，用于大图预览
+export function originalUrl(image) {
+  if (!isApproved(image)) {
+    return blobUrl(image)
+  }
+  return `/uploads/${image.file_path}`
+}
+
+// 图片列表中使用的缩略图地址。私有图片和未通过审核的图片不能匿名访问 /i/:uuid，
+// 没有生成缩略图的图片（比原尺寸还小或按需生成尚未请求过）也使用原图
+export function thumbUrl(image) {
+  if (!isApproved(image)) {
+    return hasThumb(image) ? blobUrl(image, 'thumb') : blobUrl(image)
+  }
+  if (image.is_public && hasThumb(image)) {
+    return `/i/${image.uuid}?variant=thumb`
+  }
+  return originalUrl(image)
+}
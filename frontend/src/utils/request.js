@@ -21,18 +21,49 @@ request.interceptors.request.use(
   }
 )
 
+// 同一时间只发起一次刷新，其他请求等待同一个结果（刷新令牌只能使用一次）
+let refreshing = null
+
+function refreshAccessToken(userStore) {
+  if (!refreshing) {
+    refreshing = axios
+      .post('/api/auth/refresh', { refresh_token: userStore.refreshToken })
+      .then(({ data }) => {
+        userStore.setToken(data.token, data.refresh_token)
+        userStore.setUserInfo(data.user)
+        return data.token
+      })
+      .finally(() => {
+        refreshing = null
+      })
+  }
+  return refreshing
+}
+
 // 响应拦截器
 request.interceptors.response.use(
   response => {
     return response.data
   },
-  error => {
+  async error => {
     if (error.response) {
       const { status, data } = error.response
-      
+      const userStore = useUserStore()
+
+      // 访问令牌过期时用刷新令牌换取新令牌后重试
+      if (status === 401 && userStore.refreshToken && !error.config._retried && !error.config.url.startsWith('/auth/')) {
+        try {
+          const token = await refreshAccessToken(userStore)
+          error.config._retried = true
+          error.config.headers.Authorization = `Bearer ${token}`
+          return request(error.config)
+        } catch (refreshError) {
+          // 刷新失败，按登录过期处理
+        }
+      }
+
       if (status === 401) {
-        const userStore = useUserStore()
-        userStore.logout()
+        userStore.clearSession()
         window.location.href = '/login'
         ElMessage.error('登录已过期，请重新登录')
       } else if (status === 403) {